@@ -3,7 +3,8 @@ package clients
 import (
 	"context"
 	"fmt"
-	"strings"
+	"net/http"
+	"net/url"
 
 	dataProtection "github.com/hashicorp/go-azure-sdk/resource-manager/dataprotection/2023-05-01"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/keyvault/2023-07-01/managedhsms"
@@ -23,6 +24,7 @@ import (
 	"github.com/hashicorp/go-azure-sdk/resource-manager/storagesync/2020-03-01/storagesyncservicesresource"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/storagesync/2020-03-01/syncgroupresource"
 	"github.com/hashicorp/go-azure-sdk/sdk/auth"
+	"github.com/hashicorp/go-azure-sdk/sdk/client"
 	"github.com/hashicorp/go-azure-sdk/sdk/client/resourcemanager"
 	"github.com/hashicorp/go-azure-sdk/sdk/environments"
 	"github.com/manicminer/hamilton/msgraph"
@@ -32,6 +34,35 @@ type AzureClient struct {
 	MicrosoftGraph  MicrosoftGraphClient
 	ResourceManager ResourceManagerClient
 	SubscriptionID  string
+
+	// Profile is the APIProfile used by the Resource Manager clients
+	Profile APIProfile
+
+	closers []func()
+	guard   client.RequestMiddleware
+}
+
+// Close releases any resources held by this AzureClient, such as the loopback server used for a custom Transport
+func (c *AzureClient) Close() {
+	for _, closer := range c.closers {
+		closer()
+	}
+	c.closers = nil
+}
+
+// Guarded returns whether this AzureClient was built with a Guard which rejects mutating requests, which is
+// checked by running it against a DELETE request which wasn't issued through the deletion gateway
+func (c *AzureClient) Guarded() bool {
+	if c.guard == nil {
+		return false
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, "https://management.azure.com/", nil)
+	if err != nil {
+		return false
+	}
+	_, err = c.guard(req)
+	return err != nil
 }
 
 type MicrosoftGraphClient struct {
@@ -70,7 +101,28 @@ type Credentials struct {
 	Endpoint        string
 }
 
-func BuildAzureClient(ctx context.Context, credentials Credentials) (*AzureClient, error) {
+// Authorizers are the Authorizers used to authenticate against each API
+type Authorizers struct {
+	MicrosoftGraph  auth.Authorizer
+	ResourceManager auth.Authorizer
+}
+
+// ClientOptions are the optional settings used when building an AzureClient
+type ClientOptions struct {
+	// Transport, when specified, is used to send every request rather than the default HTTP Transport - for
+	// example to record the requests being made, or to serve fixtures/recorded responses in tests.
+	Transport http.RoundTripper
+
+	// Guard is run against every request sent to Resource Manager and Microsoft Graph before anything else, and
+	// should reject any mutating request which wasn't issued through the deletion gateway (see `gateway.Guard`)
+	Guard client.RequestMiddleware
+
+	// APIProfile, when specified, overrides the APIProfile determined from the Environment (where Azure Stack Hub
+	// environments use ProfileAzureStackHub, and all others use ProfileLatest)
+	APIProfile *APIProfile
+}
+
+func BuildAzureClient(ctx context.Context, credentials Credentials, clientOpts ClientOptions) (*AzureClient, error) {
 	environment, err := environmentFromCredentials(ctx, credentials)
 	if err != nil {
 		return nil, fmt.Errorf("determining Environment: %+v", err)
@@ -85,27 +137,84 @@ func BuildAzureClient(ctx context.Context, credentials Credentials) (*AzureClien
 		EnableAuthenticatingUsingClientSecret: true,
 	}
 
-	resourceManager, err := buildResourceManagerClient(ctx, creds, *environment)
+	resourceManagerAuthorizer, err := auth.NewAuthorizerFromCredentials(ctx, creds, environment.ResourceManager)
 	if err != nil {
-		return nil, fmt.Errorf("building Resource Manager client: %+v", err)
+		return nil, fmt.Errorf("building Resource Manager authorizer: %+v", err)
 	}
 
-	microsoftGraph, err := buildMicrosoftGraphClient(ctx, creds, *environment)
+	microsoftGraphAuthorizer, err := auth.NewAuthorizerFromCredentials(ctx, creds, environment.MicrosoftGraph)
 	if err != nil {
-		return nil, fmt.Errorf("building Microsoft Graph client: %+v", err)
+		return nil, fmt.Errorf("building Microsoft Graph authorizer: %+v", err)
 	}
 
+	authorizers := Authorizers{
+		MicrosoftGraph:  microsoftGraphAuthorizer,
+		ResourceManager: resourceManagerAuthorizer,
+	}
+	return NewAzureClient(*environment, authorizers, credentials.SubscriptionID, clientOpts)
+}
+
+// NewAzureClient builds an AzureClient for the specified Environment using the specified Authorizers
+func NewAzureClient(environment environments.Environment, authorizers Authorizers, subscriptionId string, clientOpts ClientOptions) (*AzureClient, error) {
 	azureClient := AzureClient{
-		MicrosoftGraph:  *microsoftGraph,
-		ResourceManager: *resourceManager,
-		SubscriptionID:  credentials.SubscriptionID,
+		SubscriptionID: subscriptionId,
+		Profile:        profileForEnvironment(environment),
+	}
+	if clientOpts.APIProfile != nil {
+		azureClient.Profile = *clientOpts.APIProfile
+	}
+
+	middlewares := make([]client.RequestMiddleware, 0)
+	if clientOpts.Guard != nil {
+		azureClient.guard = clientOpts.Guard
+		middlewares = append(middlewares, clientOpts.Guard)
+	}
+	if clientOpts.Transport != nil {
+		middleware, closer, err := routeThroughTransport(clientOpts.Transport, environmentHosts(environment))
+		if err != nil {
+			return nil, fmt.Errorf("routing requests through the Transport: %+v", err)
+		}
+		middlewares = append(middlewares, middleware)
+		azureClient.closers = append(azureClient.closers, closer)
+	}
+
+	resourceManager, err := buildResourceManagerClient(authorizers.ResourceManager, environment, azureClient.Profile, middlewares)
+	if err != nil {
+		azureClient.Close()
+		return nil, fmt.Errorf("building Resource Manager client: %+v", err)
 	}
 
+	microsoftGraph, err := buildMicrosoftGraphClient(authorizers.MicrosoftGraph, environment, middlewares)
+	if err != nil {
+		azureClient.Close()
+		return nil, fmt.Errorf("building Microsoft Graph client: %+v", err)
+	}
+
+	azureClient.MicrosoftGraph = *microsoftGraph
+	azureClient.ResourceManager = *resourceManager
 	return &azureClient, nil
 }
 
+// environmentHosts returns the hosts of the Resource Manager and Microsoft Graph endpoints for the Environment
+func environmentHosts(environment environments.Environment) []string {
+	hosts := make([]string, 0)
+	for _, api := range []environments.Api{environment.ResourceManager, environment.MicrosoftGraph} {
+		if api == nil {
+			continue
+		}
+		endpoint, ok := api.Endpoint()
+		if !ok || endpoint == nil {
+			continue
+		}
+		if u, err := url.Parse(*endpoint); err == nil && u.Host != "" {
+			hosts = append(hosts, u.Host)
+		}
+	}
+	return hosts
+}
+
 func environmentFromCredentials(ctx context.Context, credentials Credentials) (*environments.Environment, error) {
-	if strings.Contains(strings.ToLower(credentials.EnvironmentName), "stack") {
+	if isAzureStack(credentials.EnvironmentName) {
 		// for Azure Stack we have to load the Environment from the URI
 		env, err := environments.FromEndpoint(ctx, credentials.Endpoint, credentials.EnvironmentName)
 		if err != nil {
@@ -123,11 +232,12 @@ func environmentFromCredentials(ctx context.Context, credentials Credentials) (*
 	return env, nil
 }
 
-func buildMicrosoftGraphClient(ctx context.Context, creds auth.Credentials, environment environments.Environment) (*MicrosoftGraphClient, error) {
-	microsoftGraphAuthorizer, err := auth.NewAuthorizerFromCredentials(ctx, creds, environment.MicrosoftGraph)
-	if err != nil {
-		return nil, fmt.Errorf("building Microsoft Graph authorizer: %+v", err)
+func buildMicrosoftGraphClient(microsoftGraphAuthorizer auth.Authorizer, environment environments.Environment, middlewares []client.RequestMiddleware) (*MicrosoftGraphClient, error) {
+	graphMiddlewares := make([]msgraph.RequestMiddleware, 0)
+	for _, m := range middlewares {
+		graphMiddlewares = append(graphMiddlewares, msgraph.RequestMiddleware(m))
 	}
+
 	microsoftGraphEndpoint, ok := environment.MicrosoftGraph.Endpoint()
 	if !ok {
 		return nil, fmt.Errorf("environment %q was missing a Microsoft Graph endpoint", environment.Name)
@@ -136,18 +246,22 @@ func buildMicrosoftGraphClient(ctx context.Context, creds auth.Credentials, envi
 	applicationsClient := msgraph.NewApplicationsClient()
 	applicationsClient.BaseClient.Authorizer = microsoftGraphAuthorizer
 	applicationsClient.BaseClient.Endpoint = *microsoftGraphEndpoint
+	applicationsClient.BaseClient.RequestMiddlewares = &graphMiddlewares
 
 	groupsClient := msgraph.NewGroupsClient()
 	groupsClient.BaseClient.Authorizer = microsoftGraphAuthorizer
 	groupsClient.BaseClient.Endpoint = *microsoftGraphEndpoint
+	groupsClient.BaseClient.RequestMiddlewares = &graphMiddlewares
 
 	servicePrincipalsClient := msgraph.NewServicePrincipalsClient()
 	servicePrincipalsClient.BaseClient.Authorizer = microsoftGraphAuthorizer
 	servicePrincipalsClient.BaseClient.Endpoint = *microsoftGraphEndpoint
+	servicePrincipalsClient.BaseClient.RequestMiddlewares = &graphMiddlewares
 
 	usersClient := msgraph.NewUsersClient()
 	usersClient.BaseClient.Authorizer = microsoftGraphAuthorizer
 	usersClient.BaseClient.Endpoint = *microsoftGraphEndpoint
+	usersClient.BaseClient.RequestMiddlewares = &graphMiddlewares
 
 	return &MicrosoftGraphClient{
 		Applications:      applicationsClient,
@@ -157,14 +271,14 @@ func buildMicrosoftGraphClient(ctx context.Context, creds auth.Credentials, envi
 	}, nil
 }
 
-func buildResourceManagerClient(ctx context.Context, creds auth.Credentials, environment environments.Environment) (*ResourceManagerClient, error) {
-	resourceManagerAuthorizer, err := auth.NewAuthorizerFromCredentials(ctx, creds, environment.ResourceManager)
-	if err != nil {
-		return nil, fmt.Errorf("building Resource Manager authorizer: %+v", err)
-	}
+func buildResourceManagerClient(resourceManagerAuthorizer auth.Authorizer, environment environments.Environment, profile APIProfile, middlewares []client.RequestMiddleware) (*ResourceManagerClient, error) {
+	// the API Versions for the Lock and Resource Group operations are pinned to those in the APIProfile, this
+	// needs to happen before the other middlewares since these can rewrite the request
+	locksMiddlewares := append([]client.RequestMiddleware{pinAPIVersion(locksAPIVersion, profile.LocksAPIVersion)}, middlewares...)
+	resourcesMiddlewares := append([]client.RequestMiddleware{pinAPIVersion(resourceGroupsAPIVersion, profile.ResourcesAPIVersion)}, middlewares...)
 
 	dataProtectionClient, err := dataProtection.NewClientWithBaseURI(environment.ResourceManager, func(c *resourcemanager.Client) {
-		c.Authorizer = resourceManagerAuthorizer
+		configureResourceManagerClient(c, resourceManagerAuthorizer, middlewares)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("building Data Protection Client: %+v", err)
@@ -174,58 +288,58 @@ func buildResourceManagerClient(ctx context.Context, creds auth.Credentials, env
 	if err != nil {
 		return nil, fmt.Errorf("building ManagementLocks client: %+v", err)
 	}
-	locksClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(locksClient.Client, resourceManagerAuthorizer, locksMiddlewares)
 
 	workspacesClient, err := workspaces.NewWorkspacesClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building Machine Learning Workspaces Client: %+v", err)
 	}
-	workspacesClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(workspacesClient.Client, resourceManagerAuthorizer, middlewares)
 
 	managementClient, err := managementgroups.NewManagementGroupsClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building ManagementGroups client: %+v", err)
 	}
-	managementClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(managementClient.Client, resourceManagerAuthorizer, middlewares)
 
 	managedHsmsClient, err := managedhsms.NewManagedHsmsClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building Managed HSM Client: %+v", err)
 	}
-	managedHsmsClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(managedHsmsClient.Client, resourceManagerAuthorizer, middlewares)
 
 	netAppAccountClient, err := netappaccounts.NewNetAppAccountsClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building NetApp Account Client: %+v", err)
 	}
-	netAppAccountClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(netAppAccountClient.Client, resourceManagerAuthorizer, middlewares)
 
 	netAppCapacityPoolClient, err := capacitypools.NewCapacityPoolsClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building NetApp Capacity Pool Client: %+v", err)
 	}
-	netAppCapacityPoolClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(netAppCapacityPoolClient.Client, resourceManagerAuthorizer, middlewares)
 
 	netAppVolumeClient, err := volumes.NewVolumesClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building NetApp Volume Client: %+v", err)
 	}
-	netAppVolumeClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(netAppVolumeClient.Client, resourceManagerAuthorizer, middlewares)
 
 	netAppVolumeReplicationClient, err := volumesreplication.NewVolumesReplicationClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building NetApp Volume Replication Client: %+v", err)
 	}
-	netAppVolumeReplicationClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(netAppVolumeReplicationClient.Client, resourceManagerAuthorizer, middlewares)
 
 	notificationHubNamespacesClient, err := namespaces.NewNamespacesClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building Notification Hub Namespaces Client: %+v", err)
 	}
-	notificationHubNamespacesClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(notificationHubNamespacesClient.Client, resourceManagerAuthorizer, middlewares)
 
 	paloAltoClient, err := paloAltoNetworks.NewClientWithBaseURI(environment.ResourceManager, func(c *resourcemanager.Client) {
-		c.Authorizer = resourceManagerAuthorizer
+		configureResourceManagerClient(c, resourceManagerAuthorizer, middlewares)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("building Palo Alto Networks Client: %+v", err)
@@ -235,16 +349,16 @@ func buildResourceManagerClient(ctx context.Context, creds auth.Credentials, env
 	if err != nil {
 		return nil, fmt.Errorf("building ResourceGraph client: %+v", err)
 	}
-	resourceGraphClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(resourceGraphClient.Client, resourceManagerAuthorizer, middlewares)
 
 	resourcesClient, err := resourcegroups.NewResourceGroupsClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building Resources client: %+v", err)
 	}
-	resourcesClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(resourcesClient.Client, resourceManagerAuthorizer, resourcesMiddlewares)
 
 	serviceBusClient, err := serviceBus.NewClientWithBaseURI(environment.ResourceManager, func(c *resourcemanager.Client) {
-		c.Authorizer = resourceManagerAuthorizer
+		configureResourceManagerClient(c, resourceManagerAuthorizer, middlewares)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("building ServiceBus Client: %+v", err)
@@ -254,19 +368,19 @@ func buildResourceManagerClient(ctx context.Context, creds auth.Credentials, env
 	if err != nil {
 		return nil, fmt.Errorf("building StorageSync Client: %+v", err)
 	}
-	storageSyncClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(storageSyncClient.Client, resourceManagerAuthorizer, middlewares)
 
 	storageSyncGroupClient, err := syncgroupresource.NewSyncGroupResourceClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building StorageSyncGroup Client: %+v", err)
 	}
-	storageSyncGroupClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(storageSyncGroupClient.Client, resourceManagerAuthorizer, middlewares)
 
 	storageSyncCloudEndpointClient, err := cloudendpointresource.NewCloudEndpointResourceClientWithBaseURI(environment.ResourceManager)
 	if err != nil {
 		return nil, fmt.Errorf("building StorageSyncCloudEndpoint Client: %+v", err)
 	}
-	storageSyncCloudEndpointClient.Client.Authorizer = resourceManagerAuthorizer
+	configureResourceManagerClient(storageSyncCloudEndpointClient.Client, resourceManagerAuthorizer, middlewares)
 
 	return &ResourceManagerClient{
 		DataProtection:                  dataProtectionClient,
@@ -288,3 +402,9 @@ func buildResourceManagerClient(ctx context.Context, creds auth.Credentials, env
 		StorageSyncCloudEndpointClient:  storageSyncCloudEndpointClient,
 	}, nil
 }
+
+// configureResourceManagerClient configures the authorizer and request middlewares for the specified client
+func configureResourceManagerClient(c *resourcemanager.Client, authorizer auth.Authorizer, middlewares []client.RequestMiddleware) {
+	c.Authorizer = authorizer
+	c.RequestMiddlewares = &middlewares
+}
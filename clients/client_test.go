@@ -0,0 +1,49 @@
+package clients
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/sdk/client"
+)
+
+func TestAzureClientGuarded(t *testing.T) {
+	testData := []struct {
+		name     string
+		guard    client.RequestMiddleware
+		expected bool
+	}{
+		{
+			name:     "no guard",
+			expected: false,
+		},
+		{
+			name: "guard allowing mutations",
+			guard: func(req *http.Request) (*http.Request, error) {
+				return req, nil
+			},
+			expected: false,
+		},
+		{
+			name: "guard rejecting mutations",
+			guard: func(req *http.Request) (*http.Request, error) {
+				if req.Method != http.MethodGet {
+					return nil, errors.New("rejected")
+				}
+				return req, nil
+			},
+			expected: true,
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			c := AzureClient{
+				guard: v.guard,
+			}
+			if actual := c.Guarded(); actual != v.expected {
+				t.Fatalf("expected Guarded to be %t but got %t", v.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package clients
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-azure-sdk/sdk/client"
+	"github.com/hashicorp/go-azure-sdk/sdk/environments"
+)
+
+const (
+	// locksAPIVersion is the API Version of the vendored `managementlocks` package
+	locksAPIVersion = "2020-05-01"
+
+	// resourceGroupsAPIVersion is the API Version of the vendored `resourcegroups` package
+	resourceGroupsAPIVersion = "2022-09-01"
+)
+
+// APIProfile defines the API Versions used for the Resource Manager operations the Dalek depends on, and the
+// Resource Types which are available - since Azure Stack Hub only supports older API Versions of a subset of
+// the services available in Azure.
+type APIProfile struct {
+	// Name is the name of this APIProfile, e.g. `2020-09-01-hybrid`
+	Name string
+
+	// LocksAPIVersion, when set, is the API Version used for Management Lock operations
+	LocksAPIVersion string
+
+	// ResourcesAPIVersion, when set, is the API Version used for Resource Group (and Resource) operations
+	ResourcesAPIVersion string
+
+	// SubscriptionsAPIVersion, when set, is the API Version used to retrieve the details of the Subscription
+	SubscriptionsAPIVersion string
+
+	// ResourceTypes are the Resource Types available using this APIProfile, where an entry can either be a
+	// Resource Provider (e.g. `Microsoft.Compute`, matching all of its Resource Types) or a specific Resource
+	// Type (e.g. `Microsoft.KeyVault/vaults`) - when empty every Resource Type is available.
+	ResourceTypes []string
+}
+
+// Supports returns whether the specified Resource Type (e.g. `Microsoft.NetApp/netAppAccounts`) is available
+// using this APIProfile - which is compared case-insensitively.
+func (p APIProfile) Supports(resourceType string) bool {
+	if len(p.ResourceTypes) == 0 {
+		return true
+	}
+
+	for _, v := range p.ResourceTypes {
+		if strings.EqualFold(v, resourceType) || strings.HasPrefix(strings.ToLower(resourceType), strings.ToLower(v)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsResourceGraph returns whether Resource Graph is available using this APIProfile
+func (p APIProfile) SupportsResourceGraph() bool {
+	return p.Supports("Microsoft.ResourceGraph/resources")
+}
+
+// ProfileLatest uses the API Versions of the vendored SDK packages, and supports every Resource Type
+var ProfileLatest = APIProfile{
+	Name: "latest",
+}
+
+// ProfileAzureStackHub uses the API Versions from the `2020-09-01-hybrid` profile supported by Azure Stack Hub,
+// which only offers a subset of the Resource Providers available in Azure - notably Resource Graph isn't
+// available, so the resources within the Subscription are listed using the Resources API instead.
+var ProfileAzureStackHub = APIProfile{
+	Name:                    "2020-09-01-hybrid",
+	LocksAPIVersion:         "2016-09-01",
+	ResourcesAPIVersion:     "2019-10-01",
+	SubscriptionsAPIVersion: "2016-06-01",
+	ResourceTypes: []string{
+		"Microsoft.Authorization",
+		"Microsoft.Compute",
+		"Microsoft.ContainerRegistry",
+		"Microsoft.EventHub",
+		"Microsoft.Insights",
+		"Microsoft.KeyVault/vaults",
+		"Microsoft.Network",
+		"Microsoft.Resources",
+		"Microsoft.Storage",
+		"Microsoft.Web",
+	},
+}
+
+// isAzureStack returns whether the Environment with the specified name is an Azure Stack Hub environment
+func isAzureStack(environmentName string) bool {
+	return strings.Contains(strings.ToLower(environmentName), "stack")
+}
+
+// profileForEnvironment returns the APIProfile to use for the specified Environment
+func profileForEnvironment(environment environments.Environment) APIProfile {
+	if isAzureStack(environment.Name) {
+		return ProfileAzureStackHub
+	}
+	return ProfileLatest
+}
+
+// pinAPIVersion returns a Request Middleware which replaces the API Version `from` (used by a vendored SDK
+// package) with `to` - requests using any other API Version (e.g. when polling a long-running operation) are
+// sent as-is. This must run before the request is rewritten by any other Request Middleware.
+func pinAPIVersion(from, to string) client.RequestMiddleware {
+	return func(req *http.Request) (*http.Request, error) {
+		query := req.URL.Query()
+		if to == "" || query.Get("api-version") != from {
+			return req, nil
+		}
+
+		query.Set("api-version", to)
+		req.URL.RawQuery = query.Encode()
+		return req, nil
+	}
+}
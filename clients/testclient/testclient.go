@@ -0,0 +1,61 @@
+package testclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/sdk/auth"
+	"github.com/hashicorp/go-azure-sdk/sdk/environments"
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"golang.org/x/oauth2"
+)
+
+// SubscriptionID is the Subscription ID used by the AzureClient returned from New
+const SubscriptionID = "00000000-0000-0000-0000-000000000000"
+
+var _ auth.Authorizer = staticAuthorizer{}
+
+// staticAuthorizer returns a fixed token, so that tests don't need to authenticate
+type staticAuthorizer struct{}
+
+func (staticAuthorizer) Token(_ context.Context, _ *http.Request) (*oauth2.Token, error) {
+	return &oauth2.Token{
+		AccessToken: "dalek-test-token",
+		TokenType:   "Bearer",
+	}, nil
+}
+
+func (staticAuthorizer) AuxiliaryTokens(_ context.Context, _ *http.Request) ([]*oauth2.Token, error) {
+	return nil, nil
+}
+
+// New returns an AzureClient for Azure Public which sends every request using `transport`
+func New(t testing.TB, transport http.RoundTripper) *clients.AzureClient {
+	t.Helper()
+
+	return NewForProfile(t, transport, clients.ProfileLatest)
+}
+
+// NewForProfile returns an AzureClient using the specified APIProfile which sends every request using `transport`
+func NewForProfile(t testing.TB, transport http.RoundTripper, profile clients.APIProfile) *clients.AzureClient {
+	t.Helper()
+
+	authorizers := clients.Authorizers{
+		MicrosoftGraph:  staticAuthorizer{},
+		ResourceManager: staticAuthorizer{},
+	}
+	clientOpts := clients.ClientOptions{
+		APIProfile: &profile,
+		Guard:      gateway.Guard,
+		Transport:  transport,
+	}
+	client, err := clients.NewAzureClient(*environments.AzurePublic(), authorizers, SubscriptionID, clientOpts)
+	if err != nil {
+		t.Fatalf("building the Azure Client: %+v", err)
+	}
+	t.Cleanup(client.Close)
+
+	return client
+}
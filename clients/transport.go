@@ -0,0 +1,132 @@
+package clients
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-azure-sdk/sdk/client"
+)
+
+const (
+	// originalUrlHeader is used to pass the original URL of a request through the loopback server
+	originalUrlHeader = "X-Dalek-Original-Url"
+
+	// loopbackTokenHeader contains a token which is generated for each loopback server, so that it only
+	// forwards requests sent by the Request Middleware, rather than by anything else on this machine
+	loopbackTokenHeader = "X-Dalek-Loopback-Token"
+)
+
+// routeThroughTransport returns a Request Middleware which sends each request using `transport`.
+//
+// The SDK creates a new HTTP Transport for each request (so we can't replace it directly) - instead we
+// start a loopback server which sends each request it receives using `transport`, and the Request
+// Middleware rewrites each request to go via the loopback server. The loopback server only forwards
+// requests which include its token, and only to `allowedHosts`. The returned func stops the loopback server.
+func routeThroughTransport(transport http.RoundTripper, allowedHosts []string) (client.RequestMiddleware, func(), error) {
+	token, err := loopbackToken()
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating a token for the loopback server: %+v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, fmt.Errorf("listening on a loopback address: %+v", err)
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get(loopbackTokenHeader)), []byte(token)) != 1 {
+				http.Error(w, "the loopback token was missing or invalid", http.StatusForbidden)
+				return
+			}
+
+			originalUrl, err := url.Parse(r.Header.Get(originalUrlHeader))
+			if err != nil || originalUrl.Host == "" {
+				http.Error(w, fmt.Sprintf("parsing the original url %q: %+v", r.Header.Get(originalUrlHeader), err), http.StatusBadGateway)
+				return
+			}
+			if !hostAllowed(originalUrl.Host, allowedHosts) {
+				http.Error(w, fmt.Sprintf("refusing to forward a request to %q since it isn't a Resource Manager or Microsoft Graph host", originalUrl.Host), http.StatusForbidden)
+				return
+			}
+
+			req := r.Clone(r.Context())
+			req.RequestURI = ""
+			req.URL = originalUrl
+			req.Host = originalUrl.Host
+			req.Header.Del(originalUrlHeader)
+			req.Header.Del(loopbackTokenHeader)
+
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				// hijacking the connection allows the SDK to see this as a dropped connection, rather than an HTTP error
+				if hijacker, ok := w.(http.Hijacker); ok {
+					if conn, _, err := hijacker.Hijack(); err == nil {
+						conn.Close()
+						return
+					}
+				}
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+
+			for k, values := range resp.Header {
+				for _, v := range values {
+					w.Header().Add(k, v)
+				}
+			}
+			w.WriteHeader(resp.StatusCode)
+			_, _ = io.Copy(w, resp.Body)
+		}),
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	serverHost := listener.Addr().String()
+	middleware := func(req *http.Request) (*http.Request, error) {
+		// requests for subsequent pages/retries may already have been rewritten
+		if req.URL.Host != serverHost {
+			req.Header.Set(originalUrlHeader, req.URL.String())
+		}
+		req.Header.Set(loopbackTokenHeader, token)
+
+		u := *req.URL
+		u.Scheme = "http"
+		u.Host = serverHost
+		req.URL = &u
+		req.Host = serverHost
+		return req, nil
+	}
+
+	closer := func() {
+		_ = server.Close()
+	}
+	return middleware, closer, nil
+}
+
+// loopbackToken returns a random token used to authenticate requests sent to the loopback server
+func loopbackToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hostAllowed(host string, allowedHosts []string) bool {
+	for _, allowed := range allowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package clients
+
+import (
+	"net/http"
+	"testing"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRouteThroughTransport(t *testing.T) {
+	forwarded := make([]string, 0)
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get(loopbackTokenHeader) != "" {
+			t.Errorf("expected the loopback token to be removed before forwarding %s", req.URL)
+		}
+		forwarded = append(forwarded, req.URL.String())
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+		}, nil
+	})
+
+	middleware, closer, err := routeThroughTransport(transport, []string{"management.azure.com"})
+	if err != nil {
+		t.Fatalf("routing through the transport: %+v", err)
+	}
+	defer closer()
+
+	testData := []struct {
+		name           string
+		url            string
+		withoutToken   bool
+		expectedStatus int
+	}{
+		{
+			name:           "allowed host",
+			url:            "https://management.azure.com/subscriptions",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "allowed host in a different case",
+			url:            "https://Management.Azure.com/subscriptions",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "other host",
+			url:            "https://example.com/",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "missing token",
+			url:            "https://management.azure.com/subscriptions",
+			withoutToken:   true,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, v.url, nil)
+			if err != nil {
+				t.Fatalf("building the request: %+v", err)
+			}
+			req, err = middleware(req)
+			if err != nil {
+				t.Fatalf("running the middleware: %+v", err)
+			}
+			if v.withoutToken {
+				req.Header.Del(loopbackTokenHeader)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("sending the request: %+v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != v.expectedStatus {
+				t.Fatalf("expected status %d but got %d", v.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	if len(forwarded) != 2 {
+		t.Fatalf("expected 2 requests to be forwarded but got %d: %v", len(forwarded), forwarded)
+	}
+}
@@ -0,0 +1,144 @@
+package transports
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Cassette is a sanitized recording of the requests sent (and responses received) during a run, which
+// can be replayed using a Replayer
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single request and the response which was received for it
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method string `json:"method"`
+
+	// URL is the full URL of the request, including the query string
+	URL string `json:"url"`
+
+	// Body is the request body, when it's JSON
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	// StatusCode is the status code which was returned, defaulting to 200
+	StatusCode int `json:"status"`
+
+	// Headers are the response headers which are needed for polling, other headers aren't recorded
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body is the response body, when it's JSON
+	Body json.RawMessage `json:"body,omitempty"`
+
+	// RawBody is the response body, when it isn't JSON
+	RawBody string `json:"rawBody,omitempty"`
+}
+
+// recordedResponseHeaders are the response headers which are recorded, since the SDK uses these to poll
+var recordedResponseHeaders = []string{
+	"Azure-AsyncOperation",
+	"Content-Type",
+	"Location",
+	"Retry-After",
+}
+
+// LoadCassette loads the Cassette saved at `path`
+func LoadCassette(path string) (*Cassette, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %+v", path, err)
+	}
+
+	var cassette Cassette
+	if err := json.Unmarshal(contents, &cassette); err != nil {
+		return nil, fmt.Errorf("parsing %q: %+v", path, err)
+	}
+	return &cassette, nil
+}
+
+// Save writes the Cassette to `path` as indented JSON
+func (c Cassette) Save(path string) error {
+	contents, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("serializing the cassette: %+v", err)
+	}
+	if err := os.WriteFile(path, append(contents, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing %q: %+v", path, err)
+	}
+	return nil
+}
+
+// zeroSubscriptionId replaces any recorded Subscription ID, so that Cassettes can be replayed against any Subscription
+const zeroSubscriptionId = "00000000-0000-0000-0000-000000000000"
+
+const redacted = "redacted"
+
+var (
+	subscriptionIdInPath   = regexp.MustCompile(`(?i)(/subscriptions/)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	identifiersInBody      = regexp.MustCompile(`(?i)("(?:subscriptionId|tenantId)"\s*:\s*")[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}(")`)
+	tokensInBody           = regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|client_secret)"\s*:\s*")[^"]*(")`)
+	signaturesInQueryParam = regexp.MustCompile(`(?i)([?&](?:sig|skoid|sktid)=)[^&"]+`)
+)
+
+// Sanitizer removes tokens, Subscription IDs and any other secrets from the requests and responses
+// before they're written to a Cassette
+type Sanitizer struct {
+	// SubscriptionIDs are replaced with the zero UUID wherever they appear - Subscription IDs which appear
+	// within a Resource ID (or a `subscriptionId` field) are replaced regardless.
+	SubscriptionIDs []string
+
+	// Secrets are replaced with `redacted` wherever they appear, e.g. the Tenant ID or Client ID
+	Secrets []string
+}
+
+// Sanitize returns `input` with each of the sensitive values replaced
+func (s Sanitizer) Sanitize(input string) string {
+	out := input
+	for _, subscriptionId := range s.SubscriptionIDs {
+		if subscriptionId != "" {
+			out = replaceInsensitively(out, subscriptionId, zeroSubscriptionId)
+		}
+	}
+	for _, secret := range s.Secrets {
+		if secret != "" {
+			out = replaceInsensitively(out, secret, redacted)
+		}
+	}
+
+	out = subscriptionIdInPath.ReplaceAllString(out, "${1}"+zeroSubscriptionId)
+	out = identifiersInBody.ReplaceAllString(out, "${1}"+zeroSubscriptionId+"${2}")
+	out = tokensInBody.ReplaceAllString(out, "${1}"+redacted+"${2}")
+	out = signaturesInQueryParam.ReplaceAllString(out, "${1}"+redacted)
+	return out
+}
+
+func replaceInsensitively(input, old, replacement string) string {
+	return regexp.MustCompile(`(?i)`+regexp.QuoteMeta(old)).ReplaceAllLiteralString(input, replacement)
+}
+
+// sanitizeBody returns the sanitized body as JSON when it's valid JSON, otherwise as a raw string
+func (s Sanitizer) sanitizeBody(body []byte) (json.RawMessage, string) {
+	if len(body) == 0 {
+		return nil, ""
+	}
+	sanitized := s.Sanitize(string(body))
+	if json.Valid([]byte(sanitized)) {
+		return json.RawMessage(sanitized), ""
+	}
+	return nil, sanitized
+}
+
+func isLoginHost(host string) bool {
+	host = strings.ToLower(host)
+	return strings.HasPrefix(host, "login.") || strings.Contains(host, ".login.")
+}
@@ -0,0 +1,102 @@
+package transports
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+var _ http.RoundTripper = &CassetteRecorder{}
+
+// CassetteRecorder is an HTTP Transport which sends each request using the inner Transport and records a
+// sanitized copy of the request and response into a Cassette. Request headers (and so any tokens) are
+// never recorded, nor are requests to the login endpoints.
+type CassetteRecorder struct {
+	inner     http.RoundTripper
+	sanitizer Sanitizer
+
+	lock         sync.Mutex
+	interactions []Interaction
+}
+
+func NewCassetteRecorder(inner http.RoundTripper, sanitizer Sanitizer) *CassetteRecorder {
+	return &CassetteRecorder{
+		inner:        inner,
+		sanitizer:    sanitizer,
+		interactions: make([]Interaction, 0),
+	}
+}
+
+func (r *CassetteRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isLoginHost(req.URL.Host) {
+		return r.inner.RoundTrip(req)
+	}
+
+	var requestBody []byte
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading the request body: %+v", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		requestBody = body
+	}
+
+	resp, err := r.inner.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading the response body: %+v", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	interaction := Interaction{
+		Request: CassetteRequest{
+			Method: req.Method,
+			URL:    r.sanitizer.Sanitize(req.URL.String()),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+		},
+	}
+	interaction.Request.Body, _ = r.sanitizer.sanitizeBody(requestBody)
+	interaction.Response.Body, interaction.Response.RawBody = r.sanitizer.sanitizeBody(responseBody)
+	for _, header := range recordedResponseHeaders {
+		if v := resp.Header.Get(header); v != "" {
+			if interaction.Response.Headers == nil {
+				interaction.Response.Headers = make(map[string]string)
+			}
+			interaction.Response.Headers[header] = r.sanitizer.Sanitize(v)
+		}
+	}
+
+	r.lock.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.lock.Unlock()
+
+	return resp, nil
+}
+
+// Cassette returns the Cassette containing each of the Interactions recorded so far
+func (r *CassetteRecorder) Cassette() Cassette {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]Interaction, len(r.interactions))
+	copy(out, r.interactions)
+	return Cassette{
+		Interactions: out,
+	}
+}
+
+// Save writes each of the Interactions recorded so far to a Cassette at `path`
+func (r *CassetteRecorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
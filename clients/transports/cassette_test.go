@@ -0,0 +1,79 @@
+package transports
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	subscriptionId := "11111111-2222-3333-4444-555555555555"
+	otherSubscriptionId := "66666666-7777-8888-9999-000000000000"
+	tenantId := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+
+	inner, err := NewFixtures([]Fixture{
+		{
+			Method: http.MethodGet,
+			Path:   "(?i)/resourceGroups$",
+			Body:   []byte(`{"value": [{"id": "/subscriptions/` + otherSubscriptionId + `/resourceGroups/acctestRG-1", "tenantId": "` + tenantId + `", "access_token": "secret-token"}]}`),
+		},
+	})
+	if err != nil {
+		t.Fatalf("building fixtures: %+v", err)
+	}
+
+	recorder := NewCassetteRecorder(inner, Sanitizer{
+		SubscriptionIDs: []string{subscriptionId},
+		Secrets:         []string{tenantId},
+	})
+	req, _ := http.NewRequest(http.MethodGet, "https://management.azure.com/subscriptions/"+subscriptionId+"/resourceGroups?api-version=2022-09-01", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	if _, err := recorder.RoundTrip(req); err != nil {
+		t.Fatalf("sending request: %+v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("saving cassette: %+v", err)
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("loading cassette: %+v", err)
+	}
+	if len(cassette.Interactions) != 1 {
+		t.Fatalf("expected 1 interaction but got %d", len(cassette.Interactions))
+	}
+
+	recorded := cassette.Interactions[0]
+	contents := recorded.Request.URL + string(recorded.Response.Body)
+	for _, secret := range []string{subscriptionId, otherSubscriptionId, tenantId, "secret-token"} {
+		if strings.Contains(contents, secret) {
+			t.Errorf("expected %q to be removed from the cassette but got %s", secret, contents)
+		}
+	}
+
+	replayer := NewReplayer(*cassette)
+	replayed, _ := http.NewRequest(http.MethodGet, "https://management.azure.com/subscriptions/"+zeroSubscriptionId+"/resourceGroups?api-version=2022-09-01", nil)
+	resp, err := replayer.RoundTrip(replayed)
+	if err != nil {
+		t.Fatalf("replaying request: %+v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "acctestRG-1") {
+		t.Fatalf("expected the recorded response but got %d: %s", resp.StatusCode, body)
+	}
+
+	// each interaction is only replayed once
+	resp, err = replayer.RoundTrip(replayed)
+	if err != nil {
+		t.Fatalf("replaying request: %+v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a 400 for an unmatched request but got %d", resp.StatusCode)
+	}
+	if len(replayer.Unmatched()) != 1 || len(replayer.Unused()) != 0 {
+		t.Fatalf("expected 1 unmatched request and 0 unused interactions but got %d and %d", len(replayer.Unmatched()), len(replayer.Unused()))
+	}
+}
@@ -0,0 +1,171 @@
+package transports
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ http.RoundTripper = &FaultInjector{}
+
+type FaultType string
+
+const (
+	// FaultTypeStatusCode returns StatusCode (with an Azure Resource Manager error body) rather than sending the request
+	FaultTypeStatusCode FaultType = "StatusCode"
+
+	// FaultTypeDroppedConnection drops the connection rather than sending the request
+	FaultTypeDroppedConnection FaultType = "DroppedConnection"
+
+	// FaultTypeDelay waits for Delay before sending the request, e.g. to simulate a slow long-running operation
+	FaultTypeDelay FaultType = "Delay"
+
+	// FaultTypeBody sends the request, but replaces the body of the response with Body - e.g. to return a malformed body
+	FaultTypeBody FaultType = "Body"
+)
+
+// Fault is a failure which is injected into requests matching Method and Path
+type Fault struct {
+	Type FaultType
+
+	// Method is the HTTP Method to match, when empty any method is matched
+	Method string
+
+	// Path is a regular expression matched against the path of the request
+	Path string
+
+	// Times is the number of matching requests to inject this Fault into, when 0 it's injected into every matching request
+	Times int
+
+	// StatusCode is the status code returned when Type is FaultTypeStatusCode
+	StatusCode int
+
+	// Delay is how long to wait when Type is FaultTypeDelay
+	Delay time.Duration
+
+	// Body is the response body returned when Type is FaultTypeBody
+	Body string
+
+	path *regexp.Regexp
+}
+
+// FaultInjector is an HTTP Transport which injects Faults into matching requests, sending all other requests
+// using the inner Transport - allowing the error handling within each cleaner to be tested.
+type FaultInjector struct {
+	inner http.RoundTripper
+
+	lock      sync.Mutex
+	faults    []Fault
+	remaining []int
+	injected  []InjectedFault
+}
+
+// InjectedFault is a request which had a Fault injected into it
+type InjectedFault struct {
+	RecordedRequest
+	Type FaultType
+}
+
+func NewFaultInjector(inner http.RoundTripper, faults ...Fault) (*FaultInjector, error) {
+	out := make([]Fault, 0, len(faults))
+	remaining := make([]int, 0, len(faults))
+	for _, fault := range faults {
+		path, err := regexp.Compile(fault.Path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing the path %q: %+v", fault.Path, err)
+		}
+		fault.path = path
+		out = append(out, fault)
+		remaining = append(remaining, fault.Times)
+	}
+	return &FaultInjector{
+		inner:     inner,
+		faults:    out,
+		remaining: remaining,
+		injected:  make([]InjectedFault, 0),
+	}, nil
+}
+
+func (f *FaultInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault := f.faultFor(req)
+	if fault == nil {
+		return f.inner.RoundTrip(req)
+	}
+
+	switch fault.Type {
+	case FaultTypeStatusCode:
+		body := fmt.Sprintf(`{"error": {"code": "InjectedFault", "message": "injected a %d for %s %s"}}`, fault.StatusCode, req.Method, req.URL.Path)
+		resp := jsonResponse(req, fault.StatusCode, []byte(body))
+		// so that the SDK retries immediately, rather than backing off
+		resp.Header.Set("Retry-After", "0")
+		return resp, nil
+
+	case FaultTypeDroppedConnection:
+		return nil, fmt.Errorf("injected a dropped connection for %s %s", req.Method, req.URL.Path)
+
+	case FaultTypeDelay:
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(fault.Delay):
+		}
+		return f.inner.RoundTrip(req)
+
+	case FaultTypeBody:
+		resp, err := f.inner.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader([]byte(fault.Body)))
+		resp.ContentLength = int64(len(fault.Body))
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("unsupported fault type %q", fault.Type)
+}
+
+// Injected returns each of the requests which had a Fault injected into them
+func (f *FaultInjector) Injected() []InjectedFault {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	out := make([]InjectedFault, len(f.injected))
+	copy(out, f.injected)
+	return out
+}
+
+func (f *FaultInjector) faultFor(req *http.Request) *Fault {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for i, fault := range f.faults {
+		if fault.Method != "" && !strings.EqualFold(fault.Method, req.Method) {
+			continue
+		}
+		if !fault.path.MatchString(req.URL.Path) {
+			continue
+		}
+		if fault.Times > 0 {
+			if f.remaining[i] == 0 {
+				continue
+			}
+			f.remaining[i]--
+		}
+
+		f.injected = append(f.injected, InjectedFault{
+			RecordedRequest: RecordedRequest{
+				Method: req.Method,
+				URL:    req.URL.String(),
+			},
+			Type: fault.Type,
+		})
+		return &f.faults[i]
+	}
+	return nil
+}
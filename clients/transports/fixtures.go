@@ -0,0 +1,119 @@
+package transports
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var _ http.RoundTripper = Fixtures{}
+
+// Fixture is a canned response returned for any request matching Method and Path
+type Fixture struct {
+	// Method is the HTTP Method to match, when empty any method is matched
+	Method string `json:"method"`
+
+	// Path is a regular expression matched against the path of the request
+	Path string `json:"path"`
+
+	// StatusCode is the status code to return, defaulting to 200
+	StatusCode int `json:"status"`
+
+	// Body is the JSON body to return
+	Body json.RawMessage `json:"body"`
+
+	path *regexp.Regexp
+}
+
+// Fixtures is an HTTP Transport which serves canned responses from a list of Fixtures, the first matching
+// Fixture is used. Requests which don't match a Fixture get an empty list (or empty Resource Graph result).
+type Fixtures struct {
+	fixtures []Fixture
+}
+
+// LoadFixtures loads the Fixtures defined in each `*.json` file within the specified directory
+func LoadFixtures(directory string) (*Fixtures, error) {
+	files, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("finding fixtures within %q: %+v", directory, err)
+	}
+	sort.Strings(files)
+
+	fixtures := make([]Fixture, 0)
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %+v", file, err)
+		}
+		var items []Fixture
+		if err := json.Unmarshal(contents, &items); err != nil {
+			return nil, fmt.Errorf("parsing %q: %+v", file, err)
+		}
+		fixtures = append(fixtures, items...)
+	}
+
+	return NewFixtures(fixtures)
+}
+
+func NewFixtures(fixtures []Fixture) (*Fixtures, error) {
+	out := make([]Fixture, 0, len(fixtures))
+	for _, fixture := range fixtures {
+		path, err := regexp.Compile(fixture.Path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing the path %q: %+v", fixture.Path, err)
+		}
+		fixture.path = path
+		out = append(out, fixture)
+	}
+	return &Fixtures{
+		fixtures: out,
+	}, nil
+}
+
+func (f Fixtures) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, fixture := range f.fixtures {
+		if fixture.Method != "" && !strings.EqualFold(fixture.Method, req.Method) {
+			continue
+		}
+		if !fixture.path.MatchString(req.URL.Path) {
+			continue
+		}
+
+		statusCode := fixture.StatusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		return jsonResponse(req, statusCode, fixture.Body), nil
+	}
+
+	if req.Method == http.MethodPost && isResourceGraphQuery(req.URL.Path) {
+		return jsonResponse(req, http.StatusOK, []byte(`{"count": 0, "data": [], "totalRecords": 0, "resultTruncated": "false"}`)), nil
+	}
+	if req.Method == http.MethodGet {
+		return jsonResponse(req, http.StatusOK, []byte(`{"value": []}`)), nil
+	}
+	return jsonResponse(req, http.StatusOK, []byte(`{}`)), nil
+}
+
+func jsonResponse(req *http.Request, statusCode int, body []byte) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode: statusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type": []string{"application/json; charset=utf-8"},
+		},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
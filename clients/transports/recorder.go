@@ -0,0 +1,74 @@
+package transports
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var _ http.RoundTripper = &Recorder{}
+
+// RecordedRequest is a request which was sent through a Recorder
+type RecordedRequest struct {
+	Method string
+	URL    string
+}
+
+// Recorder is an HTTP Transport which records each request before sending it using the inner Transport
+type Recorder struct {
+	inner http.RoundTripper
+
+	lock     sync.Mutex
+	requests []RecordedRequest
+}
+
+func NewRecorder(inner http.RoundTripper) *Recorder {
+	return &Recorder{
+		inner:    inner,
+		requests: make([]RecordedRequest, 0),
+	}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.lock.Lock()
+	r.requests = append(r.requests, RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+	})
+	r.lock.Unlock()
+
+	return r.inner.RoundTrip(req)
+}
+
+// Requests returns each of the requests sent through this Recorder
+func (r *Recorder) Requests() []RecordedRequest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]RecordedRequest, len(r.requests))
+	copy(out, r.requests)
+	return out
+}
+
+// MutatingRequests returns each PUT, PATCH, POST or DELETE request sent through this Recorder, excluding
+// Resource Graph queries (which are a POST, but read-only).
+func (r *Recorder) MutatingRequests() []RecordedRequest {
+	out := make([]RecordedRequest, 0)
+	for _, req := range r.Requests() {
+		switch req.Method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			out = append(out, req)
+
+		case http.MethodPost:
+			if !isResourceGraphQuery(req.URL) {
+				out = append(out, req)
+			}
+		}
+	}
+	return out
+}
+
+func isResourceGraphQuery(uri string) bool {
+	path := strings.SplitN(uri, "?", 2)[0]
+	return strings.HasSuffix(strings.ToLower(path), "/providers/microsoft.resourcegraph/resources")
+}
@@ -0,0 +1,138 @@
+package transports
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var _ http.RoundTripper = &Replayer{}
+
+// Replayer is an HTTP Transport which serves the responses from a Cassette, so that a run can be repeated
+// without network access. Each request is matched to the first unused Interaction with the same method,
+// path and query string - since Interactions are used in order, a resource can be listed, deleted and then
+// polled until it's gone.
+type Replayer struct {
+	lock         sync.Mutex
+	interactions []Interaction
+	used         []bool
+	unmatched    []RecordedRequest
+}
+
+func NewReplayer(cassette Cassette) *Replayer {
+	return &Replayer{
+		interactions: cassette.Interactions,
+		used:         make([]bool, len(cassette.Interactions)),
+		unmatched:    make([]RecordedRequest, 0),
+	}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, interaction := range r.interactions {
+		if r.used[i] || !interactionMatches(interaction.Request, req) {
+			continue
+		}
+		r.used[i] = true
+		return replayResponse(req, interaction.Response), nil
+	}
+
+	r.unmatched = append(r.unmatched, RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+	})
+
+	// a 400 isn't retried by the SDK, so the cleaner fails fast rather than retrying a request which can't succeed
+	body := fmt.Sprintf(`{"error": {"code": "NoMatchingInteraction", "message": "no unused interaction in the cassette matches %s %s"}}`, req.Method, req.URL.Path)
+	return jsonResponse(req, http.StatusBadRequest, []byte(body)), nil
+}
+
+// Unmatched returns each of the requests which didn't match an Interaction in the Cassette
+func (r *Replayer) Unmatched() []RecordedRequest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]RecordedRequest, len(r.unmatched))
+	copy(out, r.unmatched)
+	return out
+}
+
+// Unused returns each of the Interactions in the Cassette which haven't been replayed
+func (r *Replayer) Unused() []Interaction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]Interaction, 0)
+	for i, interaction := range r.interactions {
+		if !r.used[i] {
+			out = append(out, interaction)
+		}
+	}
+	return out
+}
+
+func interactionMatches(recorded CassetteRequest, req *http.Request) bool {
+	if !strings.EqualFold(recorded.Method, req.Method) {
+		return false
+	}
+
+	recordedUrl, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(strings.TrimSuffix(recordedUrl.Path, "/"), strings.TrimSuffix(req.URL.Path, "/")) {
+		return false
+	}
+
+	recordedQuery := recordedUrl.Query()
+	query := req.URL.Query()
+	if len(recordedQuery) != len(query) {
+		return false
+	}
+	for k := range recordedQuery {
+		if recordedQuery.Get(k) != query.Get(k) {
+			return false
+		}
+	}
+	return true
+}
+
+func replayResponse(req *http.Request, recorded CassetteResponse) *http.Response {
+	statusCode := recorded.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	body := []byte(recorded.Body)
+	if len(body) == 0 {
+		body = []byte(recorded.RawBody)
+	}
+
+	header := http.Header{}
+	for k, v := range recorded.Headers {
+		header.Set(k, v)
+	}
+	if header.Get("Content-Type") == "" && len(recorded.Body) > 0 {
+		header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	// there's nothing to wait for when replaying, so any polling happens immediately
+	header.Set("Retry-After", "0")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
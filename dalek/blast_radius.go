@@ -0,0 +1,27 @@
+package dalek
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/cleaners"
+)
+
+// checkBlastRadius works out which Resource Groups would be deleted and refuses to continue when this
+// exceeds the configured limits - this must be called prior to running any cleaners.
+func (d *Dalek) checkBlastRadius(ctx context.Context, subscriptionId commonids.SubscriptionId) error {
+	candidates, err := cleaners.FindResourceGroupsToDelete(ctx, d.cleanup, subscriptionId)
+	if err != nil {
+		return fmt.Errorf("finding the Resource Groups to delete: %+v", err)
+	}
+
+	radius := cleaners.BlastRadius{
+		Description:         "Resource Groups",
+		Count:               len(candidates.ResourceGroups),
+		ResourceGroups:      len(candidates.ResourceGroups),
+		TotalResourceGroups: candidates.TotalResourceGroups,
+	}
+	d.logger.Printf("[DEBUG] %d of %d Resource Groups (%.1f%%) in %s match the filters", radius.ResourceGroups, radius.TotalResourceGroups, radius.Percentage(), subscriptionId)
+	return cleaners.CheckBlastRadius(d.cleanup, radius)
+}
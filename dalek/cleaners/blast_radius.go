@@ -0,0 +1,57 @@
+package cleaners
+
+import (
+	"fmt"
+)
+
+// BlastRadius describes how much of a Subscription would be deleted, which is checked against the limits in the
+// Options before anything is deleted
+type BlastRadius struct {
+	// Description describes the items being deleted, e.g. `Resource Groups`
+	Description string
+
+	// Count is the number of items which would be deleted
+	Count int
+
+	// ResourceGroups is the number of Resource Groups which would be deleted (or have resources deleted from them)
+	ResourceGroups int
+
+	// TotalResourceGroups is the total number of Resource Groups within the Subscription
+	TotalResourceGroups int
+}
+
+// Percentage returns the percentage of the Resource Groups within the Subscription which would be affected
+func (b BlastRadius) Percentage() float64 {
+	if b.TotalResourceGroups == 0 {
+		return 0
+	}
+	return float64(b.ResourceGroups) / float64(b.TotalResourceGroups) * 100
+}
+
+// CheckBlastRadius refuses to continue when the BlastRadius exceeds the limits in the Options - unless these have
+// been overridden for this run, or this is a dry-run, in which case a warning is logged instead.
+func CheckBlastRadius(cc *CleanupContext, radius BlastRadius) error {
+	limits := cc.Options.BlastRadius
+	percentage := radius.Percentage()
+
+	var exceeded error
+	if limits.MaxResourceGroups > 0 && radius.Count > limits.MaxResourceGroups {
+		exceeded = fmt.Errorf("%d %s would be deleted, which is more than the limit of %d", radius.Count, radius.Description, limits.MaxResourceGroups)
+	} else if limits.MaxPercentage > 0 && percentage > limits.MaxPercentage {
+		exceeded = fmt.Errorf("%.1f%% of the Resource Groups (%d of %d) would be affected, which is more than the limit of %.0f%%", percentage, radius.ResourceGroups, radius.TotalResourceGroups, limits.MaxPercentage)
+	}
+	if exceeded == nil {
+		return nil
+	}
+
+	if limits.Override {
+		cc.Logger.Printf("[WARN] %s - continuing since `--override-blast-radius` was specified", exceeded)
+		return nil
+	}
+	if !cc.Options.ActuallyDelete {
+		cc.Logger.Printf("[WARN] %s - this run would be aborted if `YES_I_REALLY_WANT_TO_DELETE_THINGS` was set", exceeded)
+		return nil
+	}
+
+	return fmt.Errorf("%s - refusing to run, check the filters or use `--override-blast-radius` to override this for a single run", exceeded)
+}
@@ -0,0 +1,104 @@
+package cleaners
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+func TestCheckBlastRadius(t *testing.T) {
+	testData := []struct {
+		name           string
+		radius         BlastRadius
+		limits         options.BlastRadius
+		actuallyDelete bool
+		expectError    bool
+	}{
+		{
+			name:           "within the limits",
+			radius:         BlastRadius{Count: 2, ResourceGroups: 2, TotalResourceGroups: 10},
+			limits:         options.BlastRadius{MaxResourceGroups: 2, MaxPercentage: 20},
+			actuallyDelete: true,
+		},
+		{
+			name:           "too many items",
+			radius:         BlastRadius{Count: 3, ResourceGroups: 1, TotalResourceGroups: 10},
+			limits:         options.BlastRadius{MaxResourceGroups: 2},
+			actuallyDelete: true,
+			expectError:    true,
+		},
+		{
+			name:           "too high a percentage",
+			radius:         BlastRadius{Count: 3, ResourceGroups: 3, TotalResourceGroups: 10},
+			limits:         options.BlastRadius{MaxPercentage: 20},
+			actuallyDelete: true,
+			expectError:    true,
+		},
+		{
+			name:           "overridden",
+			radius:         BlastRadius{Count: 3, ResourceGroups: 3, TotalResourceGroups: 10},
+			limits:         options.BlastRadius{MaxResourceGroups: 2, Override: true},
+			actuallyDelete: true,
+		},
+		{
+			name:   "dry-run",
+			radius: BlastRadius{Count: 3, ResourceGroups: 3, TotalResourceGroups: 10},
+			limits: options.BlastRadius{MaxResourceGroups: 2},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			opts := options.Options{
+				ActuallyDelete: v.actuallyDelete,
+				BlastRadius:    v.limits,
+				Prefix:         "acctest",
+			}
+			cc := newCleanupContext(testclient.New(t, transports.NewReplayer(transports.Cassette{})), report.New(), opts)
+			err := CheckBlastRadius(cc, v.radius)
+			if v.expectError != (err != nil) {
+				t.Fatalf("expected an error %t but got: %+v", v.expectError, err)
+			}
+		})
+	}
+}
+
+func TestDeleteExpiredChecksBlastRadius(t *testing.T) {
+	cassette, err := transports.LoadCassette(filepath.Join("testdata", "cassettes", "expired.json"))
+	if err != nil {
+		t.Fatalf("loading cassette: %+v", err)
+	}
+	client := testclient.New(t, transports.NewReplayer(*cassette))
+	r := report.New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// one Resource Group and one resource have expired, which together exceed the limit
+	opts := options.Options{
+		ActuallyDelete: true,
+		BlastRadius: options.BlastRadius{
+			MaxResourceGroups: 1,
+		},
+		Prefix: "acctest",
+		Expiry: options.Expiry{
+			Enabled: true,
+			Tag:     options.DefaultExpiryTag,
+		},
+	}
+	cleaner := deleteExpiredInSubscriptionCleaner{}
+	if err := cleaner.Cleanup(ctx, commonids.NewSubscriptionID(testclient.SubscriptionID), newCleanupContext(client, r, opts)); err == nil {
+		t.Fatalf("expected the blast radius to be exceeded but got no error")
+	}
+	for _, action := range r.Actions() {
+		if action.Outcome == report.OutcomeSucceeded {
+			t.Errorf("expected nothing to be deleted but %q was", action.Target)
+		}
+	}
+}
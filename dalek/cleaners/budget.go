@@ -0,0 +1,166 @@
+package cleaners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// ErrBudgetExceeded is returned from RunWithinBudget when `fn` doesn't complete within its budget
+var ErrBudgetExceeded = errors.New("the time budget was exceeded")
+
+// ErrStillRunning is returned from RunWithinBudget (along with ErrBudgetExceeded) when `fn` is still running
+// once the grace period after the budget was exceeded has elapsed
+var ErrStillRunning = errors.New("still running after being cancelled")
+
+// budgetGracePeriod is how long to wait for `fn` to return once its budget has been exceeded (and its context
+// cancelled) - this is a variable so that tests don't need to wait
+var budgetGracePeriod = 30 * time.Second
+
+// errBudgetElapsed is the cause of the context passed to `fn` being cancelled once its budget has elapsed
+var errBudgetElapsed = errors.New("the budget has elapsed")
+
+// RunWithinBudget runs `fn` using a context which is cancelled once `budget` has elapsed, a budget of 0
+// means there's no budget. The budget is paused whilst the Gateway waits for a mutation to be confirmed. When the budget is exceeded this returns ErrBudgetExceeded once `fn` has returned
+// - or, when `fn` ignores the cancellation and is still running after the grace period, ErrStillRunning too
+// so that the caller can move on without it.
+//
+// When the parent context is cancelled (e.g. the overall deadline is reached) that error is returned
+// instead, since this isn't an overrun of this budget.
+func RunWithinBudget(ctx context.Context, budget time.Duration, fn func(ctx context.Context) error) error {
+	if budget <= 0 {
+		return fn(ctx)
+	}
+
+	budgetCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timer := newBudgetTimer(budget, func() {
+		cancel(errBudgetElapsed)
+	})
+	defer timer.stop()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(gateway.WithBudgetPauser(budgetCtx, timer.pause))
+	}()
+
+	// an error caused by the budget being exceeded is reported as an overrun, rather than a failure
+	result := func(err error) error {
+		if err != nil && ctx.Err() == nil && errors.Is(context.Cause(budgetCtx), errBudgetElapsed) {
+			return ErrBudgetExceeded
+		}
+		return err
+	}
+
+	select {
+	case err := <-done:
+		return result(err)
+
+	case <-budgetCtx.Done():
+		// prefer the result when `fn` completed at the same time as the budget elapsed
+		select {
+		case err := <-done:
+			return result(err)
+		default:
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		select {
+		case <-done:
+			return ErrBudgetExceeded
+		case <-time.After(budgetGracePeriod):
+			return fmt.Errorf("%w: %w", ErrBudgetExceeded, ErrStillRunning)
+		}
+	}
+}
+
+// budgetTimer calls `elapsed` once the budget has elapsed, excluding any time spent paused
+type budgetTimer struct {
+	lock      sync.Mutex
+	timer     *time.Timer
+	remaining time.Duration
+	resumedAt time.Time
+	pauses    int
+	stopped   bool
+}
+
+func newBudgetTimer(budget time.Duration, elapsed func()) *budgetTimer {
+	return &budgetTimer{
+		timer:     time.AfterFunc(budget, elapsed),
+		remaining: budget,
+		resumedAt: time.Now(),
+	}
+}
+
+// pause pauses the budget until the returned func is called - pauses can overlap, in which case the budget
+// resumes once each of them has been resumed
+func (b *budgetTimer) pause() (resume func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.pauses == 0 && !b.stopped {
+		if b.timer.Stop() {
+			b.remaining -= time.Since(b.resumedAt)
+		} else {
+			// the budget has already elapsed
+			b.stopped = true
+		}
+	}
+	b.pauses++
+
+	var once sync.Once
+	return func() {
+		once.Do(b.resume)
+	}
+}
+
+func (b *budgetTimer) resume() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.pauses--
+	if b.pauses == 0 && !b.stopped {
+		b.resumedAt = time.Now()
+		b.timer.Reset(b.remaining)
+	}
+}
+
+func (b *budgetTimer) stop() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.stopped = true
+	b.timer.Stop()
+}
+
+// RecordOverrun records that `cleaner` didn't complete within `budget` for `target` - `cleaner` is
+// empty when the budget for a Resource Group was exceeded. `err` is the error returned from RunWithinBudget,
+// which determines whether it was still running when the run moved on.
+func (c *CleanupContext) RecordOverrun(ctx context.Context, cleaner string, target string, budget time.Duration, err error) {
+	stillRunning := errors.Is(err, ErrStillRunning)
+	if cleaner == "" {
+		c.Logger.Printf("[DEBUG] %s didn't complete within %s (still running: %t) - moving on..", target, budget, stillRunning)
+	} else {
+		c.Logger.Printf("[DEBUG] %q didn't complete within %s for %s (still running: %t) - moving on..", cleaner, budget, target, stillRunning)
+	}
+	c.Recorder.RecordOverrun(report.Overrun{
+		Cleaner:      cleaner,
+		Target:       target,
+		Budget:       budget,
+		StillRunning: stillRunning,
+	})
+	c.Events().Notify(ctx, events.Event{
+		Type:    events.TypeBudgetExceeded,
+		Cleaner: cleaner,
+		Target:  target,
+		Error:   err,
+	})
+}
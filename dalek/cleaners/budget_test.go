@@ -0,0 +1,148 @@
+package cleaners
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+type confirmerFunc func(ctx context.Context, req gateway.Request) (bool, error)
+
+func (f confirmerFunc) Confirm(ctx context.Context, req gateway.Request) (bool, error) {
+	return f(ctx, req)
+}
+
+func TestRunWithinBudget(t *testing.T) {
+	failure := errors.New("failure")
+	hang := make(chan struct{})
+	defer close(hang)
+
+	gracePeriod := budgetGracePeriod
+	budgetGracePeriod = 10 * time.Millisecond
+	t.Cleanup(func() {
+		budgetGracePeriod = gracePeriod
+	})
+
+	// the Gateway takes longer to confirm each mutation than the budget, which shouldn't count against it
+	slowlyConfirmed := gateway.New(options.Options{ActuallyDelete: true}, report.New(), log.Default(), nil)
+	slowlyConfirmed.RequireConfirmation(confirmerFunc(func(ctx context.Context, req gateway.Request) (bool, error) {
+		time.Sleep(50 * time.Millisecond)
+		return true, nil
+	}))
+
+	testData := []struct {
+		name     string
+		budget   time.Duration
+		deadline time.Duration
+		fn       func(ctx context.Context) error
+		expected error
+
+		// stillRunning is whether `fn` should be reported as still running once the grace period has elapsed
+		stillRunning bool
+	}{
+		{
+			name:   "completes",
+			budget: time.Second,
+			fn: func(ctx context.Context) error {
+				return nil
+			},
+		},
+		{
+			name:   "fails",
+			budget: time.Second,
+			fn: func(ctx context.Context) error {
+				return failure
+			},
+			expected: failure,
+		},
+		{
+			name:   "no budget",
+			budget: 0,
+			fn: func(ctx context.Context) error {
+				if _, ok := ctx.Deadline(); ok {
+					return errors.New("expected no deadline")
+				}
+				return nil
+			},
+		},
+		{
+			name:   "honours cancellation",
+			budget: 10 * time.Millisecond,
+			fn: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			expected: ErrBudgetExceeded,
+		},
+		{
+			name:   "ignores cancellation",
+			budget: 10 * time.Millisecond,
+			fn: func(ctx context.Context) error {
+				<-hang
+				return nil
+			},
+			expected:     ErrBudgetExceeded,
+			stillRunning: true,
+		},
+		{
+			name:   "returns within the grace period",
+			budget: 10 * time.Millisecond,
+			fn: func(ctx context.Context) error {
+				<-ctx.Done()
+				time.Sleep(5 * time.Millisecond)
+				return nil
+			},
+			expected: ErrBudgetExceeded,
+		},
+		{
+			name:   "paused whilst confirming",
+			budget: 20 * time.Millisecond,
+			fn: func(ctx context.Context) error {
+				for i := 0; i < 2; i++ {
+					err := slowlyConfirmed.Do(ctx, gateway.Request{Operation: gateway.OperationDelete, Target: "example"}, func(ctx context.Context) error {
+						return ctx.Err()
+					})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:     "overall deadline",
+			budget:   time.Minute,
+			deadline: 10 * time.Millisecond,
+			fn: func(ctx context.Context) error {
+				<-hang
+				return nil
+			},
+			expected: context.DeadlineExceeded,
+		},
+	}
+
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			ctx := context.Background()
+			if v.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, v.deadline)
+				defer cancel()
+			}
+
+			err := RunWithinBudget(ctx, v.budget, v.fn)
+			if !errors.Is(err, v.expected) {
+				t.Fatalf("expected %v but got %v", v.expected, err)
+			}
+			if stillRunning := errors.Is(err, ErrStillRunning); stillRunning != v.stillRunning {
+				t.Fatalf("expected still running to be %t but got %t", v.stillRunning, stillRunning)
+			}
+		})
+	}
+}
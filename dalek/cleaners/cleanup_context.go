@@ -0,0 +1,70 @@
+package cleaners
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/filters"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/graph"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// CleanupContext is passed to each Cleaner and contains everything needed to perform a clean-up
+type CleanupContext struct {
+	// Client is used to read from Azure - any mutations must be performed through the Gateway
+	Client *clients.AzureClient
+
+	// Gateway is the only way a Cleaner can mutate Azure
+	Gateway *gateway.Gateway
+
+	// Inventory is a cached snapshot of the resources within the Subscription
+	Inventory *graph.Inventory
+
+	// Logger is scoped to the current Cleaner
+	Logger *log.Logger
+
+	Options options.Options
+
+	// Recorder records the outcome of each action, for inclusion in the Result
+	Recorder *report.Report
+
+	// baseLogger is the unscoped Logger which Logger is derived from
+	baseLogger *log.Logger
+
+	// candidates caches the Resource Groups to delete for the duration of the run
+	candidates *candidatesCache
+}
+
+func NewCleanupContext(client *clients.AzureClient, gw *gateway.Gateway, recorder *report.Report, logger *log.Logger, opts options.Options) *CleanupContext {
+	return &CleanupContext{
+		Client:     client,
+		Gateway:    gw,
+		Inventory:  newInventory(client),
+		Logger:     logger,
+		Options:    opts,
+		Recorder:   recorder,
+		baseLogger: logger,
+		candidates: &candidatesCache{},
+	}
+}
+
+// ForCleaner returns a copy of this CleanupContext with the Logger scoped to the specified Cleaner
+func (c *CleanupContext) ForCleaner(name string) *CleanupContext {
+	out := *c
+	out.Logger = log.New(c.baseLogger.Writer(), fmt.Sprintf("%s[%s] ", c.baseLogger.Prefix(), name), c.baseLogger.Flags()|log.Lmsgprefix)
+	return &out
+}
+
+// Events returns the Dispatcher used to notify Observers of each Event
+func (c *CleanupContext) Events() *events.Dispatcher {
+	return c.Gateway.Events()
+}
+
+// Filters returns the Evaluator used to determine whether a resource is a candidate for deletion
+func (c *CleanupContext) Filters() filters.Evaluator {
+	return c.Gateway.Filters()
+}
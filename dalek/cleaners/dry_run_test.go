@@ -0,0 +1,92 @@
+package cleaners
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// TestDryRunDoesNotMutate runs every registered cleaner with `ActuallyDelete` disabled against the fixtures
+// in `testdata/dry-run`, failing if any cleaner sends a mutating request.
+func TestDryRunDoesNotMutate(t *testing.T) {
+	fixtures, err := transports.LoadFixtures(filepath.Join("testdata", "dry-run"))
+	if err != nil {
+		t.Fatalf("loading fixtures: %+v", err)
+	}
+
+	opts := options.Options{
+		ActuallyDelete:                 false,
+		NumberOfResourceGroupsToDelete: 1000,
+		Prefix:                         "acctest",
+		Expiry: options.Expiry{
+			Enabled: true,
+			Tag:     options.DefaultExpiryTag,
+		},
+	}
+	subscriptionId := commonids.NewSubscriptionID(testclient.SubscriptionID)
+	resourceGroupId := commonids.NewResourceGroupID(testclient.SubscriptionID, "acctestRG-dalek")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	resourceGroupCleaners := DefaultResourceGroupCleaners()
+	for _, cleaner := range DefaultSubscriptionCleaners(resourceGroupCleaners) {
+		t.Run(cleaner.Name(), func(t *testing.T) {
+			recorder := transports.NewRecorder(fixtures)
+			client := testclient.New(t, recorder)
+			r := report.New()
+
+			if err := cleaner.Cleanup(ctx, subscriptionId, newCleanupContext(client, r, opts)); err != nil {
+				t.Fatalf("running Subscription Cleaner %q: %+v", cleaner.Name(), err)
+			}
+
+			assertDryRun(t, recorder, r)
+		})
+	}
+
+	for _, cleaner := range resourceGroupCleaners {
+		t.Run(cleaner.Name(), func(t *testing.T) {
+			recorder := transports.NewRecorder(fixtures)
+			client := testclient.New(t, recorder)
+			r := report.New()
+
+			if err := cleaner.Cleanup(ctx, resourceGroupId, newCleanupContext(client, r, opts)); err != nil {
+				t.Fatalf("running Resource Group Cleaner %q: %+v", cleaner.Name(), err)
+			}
+
+			assertDryRun(t, recorder, r)
+		})
+	}
+}
+
+func newCleanupContext(client *clients.AzureClient, r *report.Report, opts options.Options) *CleanupContext {
+	return NewCleanupContext(client, gateway.New(opts, r, log.Default(), nil), r, log.Default(), opts)
+}
+
+func assertDryRun(t *testing.T, recorder *transports.Recorder, r *report.Report) {
+	t.Helper()
+
+	if len(recorder.Requests()) == 0 {
+		t.Errorf("expected the cleaner to send at least one request but got none")
+	}
+	for _, req := range recorder.MutatingRequests() {
+		t.Errorf("expected no mutating requests during a dry-run but got %s %s", req.Method, req.URL)
+	}
+
+	for _, action := range r.Actions() {
+		if action.Outcome != report.OutcomeDryRun && action.Outcome != report.OutcomeSkipped {
+			t.Errorf("expected %s of %s to be a dry-run but got %q", action.Operation, action.Target, action.Outcome)
+		}
+	}
+	t.Logf("%d requests sent, %d actions would have been performed", len(recorder.Requests()), len(r.Actions()))
+}
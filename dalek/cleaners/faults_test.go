@@ -0,0 +1,369 @@
+package cleaners
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+var faultOptions = options.Options{
+	ActuallyDelete:                 true,
+	NumberOfResourceGroupsToDelete: 1000,
+	Prefix:                         "acctest",
+}
+
+func TestFaultsThrottledRequestsAreRetried(t *testing.T) {
+	disableDelays(t)
+	replayer, injector, client := replayWithFaults(t, "net_app", transports.Fault{
+		Type:       transports.FaultTypeStatusCode,
+		Method:     http.MethodGet,
+		Path:       "(?i)/providers/Microsoft.NetApp/netAppAccounts$",
+		StatusCode: http.StatusTooManyRequests,
+		Times:      2,
+	})
+	r := report.New()
+
+	if err := (deleteNetAppSubscriptionCleaner{}).Cleanup(faultContext(t), faultSubscriptionId(), newCleanupContext(client, r, faultOptions)); err != nil {
+		t.Fatalf("expected the cleaner to retry the throttled requests but got: %+v", err)
+	}
+
+	assertFaultsInjected(t, injector, 2)
+	assertReplayed(t, replayer, r)
+}
+
+func TestFaultsServerErrorsFailCleanly(t *testing.T) {
+	_, injector, client := replayWithFaults(t, "net_app", transports.Fault{
+		Type:       transports.FaultTypeStatusCode,
+		Method:     http.MethodGet,
+		Path:       "(?i)/providers/Microsoft.NetApp/netAppAccounts$",
+		StatusCode: http.StatusServiceUnavailable,
+	})
+	r := report.New()
+
+	if err := (deleteNetAppSubscriptionCleaner{}).Cleanup(faultContext(t), faultSubscriptionId(), newCleanupContext(client, r, faultOptions)); err == nil {
+		t.Fatalf("expected an error when listing NetApp Accounts fails but got none")
+	}
+
+	// the SDK retries a 503 before giving up
+	if len(injector.Injected()) < 2 {
+		t.Errorf("expected the request to be retried but got %d attempts", len(injector.Injected()))
+	}
+	assertNoActions(t, r)
+}
+
+func TestFaultsMalformedBodiesFailCleanly(t *testing.T) {
+	testData := map[string]string{
+		"truncated": `{"value": [{"id": "/subscriptions/`,
+		"nil model": `{}`,
+	}
+	for name, body := range testData {
+		t.Run(name, func(t *testing.T) {
+			_, injector, client := replayWithFaults(t, "net_app", transports.Fault{
+				Type:   transports.FaultTypeBody,
+				Method: http.MethodGet,
+				Path:   "(?i)/providers/Microsoft.NetApp/netAppAccounts$",
+				Body:   body,
+			})
+			r := report.New()
+
+			if err := (deleteNetAppSubscriptionCleaner{}).Cleanup(faultContext(t), faultSubscriptionId(), newCleanupContext(client, r, faultOptions)); err == nil {
+				t.Fatalf("expected an error when the list of NetApp Accounts is malformed but got none")
+			}
+
+			assertFaultsInjected(t, injector, 1)
+			assertNoActions(t, r)
+		})
+	}
+}
+
+func TestFaultsDroppedConnectionsAreRetried(t *testing.T) {
+	disableDelays(t)
+	replayer, injector, client := replayWithFaults(t, "service_bus", transports.Fault{
+		Type:   transports.FaultTypeDroppedConnection,
+		Method: http.MethodGet,
+		Path:   "(?i)/disasterRecoveryConfigs$",
+		Times:  1,
+	})
+	r := report.New()
+
+	if err := (serviceBusNamespaceBreakPairingCleaner{}).Cleanup(faultContext(t), faultResourceGroupId(), newCleanupContext(client, r, faultOptions)); err != nil {
+		t.Fatalf("expected the cleaner to retry the dropped connection but got: %+v", err)
+	}
+
+	assertFaultsInjected(t, injector, 1)
+	assertReplayed(t, replayer, r)
+}
+
+func TestFaultsServiceBusBreakPairingNotFoundIsIgnored(t *testing.T) {
+	disableDelays(t)
+	replayer, injector, client := replayWithFaults(t, "service_bus", transports.Fault{
+		Type:       transports.FaultTypeStatusCode,
+		Method:     http.MethodPost,
+		Path:       "(?i)/breakPairing$",
+		StatusCode: http.StatusNotFound,
+	})
+	r := report.New()
+
+	if err := (serviceBusNamespaceBreakPairingCleaner{}).Cleanup(faultContext(t), faultResourceGroupId(), newCleanupContext(client, r, faultOptions)); err != nil {
+		t.Fatalf("expected a 404 when breaking the pairing to be ignored but got: %+v", err)
+	}
+
+	assertFaultsInjected(t, injector, 1)
+	assertUnused(t, replayer, "POST /breakPairing")
+	if succeeded := len(actionsWithOutcome(r, report.OutcomeSucceeded)); succeeded != 1 {
+		t.Errorf("expected the pairing to be broken but got %d succeeded actions", succeeded)
+	}
+}
+
+func TestFaultsServiceBusConfigWithoutPropertiesIsSkipped(t *testing.T) {
+	replayer, injector, client := replayWithFaults(t, "service_bus", transports.Fault{
+		Type:   transports.FaultTypeBody,
+		Method: http.MethodGet,
+		Path:   "(?i)/disasterRecoveryConfigs$",
+		Body:   `{"value": [{"id": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestRG-dalek/providers/Microsoft.ServiceBus/namespaces/acctestnamespace/disasterRecoveryConfigs/acctestalias", "name": "acctestalias"}]}`,
+	})
+	r := report.New()
+
+	if err := (serviceBusNamespaceBreakPairingCleaner{}).Cleanup(faultContext(t), faultResourceGroupId(), newCleanupContext(client, r, faultOptions)); err != nil {
+		t.Fatalf("expected a Disaster Recovery Config without properties to be skipped but got: %+v", err)
+	}
+
+	assertFaultsInjected(t, injector, 1)
+	assertUnused(t, replayer, "POST /breakPairing", "GET /disasterRecoveryConfigs/acctestalias")
+	assertNoActions(t, r)
+}
+
+func TestFaultsPaloAltoToleratesServerErrors(t *testing.T) {
+	for _, statusCode := range []int{http.StatusInternalServerError, http.StatusBadGateway} {
+		t.Run(http.StatusText(statusCode), func(t *testing.T) {
+			replayer, _, client := replayWithFaults(t, "palo_alto", transports.Fault{
+				Type:       transports.FaultTypeStatusCode,
+				Method:     http.MethodGet,
+				Path:       "(?i)/localRules$",
+				StatusCode: statusCode,
+			})
+			r := report.New()
+
+			if err := (paloAltoLocalRulestackCleaner{}).Cleanup(faultContext(t), faultResourceGroupId(), newCleanupContext(client, r, faultOptions)); err != nil {
+				t.Fatalf("expected a %d when listing the Local Rules to be skipped but got: %+v", statusCode, err)
+			}
+
+			// the Local Rules are skipped, so they're neither deleted nor committed - but everything else is
+			assertUnused(t, replayer, "GET /localRules", "DELETE /localRules/1000", "POST /commit")
+			for _, action := range r.Actions() {
+				if strings.Contains(action.Target, "/localRules/") {
+					t.Errorf("expected the Local Rules to be skipped but got %s of %s", action.Operation, action.Target)
+				}
+			}
+			if len(actionsWithOutcome(r, report.OutcomeSucceeded)) == 0 {
+				t.Errorf("expected the cleaner to keep going after the Local Rules were skipped but no actions succeeded")
+			}
+		})
+	}
+}
+
+func TestFaultsPaloAltoDeletesCertificatesAndPrefixLists(t *testing.T) {
+	// a failure is injected into each DELETE, so that this fails if the DELETE is never sent
+	for _, path := range []string{"/certificates/acctestcertificate", "/prefixLists/acctestprefix"} {
+		t.Run(path, func(t *testing.T) {
+			_, injector, client := replayWithFaults(t, "palo_alto", transports.Fault{
+				Type:       transports.FaultTypeStatusCode,
+				Method:     http.MethodDelete,
+				Path:       "(?i)" + path + "$",
+				StatusCode: http.StatusConflict,
+			})
+			r := report.New()
+
+			if err := (paloAltoLocalRulestackCleaner{}).Cleanup(faultContext(t), faultResourceGroupId(), newCleanupContext(client, r, faultOptions)); err != nil {
+				t.Fatalf("expected a failed delete to be reported rather than returned but got: %+v", err)
+			}
+
+			assertFaultsInjected(t, injector, 1)
+			failed := actionsWithOutcome(r, report.OutcomeFailed)
+			if len(failed) != 1 || !strings.HasSuffix(failed[0].Target, path) {
+				t.Fatalf("expected the delete of %s to be recorded as failed but got %+v", path, failed)
+			}
+		})
+	}
+}
+
+func TestFaultsProtectedParentsAreLeftAlone(t *testing.T) {
+	testData := []struct {
+		name     string
+		cassette string
+		path     string
+		body     string
+		cleaner  ResourceGroupCleaner
+	}{
+		{
+			name:     "Backup Vault",
+			cassette: "data_protection",
+			path:     "(?i)/backupVaults$",
+			body:     `{"value": [{"id": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestRG-dalek/providers/Microsoft.DataProtection/backupVaults/acctestvault", "location": "westeurope", "name": "acctestvault", "properties": {"storageSettings": []}, "tags": {"DoNotDelete": "true"}}]}`,
+			cleaner:  removeDataProtectionFromResourceGroupCleaner{},
+		},
+		{
+			name:     "Local Rulestack",
+			cassette: "palo_alto",
+			path:     "(?i)/localRulestacks$",
+			body:     `{"value": [{"id": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestRG-dalek/providers/PaloAltoNetworks.Cloudngfw/localRulestacks/acctestrulestack", "location": "westeurope", "name": "acctestrulestack", "properties": {}, "tags": {"DoNotDelete": "true"}}]}`,
+			cleaner:  paloAltoLocalRulestackCleaner{},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			replayer, injector, client := replayWithFaults(t, v.cassette, transports.Fault{
+				Type:   transports.FaultTypeBody,
+				Method: http.MethodGet,
+				Path:   v.path,
+				Body:   v.body,
+			})
+			interactions := len(replayer.Unused())
+			r := report.New()
+
+			if err := v.cleaner.Cleanup(faultContext(t), faultResourceGroupId(), newCleanupContext(client, r, faultOptions)); err != nil {
+				t.Fatalf("expected the protected %s to be skipped but got: %+v", v.name, err)
+			}
+
+			// only the parent is listed, nothing within it is listed or mutated
+			assertFaultsInjected(t, injector, 1)
+			if unused := len(replayer.Unused()); unused != interactions-1 {
+				t.Errorf("expected only the %ss to be listed but %d requests were sent", v.name, interactions-unused)
+			}
+			actions := r.Actions()
+			if len(actions) != 1 || actions[0].Outcome != report.OutcomeSkipped {
+				t.Fatalf("expected the protected %s to be skipped but got %+v", v.name, actions)
+			}
+		})
+	}
+}
+
+func TestFaultsPaloAltoNilModelFailsCleanly(t *testing.T) {
+	_, injector, client := replayWithFaults(t, "palo_alto", transports.Fault{
+		Type:   transports.FaultTypeBody,
+		Method: http.MethodGet,
+		Path:   "(?i)/localRulestacks/acctestrulestack$",
+		Body:   "null",
+	})
+	r := report.New()
+
+	err := (paloAltoLocalRulestackCleaner{}).Cleanup(faultContext(t), faultResourceGroupId(), newCleanupContext(client, r, faultOptions))
+	if err == nil || !strings.Contains(err.Error(), "model was nil") {
+		t.Fatalf("expected an error when the Local Rulestack has no model but got: %+v", err)
+	}
+	assertFaultsInjected(t, injector, 1)
+}
+
+func TestFaultsSlowLongRunningOperationsFailCleanly(t *testing.T) {
+	_, injector, client := replayWithFaults(t, "managed_hsms", transports.Fault{
+		Type:   transports.FaultTypeDelay,
+		Method: http.MethodGet,
+		Path:   "(?i)/operationStatus/",
+		Delay:  time.Minute,
+	})
+	r := report.New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := (purgeSoftDeletedManagedHSMsInSubscriptionCleaner{}).Cleanup(ctx, faultSubscriptionId(), newCleanupContext(client, r, faultOptions)); err == nil {
+		t.Fatalf("expected an error when the purge doesn't complete in time but got none")
+	}
+
+	assertFaultsInjected(t, injector, 1)
+	if failed := len(actionsWithOutcome(r, report.OutcomeFailed)); failed != 1 {
+		t.Errorf("expected the purge to be recorded as failed but got %d failed actions", failed)
+	}
+}
+
+func replayWithFaults(t *testing.T, cassetteName string, faults ...transports.Fault) (*transports.Replayer, *transports.FaultInjector, *clients.AzureClient) {
+	t.Helper()
+
+	cassette, err := transports.LoadCassette(filepath.Join("testdata", "cassettes", cassetteName+".json"))
+	if err != nil {
+		t.Fatalf("loading cassette: %+v", err)
+	}
+	replayer := transports.NewReplayer(*cassette)
+	injector, err := transports.NewFaultInjector(replayer, faults...)
+	if err != nil {
+		t.Fatalf("building the fault injector: %+v", err)
+	}
+	return replayer, injector, testclient.New(t, injector)
+}
+
+func faultContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func faultSubscriptionId() commonids.SubscriptionId {
+	return commonids.NewSubscriptionID(testclient.SubscriptionID)
+}
+
+func faultResourceGroupId() commonids.ResourceGroupId {
+	return commonids.NewResourceGroupID(testclient.SubscriptionID, "acctestRG-dalek")
+}
+
+func actionsWithOutcome(r *report.Report, outcome report.Outcome) []report.Action {
+	out := make([]report.Action, 0)
+	for _, action := range r.Actions() {
+		if action.Outcome == outcome {
+			out = append(out, action)
+		}
+	}
+	return out
+}
+
+func assertFaultsInjected(t *testing.T, injector *transports.FaultInjector, expected int) {
+	t.Helper()
+
+	if injected := len(injector.Injected()); injected != expected {
+		t.Errorf("expected %d faults to be injected but got %d", expected, injected)
+	}
+}
+
+func assertNoActions(t *testing.T, r *report.Report) {
+	t.Helper()
+
+	for _, action := range r.Actions() {
+		t.Errorf("expected no actions to be performed but got %s of %s (%s)", action.Operation, action.Target, action.Outcome)
+	}
+}
+
+// assertUnused asserts that the interactions which weren't replayed match `expected`, where each is
+// the method followed by a suffix of the path, e.g. `DELETE /localRules/1000`
+func assertUnused(t *testing.T, replayer *transports.Replayer, expected ...string) {
+	t.Helper()
+
+	unused := replayer.Unused()
+	if len(unused) != len(expected) {
+		for _, interaction := range unused {
+			t.Logf("unused: %s %s", interaction.Request.Method, interaction.Request.URL)
+		}
+		t.Fatalf("expected %d unused interactions but got %d", len(expected), len(unused))
+	}
+	for _, v := range expected {
+		method, pathSuffix, _ := strings.Cut(v, " ")
+		found := false
+		for _, interaction := range unused {
+			path := strings.SplitN(interaction.Request.URL, "?", 2)[0]
+			if interaction.Request.Method == method && strings.HasSuffix(strings.ToLower(path), strings.ToLower(pathSuffix)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected %q to be unused but it was replayed", v)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package cleaners
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/go-azure-helpers/lang/pointer"
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/resourceids"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resourcegroups"
+	"github.com/hashicorp/go-azure-sdk/sdk/client"
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/graph"
+)
+
+// newInventory returns an Inventory of the resources within the Subscription - using Resource Graph when it's
+// available in the APIProfile, otherwise using the Resources API.
+func newInventory(azureClient *clients.AzureClient) *graph.Inventory {
+	if azureClient.Profile.SupportsResourceGraph() {
+		return graph.NewInventory(graph.NewClient(azureClient.ResourceManager.ResourceGraphClient), graph.SubscriptionScope(azureClient.SubscriptionID))
+	}
+
+	return graph.NewInventoryUsingLoader(func(ctx context.Context) ([]graph.Resource, error) {
+		return listResourcesInSubscription(ctx, azureClient)
+	})
+}
+
+// listResourcesInSubscription lists each of the resources within the Subscription using the Resources API,
+// which (unlike Resource Graph) is available on Azure Stack Hub
+func listResourcesInSubscription(ctx context.Context, azureClient *clients.AzureClient) ([]graph.Resource, error) {
+	subscriptionId := commonids.NewSubscriptionID(azureClient.SubscriptionID)
+	opts := client.RequestOptions{
+		ContentType: "application/json; charset=utf-8",
+		ExpectedStatusCodes: []int{
+			http.StatusOK,
+		},
+		HttpMethod: http.MethodGet,
+		OptionsObject: resourcegroups.ResourcesListByResourceGroupOperationOptions{
+			Expand: pointer.To("createdTime"),
+		},
+		Path: fmt.Sprintf("%s/resources", subscriptionId.ID()),
+	}
+	// the API Version of this request is pinned to the one in the APIProfile by the Resource Groups client
+	req, err := azureClient.ResourceManager.ResourcesGroupsClient.Client.NewRequest(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %+v", err)
+	}
+
+	resp, err := req.ExecutePaged(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing the resources within %s: %+v", subscriptionId, err)
+	}
+
+	var values struct {
+		Values *[]resourcegroups.GenericResourceExpanded `json:"value"`
+	}
+	if err := resp.Unmarshal(&values); err != nil {
+		return nil, fmt.Errorf("parsing the resources within %s: %+v", subscriptionId, err)
+	}
+
+	out := make([]graph.Resource, 0)
+	if values.Values == nil {
+		return out, nil
+	}
+	for _, item := range *values.Values {
+		if item.Id == nil {
+			continue
+		}
+		parsed, err := resourceids.ParseAzureResourceID(*item.Id)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %+v", *item.Id, err)
+		}
+
+		resource := graph.Resource{
+			ID:            *item.Id,
+			Name:          pointer.From(item.Name),
+			Type:          pointer.From(item.Type),
+			ResourceGroup: parsed.ResourceGroup,
+			Location:      pointer.From(item.Location),
+		}
+		if item.Tags != nil {
+			resource.Tags = *item.Tags
+		}
+		if createdAt, err := item.GetCreatedTimeAsTime(); err == nil {
+			resource.CreatedAt = createdAt
+		}
+		out = append(out, resource)
+	}
+	return out, nil
+}
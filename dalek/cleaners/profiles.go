@@ -0,0 +1,47 @@
+package cleaners
+
+import (
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+)
+
+// ResourceTypesCleaner is implemented by Subscription Cleaners which only apply to specific Resource Types, so
+// that they can be turned off when none of these are available using the APIProfile (e.g. on Azure Stack Hub) -
+// Subscription Cleaners which don't implement this are always run.
+type ResourceTypesCleaner interface {
+	ResourceTypes() []string
+}
+
+// SupportedResourceGroupCleaners splits the Resource Group Cleaners into those which support at least one
+// Resource Type available using the APIProfile, and those which don't
+func SupportedResourceGroupCleaners(profile clients.APIProfile, input []ResourceGroupCleaner) (supported []ResourceGroupCleaner, unsupported []ResourceGroupCleaner) {
+	for _, cleaner := range input {
+		if supportsAnyResourceType(profile, cleaner.ResourceTypes()) {
+			supported = append(supported, cleaner)
+			continue
+		}
+		unsupported = append(unsupported, cleaner)
+	}
+	return
+}
+
+// SupportedSubscriptionCleaners splits the Subscription Cleaners into those which support at least one
+// Resource Type available using the APIProfile (see ResourceTypesCleaner), and those which don't
+func SupportedSubscriptionCleaners(profile clients.APIProfile, input []SubscriptionCleaner) (supported []SubscriptionCleaner, unsupported []SubscriptionCleaner) {
+	for _, cleaner := range input {
+		if v, ok := cleaner.(ResourceTypesCleaner); ok && !supportsAnyResourceType(profile, v.ResourceTypes()) {
+			unsupported = append(unsupported, cleaner)
+			continue
+		}
+		supported = append(supported, cleaner)
+	}
+	return
+}
+
+func supportsAnyResourceType(profile clients.APIProfile, resourceTypes []string) bool {
+	for _, resourceType := range resourceTypes {
+		if profile.Supports(resourceType) {
+			return true
+		}
+	}
+	return false
+}
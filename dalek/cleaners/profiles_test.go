@@ -0,0 +1,68 @@
+package cleaners
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+)
+
+func TestSupportedCleaners(t *testing.T) {
+	resourceGroupCleaners := DefaultResourceGroupCleaners()
+	subscriptionCleaners := DefaultSubscriptionCleaners(resourceGroupCleaners)
+
+	testData := []struct {
+		profile                       clients.APIProfile
+		expectedResourceGroupCleaners []string
+		expectedSubscriptionCleaners  []string
+	}{
+		{
+			profile: clients.ProfileLatest,
+			expectedResourceGroupCleaners: []string{
+				removeLocksFromResourceGroupCleaner{}.Name(),
+				removeDataProtectionFromResourceGroupCleaner{}.Name(),
+				notificationHubNamespacesCleaner{}.Name(),
+				paloAltoLocalRulestackCleaner{}.Name(),
+				serviceBusNamespaceBreakPairingCleaner{}.Name(),
+			},
+			expectedSubscriptionCleaners: []string{
+				deleteNetAppSubscriptionCleaner{}.Name(),
+				deleteStorageSyncSubscriptionCleaner{}.Name(),
+				deleteResourceGroupsInSubscriptionCleaner{}.Name(),
+				deleteExpiredInSubscriptionCleaner{}.Name(),
+				purgeSoftDeletedManagedHSMsInSubscriptionCleaner{}.Name(),
+				purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner{}.Name(),
+			},
+		},
+		{
+			profile: clients.ProfileAzureStackHub,
+			expectedResourceGroupCleaners: []string{
+				removeLocksFromResourceGroupCleaner{}.Name(),
+			},
+			expectedSubscriptionCleaners: []string{
+				deleteResourceGroupsInSubscriptionCleaner{}.Name(),
+			},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.profile.Name, func(t *testing.T) {
+			supportedResourceGroupCleaners, _ := SupportedResourceGroupCleaners(v.profile, resourceGroupCleaners)
+			actualResourceGroupCleaners := make([]string, 0)
+			for _, cleaner := range supportedResourceGroupCleaners {
+				actualResourceGroupCleaners = append(actualResourceGroupCleaners, cleaner.Name())
+			}
+			if !reflect.DeepEqual(actualResourceGroupCleaners, v.expectedResourceGroupCleaners) {
+				t.Errorf("expected the Resource Group Cleaners %q but got %q", v.expectedResourceGroupCleaners, actualResourceGroupCleaners)
+			}
+
+			supportedSubscriptionCleaners, _ := SupportedSubscriptionCleaners(v.profile, subscriptionCleaners)
+			actualSubscriptionCleaners := make([]string, 0)
+			for _, cleaner := range supportedSubscriptionCleaners {
+				actualSubscriptionCleaners = append(actualSubscriptionCleaners, cleaner.Name())
+			}
+			if !reflect.DeepEqual(actualSubscriptionCleaners, v.expectedSubscriptionCleaners) {
+				t.Errorf("expected the Subscription Cleaners %q but got %q", v.expectedSubscriptionCleaners, actualSubscriptionCleaners)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cleaners
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// Remediation is an entry in the RemediationCatalog, mapping an ARM error to the Resource Group Cleaner which
+// resolves it
+type Remediation struct {
+	// Code is the ARM error code, which is compared case-insensitively against the code of the failure and
+	// each of its inner errors - when empty any code matches
+	Code string
+
+	// MessagePattern, when set, must also match the message of the failure (or of the inner error with Code) -
+	// which is needed to identify the cause of errors with a generic code, e.g. `Conflict`
+	MessagePattern *regexp.Regexp
+
+	Cleaner ResourceGroupCleaner
+}
+
+// matches returns whether this Remediation applies to the error with the specified code and message
+func (r Remediation) matches(code, message string) bool {
+	if r.Code != "" && !strings.EqualFold(r.Code, code) {
+		return false
+	}
+	if r.MessagePattern != nil && !r.MessagePattern.MatchString(message) {
+		return false
+	}
+	return true
+}
+
+// RemediationCatalog maps the errors returned when deleting a Resource Group to the Resource Group Cleaners
+// which resolve them, so that the Resource Group can be deleted again
+type RemediationCatalog []Remediation
+
+// DefaultRemediationCatalog returns the built-in RemediationCatalog - each entry should be covered by a
+// recorded error body in `testdata/remediations`
+func DefaultRemediationCatalog() RemediationCatalog {
+	return RemediationCatalog{
+		{
+			Code:    "ScopeLocked",
+			Cleaner: removeLocksFromResourceGroupCleaner{},
+		},
+		{
+			MessagePattern: regexp.MustCompile(`(?i)backup (instance|item)s?\b.*\b(exist|protect)|protected (backup )?(instance|item)s?`),
+			Cleaner:        removeDataProtectionFromResourceGroupCleaner{},
+		},
+		{
+			MessagePattern: regexp.MustCompile(`(?i)(geo-?dr|disaster ?recovery|alias).*(pair|config)`),
+			Cleaner:        serviceBusNamespaceBreakPairingCleaner{},
+		},
+		{
+			MessagePattern: regexp.MustCompile(`(?i)notification ?hubs?`),
+			Cleaner:        notificationHubNamespacesCleaner{},
+		},
+		{
+			MessagePattern: regexp.MustCompile(`(?i)rulestack`),
+			Cleaner:        paloAltoLocalRulestackCleaner{},
+		},
+	}
+}
+
+// Match returns the Resource Group Cleaners which remediate the specified failure (in catalog order), or an
+// empty list when the failure isn't one which can be remediated
+func (c RemediationCatalog) Match(failure report.DeletionFailure) []ResourceGroupCleaner {
+	out := make([]ResourceGroupCleaner, 0)
+	seen := make(map[string]struct{})
+	for _, remediation := range c {
+		matched := remediation.matches(failure.Code, failure.Message)
+		for _, detail := range failure.Details {
+			matched = matched || remediation.matches(detail.Code, detail.Message)
+		}
+		if !matched {
+			continue
+		}
+		if _, exists := seen[remediation.Cleaner.Name()]; exists {
+			continue
+		}
+		seen[remediation.Cleaner.Name()] = struct{}{}
+		out = append(out, remediation.Cleaner)
+	}
+	return out
+}
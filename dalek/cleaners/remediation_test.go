@@ -0,0 +1,82 @@
+package cleaners
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// TestDefaultRemediationCatalog matches each of the error bodies recorded in `testdata/remediations` (returned
+// by the long-running operation for a failed Resource Group deletion) against the DefaultRemediationCatalog
+func TestDefaultRemediationCatalog(t *testing.T) {
+	testData := map[string][]string{
+		"backup_instances":    {removeDataProtectionFromResourceGroupCleaner{}.Name()},
+		"in_use_subnet":       {},
+		"notification_hubs":   {notificationHubNamespacesCleaner{}.Name()},
+		"palo_alto_rulestack": {paloAltoLocalRulestackCleaner{}.Name()},
+		"scope_locked":        {removeLocksFromResourceGroupCleaner{}.Name()},
+		"service_bus_geo_dr":  {serviceBusNamespaceBreakPairingCleaner{}.Name()},
+	}
+	id := commonids.NewResourceGroupID(testclient.SubscriptionID, "acctestRG-dalek")
+	for name, expected := range testData {
+		t.Run(name, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", "remediations", name+".json"))
+			if err != nil {
+				t.Fatalf("loading the error body: %+v", err)
+			}
+			failure, completed, err := parseOperationStatus(id, http.StatusConflict, body)
+			if err != nil {
+				t.Fatalf("parsing the error body: %+v", err)
+			}
+			if !completed || failure == nil {
+				t.Fatalf("expected the error body to be parsed as a failure")
+			}
+
+			actual := make([]string, 0)
+			for _, cleaner := range DefaultRemediationCatalog().Match(*failure) {
+				actual = append(actual, cleaner.Name())
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("expected the cleaners %q but got %q", expected, actual)
+			}
+		})
+	}
+}
+
+func TestDeleteResourceGroupsRemediatesFailures(t *testing.T) {
+	disableDelays(t)
+	cassette, err := transports.LoadCassette(filepath.Join("testdata", "cassettes", "resource_groups_remediated.json"))
+	if err != nil {
+		t.Fatalf("loading cassette: %+v", err)
+	}
+	replayer := transports.NewReplayer(*cassette)
+	client := testclient.New(t, replayer)
+	r := report.New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// no cleaners are run up-front, so the Lock is only removed once the deletion fails with `ScopeLocked`
+	cleaner := NewDeleteResourceGroupsCleaner([]ResourceGroupCleaner{})
+	if err := cleaner.Cleanup(ctx, commonids.NewSubscriptionID(testclient.SubscriptionID), newCleanupContext(client, r, faultOptions)); err != nil {
+		t.Fatalf("running the cleaner: %+v", err)
+	}
+	assertReplayed(t, replayer, r)
+
+	failures := r.DeletionFailures()
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 deletion failure but got %d", len(failures))
+	}
+	if expected := []string{removeLocksFromResourceGroupCleaner{}.Name()}; !reflect.DeepEqual(failures[0].Remediations, expected) {
+		t.Errorf("expected the failure to be remediated by %q but got %q", expected, failures[0].Remediations)
+	}
+}
@@ -0,0 +1,168 @@
+package cleaners
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// TestCleanersReplayCassettes runs each cleaner with `ActuallyDelete` enabled against the cassette of the same
+// name in `testdata/cassettes`, failing if the cleaner sends a request which isn't in the cassette, or doesn't
+// send one which is. Cassettes can be recorded from a real run using `-record-cassette`.
+//
+// NOTE: the SDK waits 10s before polling a DELETE (regardless of the Retry-After header) - so cleaners which
+// use a `DeleteThenPoll` method take at least that long to replay.
+func TestCleanersReplayCassettes(t *testing.T) {
+	disableDelays(t)
+
+	opts := options.Options{
+		ActuallyDelete:                 true,
+		NumberOfResourceGroupsToDelete: 1000,
+		Prefix:                         "acctest",
+	}
+	subscriptionId := commonids.NewSubscriptionID(testclient.SubscriptionID)
+	resourceGroupId := commonids.NewResourceGroupID(testclient.SubscriptionID, "acctestRG-dalek")
+
+	testData := []struct {
+		cassette             string
+		profile              *clients.APIProfile
+		configure            func(opts *options.Options)
+		subscriptionCleaner  SubscriptionCleaner
+		resourceGroupCleaner ResourceGroupCleaner
+	}{
+		{
+			cassette:            "net_app",
+			subscriptionCleaner: deleteNetAppSubscriptionCleaner{},
+		},
+		{
+			cassette:            "storage_sync",
+			subscriptionCleaner: deleteStorageSyncSubscriptionCleaner{},
+		},
+		{
+			cassette:            "resource_groups",
+			subscriptionCleaner: NewDeleteResourceGroupsCleaner([]ResourceGroupCleaner{removeLocksFromResourceGroupCleaner{}}),
+		},
+		{
+			cassette:            "resource_groups_azure_stack",
+			profile:             &clients.ProfileAzureStackHub,
+			subscriptionCleaner: NewDeleteResourceGroupsCleaner([]ResourceGroupCleaner{removeLocksFromResourceGroupCleaner{}}),
+		},
+		{
+			cassette: "expired",
+			configure: func(opts *options.Options) {
+				opts.Expiry = options.Expiry{
+					Enabled: true,
+					Tag:     options.DefaultExpiryTag,
+				}
+			},
+			subscriptionCleaner: deleteExpiredInSubscriptionCleaner{},
+		},
+		{
+			cassette:            "managed_hsms",
+			subscriptionCleaner: purgeSoftDeletedManagedHSMsInSubscriptionCleaner{},
+		},
+		{
+			cassette:            "machine_learning_workspaces",
+			subscriptionCleaner: purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner{},
+		},
+		{
+			cassette:             "locks",
+			resourceGroupCleaner: removeLocksFromResourceGroupCleaner{},
+		},
+		{
+			cassette:             "data_protection",
+			resourceGroupCleaner: removeDataProtectionFromResourceGroupCleaner{},
+		},
+		{
+			cassette:             "notification_hubs",
+			resourceGroupCleaner: notificationHubNamespacesCleaner{},
+		},
+		{
+			cassette:             "palo_alto",
+			resourceGroupCleaner: paloAltoLocalRulestackCleaner{},
+		},
+		{
+			cassette:             "service_bus",
+			resourceGroupCleaner: serviceBusNamespaceBreakPairingCleaner{},
+		},
+	}
+
+	for _, v := range testData {
+		t.Run(v.cassette, func(t *testing.T) {
+			cassette, err := transports.LoadCassette(filepath.Join("testdata", "cassettes", v.cassette+".json"))
+			if err != nil {
+				t.Fatalf("loading cassette: %+v", err)
+			}
+			replayer := transports.NewReplayer(*cassette)
+			profile := clients.ProfileLatest
+			if v.profile != nil {
+				profile = *v.profile
+			}
+			client := testclient.NewForProfile(t, replayer, profile)
+			r := report.New()
+			opts := opts
+			if v.configure != nil {
+				v.configure(&opts)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+
+			if v.subscriptionCleaner != nil {
+				err = v.subscriptionCleaner.Cleanup(ctx, subscriptionId, newCleanupContext(client, r, opts))
+			} else {
+				err = v.resourceGroupCleaner.Cleanup(ctx, resourceGroupId, newCleanupContext(client, r, opts))
+			}
+			if err != nil {
+				t.Fatalf("running the cleaner: %+v", err)
+			}
+
+			assertReplayed(t, replayer, r)
+		})
+	}
+}
+
+// disableDelays removes the delays the cleaners use to wait for Azure, since there's nothing to wait for when replaying
+func disableDelays(t *testing.T) {
+	consistencyDelay, pollInterval, statusInterval, retryDelay := netAppConsistencyDelay, serviceBusBreakPairingPollInterval, deletionStatusPollInterval, teardownRetryDelay
+	netAppConsistencyDelay, serviceBusBreakPairingPollInterval, deletionStatusPollInterval, teardownRetryDelay = 0, 0, 0, 0
+	t.Cleanup(func() {
+		netAppConsistencyDelay, serviceBusBreakPairingPollInterval, deletionStatusPollInterval, teardownRetryDelay = consistencyDelay, pollInterval, statusInterval, retryDelay
+	})
+}
+
+func assertReplayed(t *testing.T, replayer *transports.Replayer, r *report.Report) {
+	t.Helper()
+
+	for _, req := range replayer.Unmatched() {
+		t.Errorf("expected every request to be in the cassette but got %s %s", req.Method, req.URL)
+	}
+	for _, interaction := range replayer.Unused() {
+		t.Errorf("expected every interaction in the cassette to be replayed but %s %s wasn't", interaction.Request.Method, interaction.Request.URL)
+	}
+
+	succeeded := 0
+	for _, action := range r.Actions() {
+		switch action.Outcome {
+		case report.OutcomeSucceeded:
+			succeeded++
+
+		case report.OutcomeSkipped:
+			continue
+
+		default:
+			t.Errorf("expected %s of %s to succeed but got %q: %s", action.Operation, action.Target, action.Outcome, action.Error)
+		}
+	}
+	if succeeded == 0 {
+		t.Errorf("expected the cleaner to perform at least one action but got none")
+	}
+}
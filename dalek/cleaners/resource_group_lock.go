@@ -2,12 +2,11 @@ package cleaners
 
 import (
 	"context"
-	"log"
+	"errors"
 
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2020-05-01/managementlocks"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
 )
 
 var _ ResourceGroupCleaner = removeLocksFromResourceGroupCleaner{}
@@ -19,33 +18,40 @@ func (removeLocksFromResourceGroupCleaner) Name() string {
 	return "Removing Locks.."
 }
 
-func (removeLocksFromResourceGroupCleaner) Cleanup(ctx context.Context, id commonids.ResourceGroupId, client *clients.AzureClient, opts options.Options) error {
-	locks, err := client.ResourceManager.LocksClient.ListAtResourceGroupLevel(ctx, id, managementlocks.DefaultListAtResourceGroupLevelOperationOptions())
+func (removeLocksFromResourceGroupCleaner) Cleanup(ctx context.Context, id commonids.ResourceGroupId, cc *CleanupContext) error {
+	locks, err := cc.Client.ResourceManager.LocksClient.ListAtResourceGroupLevel(ctx, id, managementlocks.DefaultListAtResourceGroupLevelOperationOptions())
 	if err != nil {
-		log.Printf("[DEBUG] Error obtaining Resource Group Locks : %+v", err)
+		cc.Logger.Printf("[DEBUG] Error obtaining Resource Group Locks : %+v", err)
 	}
 
 	if model := locks.Model; model != nil {
 		for _, lock := range *model {
 			if lock.Id == nil {
-				log.Printf("[DEBUG]   Lock with nil id on %q", id.ResourceGroupName)
+				cc.Logger.Printf("[DEBUG]   Lock with nil id on %q", id.ResourceGroupName)
 				continue
 			}
 			lockId, err := managementlocks.ParseScopedLockID(*lock.Id)
 			if err != nil {
-				log.Printf("[ERROR] Parsing Scoped Lock ID %q: %+v", *lock.Id, err)
+				cc.Logger.Printf("[ERROR] Parsing Scoped Lock ID %q: %+v", *lock.Id, err)
 				continue
 			}
 
 			if lock.Name == nil {
-				log.Printf("[DEBUG]   Lock %s with nil name on %q", id, id.ResourceGroupName)
+				cc.Logger.Printf("[DEBUG]   Lock %s with nil name on %q", id, id.ResourceGroupName)
 				continue
 			}
 
-			log.Printf("[DEBUG]   Attemping to remove lock %s from: %s", id, id.ResourceGroupName)
-
-			if _, err := client.ResourceManager.LocksClient.DeleteByScope(ctx, *lockId); err != nil {
-				log.Printf("[DEBUG]   Unable to delete lock %s on resource group %q", *lock.Name, id.ResourceGroupName)
+			cc.Logger.Printf("[DEBUG]   Attemping to remove lock %s from: %s", *lockId, id.ResourceGroupName)
+			req := gateway.Request{
+				Operation: gateway.OperationDelete,
+				Target:    lockId.ID(),
+			}
+			err = cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+				_, err := cc.Client.ResourceManager.LocksClient.DeleteByScope(ctx, *lockId)
+				return err
+			})
+			if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+				cc.Logger.Printf("[DEBUG]   Unable to delete lock %s on resource group %q: %+v", *lock.Name, id.ResourceGroupName, err)
 			}
 		}
 	}
@@ -2,15 +2,15 @@ package cleaners
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/hashicorp/go-azure-helpers/lang/pointer"
+	"sort"
+	"strings"
+
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/notificationhubs/2017-04-01/namespaces"
-	"github.com/hashicorp/go-azure-sdk/resource-manager/resourcegraph/2022-10-01/resources"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
-	"log"
-	"strings"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/graph"
 )
 
 type notificationHubNamespacesCleaner struct{}
@@ -21,26 +21,26 @@ func (c notificationHubNamespacesCleaner) Name() string {
 	return "Notification Hub Namespaces"
 }
 
-func (c notificationHubNamespacesCleaner) Cleanup(ctx context.Context, id commonids.ResourceGroupId, client *clients.AzureClient, opts options.Options) error {
+func (c notificationHubNamespacesCleaner) Cleanup(ctx context.Context, id commonids.ResourceGroupId, cc *CleanupContext) error {
 	// Notification Hub Namespaces don't clean up cleanly when deleting the Resource Group, so let's remove these
 
-	log.Printf("[DEBUG] Retrieving Notification Hub Namespaces in %s..", id)
-	namespaceIds, err := c.findNamespacesIDs(ctx, id, client)
+	cc.Logger.Printf("[DEBUG] Retrieving Notification Hub Namespaces in %s..", id)
+	namespaceIds, err := c.findNamespacesIDs(ctx, id, cc.Inventory)
 	if err != nil {
 		return fmt.Errorf("finding the Namespace IDs within %s: %+v", id, err)
 	}
 
 	for _, namespaceId := range *namespaceIds {
-		if !opts.ActuallyDelete {
-			log.Printf("[DEBUG] Would have deleted %s..", namespaceId)
-			continue
+		req := gateway.Request{
+			Operation: gateway.OperationDelete,
+			Target:    namespaceId.ID(),
 		}
-
-		log.Printf("[DEBUG] Deleting %s..", namespaceId)
-		if err := client.ResourceManager.NotificationHubNamespaceClient.DeleteThenPoll(ctx, namespaceId); err != nil {
+		err := cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+			return cc.Client.ResourceManager.NotificationHubNamespaceClient.DeleteThenPoll(ctx, namespaceId)
+		})
+		if err != nil && !errors.Is(err, gateway.ErrBlocked) {
 			return fmt.Errorf("deleting %s: %+v", namespaceId, err)
 		}
-		log.Printf("[DEBUG] Deleted %s.", namespaceId)
 	}
 
 	return nil
@@ -52,57 +52,23 @@ func (c notificationHubNamespacesCleaner) ResourceTypes() []string {
 	}
 }
 
-func (c notificationHubNamespacesCleaner) findNamespacesIDs(ctx context.Context, resourceGroupId commonids.ResourceGroupId, client *clients.AzureClient) (*[]namespaces.NamespaceId, error) {
-	query := strings.TrimSpace(fmt.Sprintf(`
-resources
-| where type =~ "Microsoft.NotificationHubs/namespaces"
-| where resourceGroup =~ '%s'
-| project id
-| sort by (tolower(tostring(id))) asc
-`, resourceGroupId.ResourceGroupName))
-	payload := resources.QueryRequest{
-		Options: &resources.QueryRequestOptions{
-			Top: pointer.To(int64(1000)),
-		},
-		Query: query,
-		Subscriptions: &[]string{
-			resourceGroupId.SubscriptionId,
-		},
-	}
-	resp, err := client.ResourceManager.ResourceGraphClient.Resources(ctx, payload)
+func (c notificationHubNamespacesCleaner) findNamespacesIDs(ctx context.Context, resourceGroupId commonids.ResourceGroupId, inventory *graph.Inventory) (*[]namespaces.NamespaceId, error) {
+	items, err := inventory.InResourceGroup(ctx, resourceGroupId.ResourceGroupName, c.ResourceTypes()...)
 	if err != nil {
-		return nil, fmt.Errorf("performing graph query %q: %+v", query, err)
-	}
-
-	if resp.Model == nil {
-		return nil, fmt.Errorf("performing graph query %q: response was nil", query)
-	}
-	if resp.Model.Data == nil {
-		return nil, fmt.Errorf("performing graph query %q: response.data was nil", query)
+		return nil, err
 	}
 
 	namespaceIds := make([]namespaces.NamespaceId, 0)
-	itemsRaw, ok := resp.Model.Data.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("expected the data to be an []interface but got %+v", resp.Model.Data)
-	}
-	for index, itemRaw := range itemsRaw {
-		item, ok := itemRaw.(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("expected index %d to be a map[string]interface{} but it wasn't", index)
-		}
-		id, ok := item["id"]
-		if !ok {
-			return nil, fmt.Errorf("expected an id field for item %d but didn't get one", index)
-		}
-		idRaw := id.(string)
-		namespaceId, err := namespaces.ParseNamespaceIDInsensitively(idRaw)
+	for index, item := range items {
+		namespaceId, err := namespaces.ParseNamespaceIDInsensitively(item.ID)
 		if err != nil {
-			return nil, fmt.Errorf("parsing %q for index %d: %+v", idRaw, index, err)
+			return nil, fmt.Errorf("parsing %q for index %d: %+v", item.ID, index, err)
 		}
 		namespaceIds = append(namespaceIds, *namespaceId)
 	}
+	sort.Slice(namespaceIds, func(i, j int) bool {
+		return strings.ToLower(namespaceIds[i].ID()) < strings.ToLower(namespaceIds[j].ID())
+	})
 
 	return &namespaceIds, nil
-
 }
@@ -2,8 +2,8 @@ package cleaners
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/hashicorp/go-azure-helpers/lang/pointer"
 	"github.com/hashicorp/go-azure-helpers/lang/response"
@@ -13,8 +13,7 @@ import (
 	"github.com/hashicorp/go-azure-sdk/resource-manager/paloaltonetworks/2022-08-29/localrules"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/paloaltonetworks/2022-08-29/localrulestacks"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/paloaltonetworks/2022-08-29/prefixlistlocalrulestack"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
 )
 
 type paloAltoLocalRulestackCleaner struct{}
@@ -25,17 +24,33 @@ func (paloAltoLocalRulestackCleaner) Name() string {
 	return "Removing Rulestack Rules"
 }
 
-func (paloAltoLocalRulestackCleaner) Cleanup(ctx context.Context, id commonids.ResourceGroupId, client *clients.AzureClient, opts options.Options) error {
-	rulestacksClient := client.ResourceManager.PaloAlto.LocalRulestacks
+func (paloAltoLocalRulestackCleaner) Cleanup(ctx context.Context, id commonids.ResourceGroupId, cc *CleanupContext) error {
+	rulestacksClient := cc.Client.ResourceManager.PaloAlto.LocalRulestacks
 
 	rulestacks, err := rulestacksClient.ListByResourceGroupComplete(ctx, id)
 	if err != nil {
-		log.Printf("[DEBUG] Error retrieving the Palo Alto Local Rulestacks within %s: %+v", id, err)
+		cc.Logger.Printf("[DEBUG] Error retrieving the Palo Alto Local Rulestacks within %s: %+v", id, err)
 	}
 
-	// Rules
-	rulesClient := client.ResourceManager.PaloAlto.LocalRules
+	// the Rulestack is only committed once the resources within it have been removed, so whether it's protected
+	// is checked up-front - the resources within a protected Rulestack are left alone
+	unprotected := make([]localrulestacks.LocalRulestackResource, 0)
 	for _, rg := range rulestacks.Items {
+		req := gateway.Request{
+			Operation: gateway.OperationCommit,
+			Target:    localrulestacks.NewLocalRulestackID(id.SubscriptionId, id.ResourceGroupName, pointer.From(rg.Name)).ID(),
+			Tags:      rg.Tags,
+		}
+		if reason := cc.Gateway.Blocked(req); reason != nil {
+			cc.Gateway.Skip(ctx, req, *reason)
+			continue
+		}
+		unprotected = append(unprotected, rg)
+	}
+
+	// Rules
+	rulesClient := cc.Client.ResourceManager.PaloAlto.LocalRules
+	for _, rg := range unprotected {
 		rulestackId := localrules.NewLocalRulestackID(id.SubscriptionId, id.ResourceGroupName, pointer.From(rg.Name))
 		rulesInRulestack, err := rulesClient.ListByLocalRulestacks(ctx, rulestackId)
 		if err != nil {
@@ -51,31 +66,35 @@ func (paloAltoLocalRulestackCleaner) Cleanup(ctx context.Context, id commonids.R
 					return fmt.Errorf("parsing rule %s: %+v", pointer.From(v.Id), err)
 				}
 
-				if !opts.ActuallyDelete {
-					log.Printf("[DEBUG] Would have deleted the Local Rule for %s..", *ruleId)
+				req := gateway.Request{
+					Operation: gateway.OperationDelete,
+					Target:    ruleId.ID(),
+				}
+				err = cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+					_, err := rulesClient.Delete(ctx, *ruleId)
+					return err
+				})
+				if errors.Is(err, gateway.ErrBlocked) {
 					continue
 				}
-
-				log.Printf("[DEBUG] Deleting %s..", *ruleId)
-				if _, err := rulesClient.Delete(ctx, *ruleId); err != nil {
+				if err != nil {
 					// (@jackofallops) Commit process can get stuck in an unmanageable state, results in need to contact PA Support
 					// Switching to non-blocking on failure but reporting error
 					// return fmt.Errorf("deleting rule %s from rulestack %s: %+v", ruleId, id, err)
-					log.Printf("[ERROR] deleting rule %s from rulestack %s: %+v", ruleId, rulestackId, err)
-					log.Printf("[DEBUG] Support ticket required to remove %s", rulestackId)
+					cc.Logger.Printf("[ERROR] deleting rule %s from rulestack %s: %+v", ruleId, rulestackId, err)
+					cc.Logger.Printf("[DEBUG] Support ticket required to remove %s", rulestackId)
 					return nil
 				}
-				log.Printf("[DEBUG] Deleting %s..", *ruleId)
 			}
 		}
-		if _, err := rulestacksClient.Commit(ctx, localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)); err != nil {
-			return fmt.Errorf("failed to commit changes to %s cannot delete, support ticket may be required to remove resource")
+		if err := commitLocalRulestack(ctx, cc, rulestacksClient, localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)); err != nil {
+			return err
 		}
 	}
 
 	// FQDN Lists
-	fqdnClient := client.ResourceManager.PaloAlto.FqdnListLocalRulestack
-	for _, rg := range rulestacks.Items {
+	fqdnClient := cc.Client.ResourceManager.PaloAlto.FqdnListLocalRulestack
+	for _, rg := range unprotected {
 		rulestackId := fqdnlistlocalrulestack.NewLocalRulestackID(id.SubscriptionId, id.ResourceGroupName, pointer.From(rg.Name))
 		fqdnInRulestack, err := fqdnClient.ListByLocalRulestacks(ctx, rulestackId)
 		if err != nil {
@@ -91,44 +110,62 @@ func (paloAltoLocalRulestackCleaner) Cleanup(ctx context.Context, id commonids.R
 					return fmt.Errorf("parsing %q as a fqdn list id: %+v", pointer.From(v.Id), err)
 				}
 
-				if !opts.ActuallyDelete {
-					log.Printf("[DEBUG] Would have deleted the FQDN for %s..", *fqdnId)
+				req := gateway.Request{
+					Operation: gateway.OperationDelete,
+					Target:    fqdnId.ID(),
+				}
+				err = cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+					_, err := fqdnClient.Delete(ctx, *fqdnId)
+					return err
+				})
+				if errors.Is(err, gateway.ErrBlocked) {
 					continue
 				}
-
-				log.Printf("[DEBUG] Deleting %s..", *fqdnId)
-				if _, err := fqdnClient.Delete(ctx, *fqdnId); err != nil {
+				if err != nil {
 					// (@jackofallops) Commit process can get stuck in an unmanageable state, results in need to contact PA Support
 					// Switching to non-blocking on failure but reporting error
 					// return fmt.Errorf("deleting fqdn %s from rulestack %s: %+v", fqdnId, id, err)
-					log.Printf("[ERROR] deleting fqdn %s from rulestack %s: %+v", fqdnId, rulestackId, err)
-					log.Printf("[DEBUG] Support ticket required to remove %s", rulestackId)
+					cc.Logger.Printf("[ERROR] deleting fqdn %s from rulestack %s: %+v", fqdnId, rulestackId, err)
+					cc.Logger.Printf("[DEBUG] Support ticket required to remove %s", rulestackId)
 					return nil
 				}
-				log.Printf("[DEBUG] Deleted %s..", *fqdnId)
 			}
 		}
-		if _, err := rulestacksClient.Commit(ctx, localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)); err != nil {
-			return fmt.Errorf("failed to commit changes to %s cannot delete, support ticket may be required to remove resource")
+		if err := commitLocalRulestack(ctx, cc, rulestacksClient, localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)); err != nil {
+			return err
 		}
 	}
 
 	// Certificates
-	certClient := client.ResourceManager.PaloAlto.CertificateObjectLocalRulestack
-	for _, rg := range rulestacks.Items {
+	certClient := cc.Client.ResourceManager.PaloAlto.CertificateObjectLocalRulestack
+	for _, rg := range unprotected {
 		// Remove inspection config - blocks removal of certs if referenced
 		rulestackId := certificateobjectlocalrulestack.NewLocalRulestackID(id.SubscriptionId, id.ResourceGroupName, pointer.From(rg.Name))
 		rs, err := rulestacksClient.Get(ctx, localrulestacks.LocalRulestackId(rulestackId))
 		if err != nil {
 			return err
 		}
+		if rs.Model == nil {
+			return fmt.Errorf("retrieving %s: model was nil", rulestackId)
+		}
 		sec := pointer.From(rs.Model.Properties.SecurityServices)
 		if pointer.From(sec.OutboundTrustCertificate) != "" || pointer.From(sec.OutboundUnTrustCertificate) != "" {
 			sec.OutboundTrustCertificate = nil
 			sec.OutboundUnTrustCertificate = nil
 			rs.Model.Properties.SecurityServices = pointer.To(sec)
 			localRulestackId := localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)
-			if err = rulestacksClient.CreateOrUpdateThenPoll(ctx, localRulestackId, *rs.Model); err != nil {
+			req := gateway.Request{
+				Operation: gateway.OperationUpdate,
+				Target:    localRulestackId.ID(),
+			}
+			err = cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+				return rulestacksClient.CreateOrUpdateThenPoll(ctx, localRulestackId, *rs.Model)
+			})
+			if errors.Is(err, gateway.ErrBlocked) {
+				// the certificates can't be removed whilst they're in use
+				continue
+			}
+			if err != nil {
 				return fmt.Errorf("removing certificate usage on %s: %+v", rulestackId, err)
 			}
 		}
@@ -138,60 +175,97 @@ func (paloAltoLocalRulestackCleaner) Cleanup(ctx context.Context, id commonids.R
 			if response.WasStatusCode(certInRulestack.HttpResponse, 500) || response.WasStatusCode(certInRulestack.HttpResponse, 502) || response.WasNotFound(certInRulestack.HttpResponse) {
 				continue
 			}
-			return fmt.Errorf("listing FQDNs for %s: %+v", id, err)
+			return fmt.Errorf("listing certificates for %s: %+v", id, err)
 		}
 		if model := certInRulestack.Model; model != nil {
 			for _, v := range *model {
-				if certId, err := certificateobjectlocalrulestack.ParseLocalRulestackCertificateID(pointer.From(v.Id)); err != nil && certId != nil {
-					if _, err := certClient.Delete(ctx, *certId); err != nil {
+				if certId, err := certificateobjectlocalrulestack.ParseLocalRulestackCertificateID(pointer.From(v.Id)); err == nil {
+					req := gateway.Request{
+						Operation: gateway.OperationDelete,
+						Target:    certId.ID(),
+					}
+					err := cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+						_, err := certClient.Delete(ctx, *certId)
+						return err
+					})
+					if errors.Is(err, gateway.ErrBlocked) {
+						continue
+					}
+					if err != nil {
 						// (@jackofallops) Commit process can get stuck in an unmanageable state, results in need to contact PA Support
 						// Switching to non-blocking on failure but reporting error
 						// return fmt.Errorf("deleting certificate %s from rulestack %s: %+v", fqdnId, id, err)
-						log.Printf("[ERROR] deleting certificate %s from rulestack %s: %+v", certId, rulestackId, err)
-						log.Printf("[DEBUG] Support ticket required to remove %s", rulestackId)
+						cc.Logger.Printf("[ERROR] deleting certificate %s from rulestack %s: %+v", certId, rulestackId, err)
+						cc.Logger.Printf("[DEBUG] Support ticket required to remove %s", rulestackId)
 						return nil
 					}
 				}
 			}
 		}
-		if _, err := rulestacksClient.Commit(ctx, localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)); err != nil {
-			return fmt.Errorf("failed to commit changes to %s cannot delete, support ticket may be required to remove resource")
+		if err := commitLocalRulestack(ctx, cc, rulestacksClient, localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)); err != nil {
+			return err
 		}
 	}
 
 	// Prefixes
-	prefixClient := client.ResourceManager.PaloAlto.PrefixListLocalRulestack
-	for _, rg := range rulestacks.Items {
+	prefixClient := cc.Client.ResourceManager.PaloAlto.PrefixListLocalRulestack
+	for _, rg := range unprotected {
 		rulestackId := prefixlistlocalrulestack.NewLocalRulestackID(id.SubscriptionId, id.ResourceGroupName, pointer.From(rg.Name))
 		prefixInRulestack, err := prefixClient.ListByLocalRulestacks(ctx, rulestackId)
 		if err != nil {
 			if response.WasStatusCode(prefixInRulestack.HttpResponse, 500) || response.WasStatusCode(prefixInRulestack.HttpResponse, 502) || response.WasNotFound(prefixInRulestack.HttpResponse) {
 				continue
 			}
-			return fmt.Errorf("listing FQDNs for %s: %+v", id, err)
+			return fmt.Errorf("listing prefixes for %s: %+v", id, err)
 		}
 		if model := prefixInRulestack.Model; model != nil {
 			for _, v := range *model {
-				if prefixId, err := prefixlistlocalrulestack.ParseLocalRulestackPrefixListIDInsensitively(pointer.From(v.Id)); err != nil && prefixId != nil {
-					if _, err := prefixClient.Delete(ctx, *prefixId); err != nil {
+				if prefixId, err := prefixlistlocalrulestack.ParseLocalRulestackPrefixListIDInsensitively(pointer.From(v.Id)); err == nil {
+					req := gateway.Request{
+						Operation: gateway.OperationDelete,
+						Target:    prefixId.ID(),
+					}
+					err := cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+						_, err := prefixClient.Delete(ctx, *prefixId)
+						return err
+					})
+					if errors.Is(err, gateway.ErrBlocked) {
+						continue
+					}
+					if err != nil {
 						// (@jackofallops) Commit process can get stuck in an unmanageable state, results in need to contact PA Support
 						// Switching to non-blocking on failure but reporting error
 						// return fmt.Errorf("deleting prefix %s from rulestack %s: %+v", prefixId, id, err)
-						log.Printf("[ERROR] deleting prefix %s from rulestack %s: %+v", prefixId, rulestackId, err)
-						log.Printf("[DEBUG] Support ticket required to remove %s", rulestackId)
+						cc.Logger.Printf("[ERROR] deleting prefix %s from rulestack %s: %+v", prefixId, rulestackId, err)
+						cc.Logger.Printf("[DEBUG] Support ticket required to remove %s", rulestackId)
 						return nil
 					}
 				}
 			}
 		}
-		if _, err := rulestacksClient.Commit(ctx, localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)); err != nil {
-			return fmt.Errorf("failed to commit changes to %s cannot delete, support ticket may be required to remove resource", rulestackId)
+		if err := commitLocalRulestack(ctx, cc, rulestacksClient, localrulestacks.NewLocalRulestackID(rulestackId.SubscriptionId, rulestackId.ResourceGroupName, rulestackId.LocalRulestackName)); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+func commitLocalRulestack(ctx context.Context, cc *CleanupContext, client *localrulestacks.LocalRulestacksClient, id localrulestacks.LocalRulestackId) error {
+	req := gateway.Request{
+		Operation: gateway.OperationCommit,
+		Target:    id.ID(),
+	}
+	err := cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+		_, err := client.Commit(ctx, id)
+		return err
+	})
+	if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+		return fmt.Errorf("failed to commit changes to %s cannot delete, support ticket may be required to remove resource: %+v", id, err)
+	}
+	return nil
+}
+
 func (paloAltoLocalRulestackCleaner) ResourceTypes() []string {
 	return []string{
 		"PaloAltoNetworks.Cloudngfw/firewalls",
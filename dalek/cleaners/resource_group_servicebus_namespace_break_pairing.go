@@ -2,8 +2,8 @@ package cleaners
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/hashicorp/go-azure-helpers/lang/response"
@@ -11,12 +11,15 @@ import (
 	servicebusV20220101Preview "github.com/hashicorp/go-azure-sdk/resource-manager/servicebus/2022-01-01-preview"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/servicebus/2022-01-01-preview/disasterrecoveryconfigs"
 	"github.com/hashicorp/go-azure-sdk/sdk/client/pollers"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
 )
 
 var _ ResourceGroupCleaner = serviceBusNamespaceBreakPairingCleaner{}
 
+// serviceBusBreakPairingPollInterval is how often the Disaster Recovery Config is checked once pairing has
+// been broken - this is a variable so that tests replaying a cassette don't need to wait
+var serviceBusBreakPairingPollInterval = 30 * time.Second
+
 type serviceBusNamespaceBreakPairingCleaner struct {
 }
 
@@ -24,28 +27,33 @@ func (serviceBusNamespaceBreakPairingCleaner) Name() string {
 	return "ServiceBus Namespace - Break Pairing"
 }
 
-func (serviceBusNamespaceBreakPairingCleaner) Cleanup(ctx context.Context, id commonids.ResourceGroupId, client *clients.AzureClient, opts options.Options) error {
-	serviceBusClient := client.ResourceManager.ServiceBus
+func (serviceBusNamespaceBreakPairingCleaner) Cleanup(ctx context.Context, id commonids.ResourceGroupId, cc *CleanupContext) error {
+	serviceBusClient := cc.Client.ResourceManager.ServiceBus
 	namespacesInResourceGroup, err := serviceBusClient.Namespaces.ListByResourceGroupComplete(ctx, id)
 	if err != nil {
-		log.Printf("[DEBUG] Error retrieving the ServiceBus Namespaces within %s: %+v", id, err)
+		cc.Logger.Printf("[DEBUG] Error retrieving the ServiceBus Namespaces within %s: %+v", id, err)
 	}
 
 	for _, namespace := range namespacesInResourceGroup.Items {
 		namespaceId, err := disasterrecoveryconfigs.ParseNamespaceIDInsensitively(*namespace.Id)
 		if err != nil {
-			log.Printf("[ERROR] Parsing ServiceBus Namespace ID %q: %+v", *namespace.Id, err)
+			cc.Logger.Printf("[ERROR] Parsing ServiceBus Namespace ID %q: %+v", *namespace.Id, err)
 			continue
 		}
-		log.Printf("[DEBUG] Finding Disaster Recovery Configs within %s", *namespaceId)
+		cc.Logger.Printf("[DEBUG] Finding Disaster Recovery Configs within %s", *namespaceId)
 		configs, err := serviceBusClient.DisasterRecoveryConfigs.ListComplete(ctx, *namespaceId)
 		if err != nil {
 			return fmt.Errorf("finding Disaster Recovery Configs within %s: %+v", *namespaceId, err)
 		}
 
 		for _, config := range configs.Items {
-			if props := config.Properties; props == nil || *props.Role == disasterrecoveryconfigs.RoleDisasterRecoverySecondary {
-				log.Printf("[DEBUG] Skipping %s for %s: Role is %q", *config.Id, *namespace.Id, *props.Role)
+			props := config.Properties
+			if props == nil || props.Role == nil {
+				cc.Logger.Printf("[DEBUG] Skipping %s for %s: Role is unknown", *config.Id, *namespace.Id)
+				continue
+			}
+			if *props.Role == disasterrecoveryconfigs.RoleDisasterRecoverySecondary {
+				cc.Logger.Printf("[DEBUG] Skipping %s for %s: Role is %q", *config.Id, *namespace.Id, *props.Role)
 				continue
 			}
 			configId, err := disasterrecoveryconfigs.ParseDisasterRecoveryConfigIDInsensitively(*config.Id)
@@ -53,27 +61,32 @@ func (serviceBusNamespaceBreakPairingCleaner) Cleanup(ctx context.Context, id co
 				return fmt.Errorf("parsing the Disaster Recovery Config ID %q: %+v", *config.Id, err)
 			}
 
-			if !opts.ActuallyDelete {
-				log.Printf("[DEBUG] Would have broken the pairing for %s..", *configId)
-				continue
+			// Disaster Recovery Configs don't support tags, so are protected by the tags on their Namespace
+			req := gateway.Request{
+				Operation: gateway.OperationBreakPairing,
+				Target:    configId.ID(),
+				Tags:      namespace.Tags,
 			}
-
-			log.Printf("[DEBUG] Breaking Pairing for %s..", *configId)
-			if resp, err := serviceBusClient.DisasterRecoveryConfigs.BreakPairing(ctx, *configId); err != nil {
-				if !response.WasNotFound(resp.HttpResponse) {
-					return fmt.Errorf("breaking pairing for %s: %+v", *configId, err)
+			err = cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+				if resp, err := serviceBusClient.DisasterRecoveryConfigs.BreakPairing(ctx, *configId); err != nil {
+					if !response.WasNotFound(resp.HttpResponse) {
+						return fmt.Errorf("breaking pairing for %s: %+v", *configId, err)
+					}
 				}
+				cc.Logger.Printf("[DEBUG] Polling until Pairing is broken for %s..", *configId)
+				pollerType := serviceBusNamespaceBreakPairingPoller{
+					client:   serviceBusClient,
+					configId: *configId,
+				}
+				poller := pollers.NewPoller(pollerType, serviceBusBreakPairingPollInterval, pollers.DefaultNumberOfDroppedConnectionsToAllow)
+				if err := poller.PollUntilDone(ctx); err != nil {
+					return fmt.Errorf("polling until the Pairing is broken for %s: %+v", *configId, err)
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+				return err
 			}
-			log.Printf("[DEBUG] Polling until Pairing is broken for %s..", *configId)
-			pollerType := serviceBusNamespaceBreakPairingPoller{
-				client:   serviceBusClient,
-				configId: *configId,
-			}
-			poller := pollers.NewPoller(pollerType, 30*time.Second, pollers.DefaultNumberOfDroppedConnectionsToAllow)
-			if err := poller.PollUntilDone(ctx); err != nil {
-				return fmt.Errorf("polling until the Pairing is broken for %s: %+v", *configId, err)
-			}
-			log.Printf("[DEBUG] Pairing Broken for %s", *configId)
 		}
 	}
 	return nil
@@ -116,6 +129,6 @@ func (s serviceBusNamespaceBreakPairingPoller) Poll(ctx context.Context) (*polle
 
 	return &pollers.PollResult{
 		Status:       pollers.PollingStatusInProgress,
-		PollInterval: 30 * time.Second,
+		PollInterval: serviceBusBreakPairingPollInterval,
 	}, nil
 }
@@ -4,18 +4,19 @@ import (
 	"context"
 
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
 )
 
-var ResourceGroupCleaners = []ResourceGroupCleaner{
-	// NOTE: the ordering is important here, we want to remove Locks first because a Write or Delete lock
-	// would prevent us from doing anything else, so that needs to be first.
-	removeLocksFromResourceGroupCleaner{},
-	removeDataProtectionFromResourceGroupCleaner{},
-	notificationHubNamespacesCleaner{},
-	paloAltoLocalRulestackCleaner{},
-	serviceBusNamespaceBreakPairingCleaner{},
+// DefaultResourceGroupCleaners returns the built-in Resource Group Cleaners
+func DefaultResourceGroupCleaners() []ResourceGroupCleaner {
+	return []ResourceGroupCleaner{
+		// NOTE: the ordering is important here, we want to remove Locks first because a Write or Delete lock
+		// would prevent us from doing anything else, so that needs to be first.
+		removeLocksFromResourceGroupCleaner{},
+		removeDataProtectionFromResourceGroupCleaner{},
+		notificationHubNamespacesCleaner{},
+		paloAltoLocalRulestackCleaner{},
+		serviceBusNamespaceBreakPairingCleaner{},
+	}
 }
 
 type ResourceGroupCleaner interface {
@@ -23,8 +24,9 @@ type ResourceGroupCleaner interface {
 	Name() string
 
 	// Cleanup performs the cleanup operation for this ResourceGroupCleaner
-	Cleanup(ctx context.Context, id commonids.ResourceGroupId, client *clients.AzureClient, opts options.Options) error
+	Cleanup(ctx context.Context, id commonids.ResourceGroupId, cc *CleanupContext) error
 
-	// ResourceTypes returns the list of Resource Types supported by this ResourceGroupCleaner
+	// ResourceTypes returns the list of Resource Types supported by this ResourceGroupCleaner, this
+	// ResourceGroupCleaner is only run against Resource Groups containing at least one of these
 	ResourceTypes() []string
 }
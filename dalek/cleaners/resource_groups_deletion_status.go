@@ -0,0 +1,232 @@
+package cleaners
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/hashicorp/go-azure-sdk/sdk/client"
+	"github.com/hashicorp/go-azure-sdk/sdk/odata"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// deletionStatusPollInterval is how long to wait between checking the status of the Resource Group deletions
+var deletionStatusPollInterval = 30 * time.Second
+
+// pendingDeletion is a Resource Group deletion which has been accepted by Resource Manager, but which may
+// still fail asynchronously
+type pendingDeletion struct {
+	ID commonids.ResourceGroupId
+
+	// OperationURL is the URL of the long-running operation returned when the deletion was issued
+	OperationURL string
+
+	// Tags are the Tags on the Resource Group, so that the deletion can be retried through the Gateway
+	Tags *map[string]string
+}
+
+// failedDeletion is a Resource Group deletion which failed asynchronously
+type failedDeletion struct {
+	pendingDeletion
+
+	Failure report.DeletionFailure
+}
+
+// pendingDeletions is a thread-safe list of the deletions issued during a run, since each Resource Group
+// is cleaned up within its own time budget
+type pendingDeletions struct {
+	lock  sync.Mutex
+	items []pendingDeletion
+}
+
+func (p *pendingDeletions) add(item pendingDeletion) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.items = append(p.items, item)
+}
+
+func (p *pendingDeletions) list() []pendingDeletion {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	out := make([]pendingDeletion, len(p.items))
+	copy(out, p.items)
+	return out
+}
+
+// operationURLFromResponse returns the URL of the long-running operation returned when issuing a deletion,
+// or an empty string when the deletion completed synchronously
+func operationURLFromResponse(resp *http.Response) string {
+	if resp == nil || resp.StatusCode != http.StatusAccepted {
+		return ""
+	}
+	if v := resp.Header.Get("Azure-AsyncOperation"); v != "" {
+		return v
+	}
+	return resp.Header.Get("Location")
+}
+
+// checkPendingDeletions polls the long-running operation for each of the deletions until they've all completed
+// or the DeletionStatusTimeout has elapsed, returning the ARM error for each deletion which failed - since the
+// deletions are issued without polling, this is the only way to find out why they failed.
+func checkPendingDeletions(ctx context.Context, cc *CleanupContext, pending []pendingDeletion) ([]failedDeletion, error) {
+	failed := make([]failedDeletion, 0)
+	if len(pending) == 0 {
+		return failed, nil
+	}
+
+	cc.Logger.Printf("[DEBUG] Checking the status of %d Resource Group deletions..", len(pending))
+	deadline := time.Now().Add(cc.Options.Diagnostics.DeletionStatusTimeout)
+	for {
+		inProgress := make([]pendingDeletion, 0)
+		for _, deletion := range pending {
+			failure, completed, err := deletionOperationStatus(ctx, cc, deletion)
+			if err != nil {
+				cc.Logger.Printf("[DEBUG]   Error checking the status of the deletion of %s: %+v", deletion.ID, err)
+				continue
+			}
+			if !completed {
+				inProgress = append(inProgress, deletion)
+				continue
+			}
+			if failure != nil {
+				cc.Logger.Printf("[DEBUG]   Deleting Resource Group %q failed with %q: %s", deletion.ID.ResourceGroupName, failure.Code, failure.Message)
+				failed = append(failed, failedDeletion{
+					pendingDeletion: deletion,
+					Failure:         *failure,
+				})
+			}
+		}
+
+		pending = inProgress
+		if len(pending) == 0 || time.Now().Add(deletionStatusPollInterval).After(deadline) {
+			break
+		}
+
+		cc.Logger.Printf("[DEBUG] %d Resource Group deletions are still in progress, checking again in %s..", len(pending), deletionStatusPollInterval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(deletionStatusPollInterval):
+		}
+	}
+
+	for _, deletion := range pending {
+		cc.Logger.Printf("[DEBUG]   Deletion of Resource Group %q is still in progress", deletion.ID.ResourceGroupName)
+	}
+	return failed, nil
+}
+
+type operationStatusResponse struct {
+	// Status is returned by the `Azure-AsyncOperation` endpoint, but not the `Location` endpoint (which uses the
+	// HTTP Status Code instead)
+	Status string                  `json:"status"`
+	Error  *operationStatusFailure `json:"error"`
+}
+
+type operationStatusFailure struct {
+	Code    string                   `json:"code"`
+	Message string                   `json:"message"`
+	Target  string                   `json:"target"`
+	Details []operationStatusFailure `json:"details"`
+}
+
+// deletionOperationStatus retrieves the status of the long-running operation for the deletion, returning
+// whether it's completed - and if it failed, the details of the failure.
+func deletionOperationStatus(ctx context.Context, cc *CleanupContext, deletion pendingDeletion) (*report.DeletionFailure, bool, error) {
+	operationUrl, err := url.Parse(deletion.OperationURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("parsing the operation URL %q: %+v", deletion.OperationURL, err)
+	}
+
+	opts := client.RequestOptions{
+		ContentType: "application/json; charset=utf-8",
+		ExpectedStatusCodes: []int{
+			http.StatusOK,
+			http.StatusAccepted,
+			http.StatusNoContent,
+		},
+		HttpMethod: http.MethodGet,
+		Path:       operationUrl.Path,
+	}
+	sdkClient := cc.Client.ResourceManager.ResourcesGroupsClient.Client
+	req, err := sdkClient.NewRequest(ctx, opts)
+	if err != nil {
+		return nil, false, fmt.Errorf("building request: %+v", err)
+	}
+	req.URL.RawQuery = operationUrl.RawQuery
+	// a failed operation is returned as a client error, which contains the details of the failure
+	req.ValidStatusFunc = func(resp *http.Response, _ *odata.OData) bool {
+		return resp.StatusCode >= 400 && resp.StatusCode < 500
+	}
+
+	resp, err := req.Execute(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("retrieving the operation status: %+v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading the operation status: %+v", err)
+	}
+	return parseOperationStatus(deletion.ID, resp.StatusCode, body)
+}
+
+// parseOperationStatus parses the response from the long-running operation for the deletion of the Resource
+// Group, returning whether it's completed - and if it failed, the details of the failure.
+func parseOperationStatus(id commonids.ResourceGroupId, statusCode int, body []byte) (*report.DeletionFailure, bool, error) {
+	var status operationStatusResponse
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &status); err != nil {
+			return nil, false, fmt.Errorf("parsing the operation status %q: %+v", string(body), err)
+		}
+	}
+
+	switch {
+	case strings.EqualFold(status.Status, "Failed"), strings.EqualFold(status.Status, "Canceled"), statusCode >= 400:
+		failure := report.DeletionFailure{
+			ResourceGroup: id.ID(),
+			Code:          status.Status,
+		}
+		if status.Error != nil {
+			failure.Code = status.Error.Code
+			failure.Message = status.Error.Message
+			failure.Details = flattenOperationStatusFailures(status.Error.Details)
+		}
+		if failure.Code == "" {
+			failure.Code = http.StatusText(statusCode)
+		}
+		return &failure, true, nil
+
+	case status.Status != "" && !strings.EqualFold(status.Status, "Succeeded"):
+		return nil, false, nil
+
+	case statusCode == http.StatusAccepted:
+		return nil, false, nil
+	}
+
+	return nil, true, nil
+}
+
+// flattenOperationStatusFailures returns each of the inner errors, including those nested within them
+func flattenOperationStatusFailures(input []operationStatusFailure) []report.ErrorDetail {
+	out := make([]report.ErrorDetail, 0)
+	for _, item := range input {
+		out = append(out, report.ErrorDetail{
+			Code:    item.Code,
+			Message: item.Message,
+			Target:  item.Target,
+		})
+		out = append(out, flattenOperationStatusFailures(item.Details)...)
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package cleaners
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+func TestDeleteResourceGroupsReportsAsyncFailures(t *testing.T) {
+	disableDelays(t)
+	cassette, err := transports.LoadCassette(filepath.Join("testdata", "cassettes", "resource_groups_delete_failed.json"))
+	if err != nil {
+		t.Fatalf("loading cassette: %+v", err)
+	}
+	replayer := transports.NewReplayer(*cassette)
+	client := testclient.New(t, replayer)
+	r := report.New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cleaner := NewDeleteResourceGroupsCleaner([]ResourceGroupCleaner{})
+	if err := cleaner.Cleanup(ctx, commonids.NewSubscriptionID(testclient.SubscriptionID), newCleanupContext(client, r, faultOptions)); err != nil {
+		t.Fatalf("running the cleaner: %+v", err)
+	}
+	assertReplayed(t, replayer, r)
+
+	failures := r.DeletionFailures()
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 deletion failure but got %d", len(failures))
+	}
+	failure := failures[0]
+	if expected := commonids.NewResourceGroupID(testclient.SubscriptionID, "acctestRG-dalek").ID(); failure.ResourceGroup != expected {
+		t.Errorf("expected the failure to be for %q but got %q", expected, failure.ResourceGroup)
+	}
+	if codes := failure.Codes(); len(codes) != 2 || codes[0] != "ResourceGroupDeletionBlocked" || codes[1] != "InUseSubnetCannotBeDeleted" {
+		t.Errorf("expected the codes `ResourceGroupDeletionBlocked` and `InUseSubnetCannotBeDeleted` but got %q", codes)
+	}
+	if len(failure.Details) == 0 || failure.Details[0].Target == "" {
+		t.Errorf("expected the inner error to identify the Virtual Network but got %+v", failure.Details)
+	}
+}
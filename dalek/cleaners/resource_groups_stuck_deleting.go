@@ -0,0 +1,156 @@
+package cleaners
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/graph"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// knownDeletionBlockers are the Resource Types (in lower-case) which are known to prevent a Resource Group
+// from being deleted, along with why
+var knownDeletionBlockers = map[string]string{
+	"microsoft.dataprotection/backupvaults":                              "Backup Instances must be removed (and Soft Delete disabled) before the Backup Vault can be deleted",
+	"microsoft.eventhub/namespaces":                                      "a Geo-Disaster Recovery pairing must be broken before the Namespace can be deleted",
+	"microsoft.keyvault/managedhsms":                                     "Managed HSMs are soft-deleted and must be purged",
+	"microsoft.machinelearningservices/workspaces":                       "Workspaces are soft-deleted and must be purged",
+	"microsoft.netapp/netappaccounts":                                    "Volume Replications, Volumes and Capacity Pools must be removed before the NetApp Account can be deleted",
+	"microsoft.network/applicationgatewaywebapplicationfirewallpolicies": "the Policy may still be associated with an Application Gateway",
+	"microsoft.network/networkinterfaces":                                "the Network Interface may still be attached to a Virtual Machine or Private Endpoint",
+	"microsoft.network/networksecurityperimeters":                        "resources may still be associated with the Network Security Perimeter",
+	"microsoft.network/privateendpoints":                                 "the Private Endpoint may still be connected to a resource in another Resource Group",
+	"microsoft.network/virtualnetworks":                                  "a Subnet may still be delegated or in use by a Service Association Link",
+	"microsoft.notificationhubs/namespaces":                              "Notification Hubs must be removed before the Namespace can be deleted",
+	"microsoft.operationalinsights/workspaces":                           "Linked Services (e.g. an Automation Account) must be unlinked before the Workspace can be deleted",
+	"microsoft.recoveryservices/vaults":                                  "protected Backup Items (including soft-deleted items) must be removed before the Vault can be deleted",
+	"microsoft.servicebus/namespaces":                                    "a Geo-Disaster Recovery pairing must be broken before the Namespace can be deleted",
+	"microsoft.storagesync/storagesyncservices":                          "Sync Groups, Cloud Endpoints and Registered Servers must be removed before the Storage Sync Service can be deleted",
+	"paloaltonetworks.cloudngfw/localrulestacks":                         "the Local Rulestack may still be associated with a Firewall",
+}
+
+// diagnoseStuckDeletions determines which of the Resource Groups have been Deleting for longer than the
+// threshold and records which resources remain within them (grouped by Resource Type) into the report,
+// flagging any Resource Types which are known to block deletion.
+func diagnoseStuckDeletions(ctx context.Context, cc *CleanupContext, ids []commonids.ResourceGroupId) error {
+	threshold := cc.Options.Diagnostics.StuckDeletionThreshold
+	if threshold <= 0 || len(ids) == 0 {
+		return nil
+	}
+
+	// the change history is only available from Resource Graph, without it every Resource Group which is being
+	// deleted would be reported as stuck
+	if !cc.Client.Profile.SupportsResourceGraph() {
+		cc.Logger.Printf("[DEBUG] Not diagnosing the %d Resource Groups which are being deleted since Resource Graph isn't available in the API Profile %q", len(ids), cc.Client.Profile.Name)
+		return nil
+	}
+
+	cc.Logger.Printf("[DEBUG] Diagnosing %d Resource Groups which are being deleted..", len(ids))
+	deletingSince, err := resourceGroupsDeletingSince(ctx, cc, ids)
+	if err != nil {
+		return fmt.Errorf("determining when the Resource Groups started deleting: %+v", err)
+	}
+
+	for _, id := range ids {
+		// when there's no record of the Resource Group starting to delete it predates the change history
+		// retained by Resource Graph (14 days), so it's been Deleting for longer than any sensible threshold
+		since, known := deletingSince[strings.ToLower(id.ID())]
+		if known {
+			if elapsed := time.Since(since); elapsed < threshold {
+				cc.Logger.Printf("[DEBUG]   Resource Group %q has been Deleting for %s, which is within the threshold of %s", id.ResourceGroupName, elapsed.Round(time.Minute), threshold)
+				continue
+			}
+		}
+
+		resources, err := cc.Inventory.InResourceGroup(ctx, id.ResourceGroupName)
+		if err != nil {
+			return fmt.Errorf("listing the resources remaining within %s: %+v", id, err)
+		}
+
+		stuck := report.StuckDeletion{
+			ResourceGroup: id.ID(),
+			Remaining:     summariseRemainingResources(resources),
+		}
+		if known {
+			stuck.DeletingSince = &since
+		}
+		cc.Logger.Printf("[DEBUG]   Resource Group %q is stuck Deleting with %d resources remaining", id.ResourceGroupName, len(resources))
+		cc.Recorder.RecordStuckDeletion(stuck)
+	}
+
+	return nil
+}
+
+// summariseRemainingResources groups the resources by Resource Type, ordered with the known blockers first
+// and then by the number of resources
+func summariseRemainingResources(resources []graph.Resource) []report.RemainingResources {
+	byType := make(map[string]*report.RemainingResources)
+	for _, resource := range resources {
+		key := strings.ToLower(resource.Type)
+		if existing, ok := byType[key]; ok {
+			existing.Count++
+			continue
+		}
+		byType[key] = &report.RemainingResources{
+			Type:         resource.Type,
+			Count:        1,
+			KnownBlocker: knownDeletionBlockers[key],
+		}
+	}
+
+	out := make([]report.RemainingResources, 0, len(byType))
+	for _, item := range byType {
+		out = append(out, *item)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].KnownBlocker != "") != (out[j].KnownBlocker != "") {
+			return out[i].KnownBlocker != ""
+		}
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return strings.ToLower(out[i].Type) < strings.ToLower(out[j].Type)
+	})
+	return out
+}
+
+type resourceGroupDeletingSince struct {
+	ResourceGroupID string    `json:"targetResourceId"`
+	DeletingSince   time.Time `json:"deletingSince"`
+}
+
+// resourceGroupsDeletingSince returns when each of the Resource Groups most recently started Deleting, keyed
+// by the lower-cased Resource ID - Resource Groups which aren't present have no record of this within the
+// change history retained by Resource Graph.
+func resourceGroupsDeletingSince(ctx context.Context, cc *CleanupContext, ids []commonids.ResourceGroupId) (map[string]time.Time, error) {
+	resourceGroupIds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		resourceGroupIds = append(resourceGroupIds, id.ID())
+	}
+
+	query := graph.Query{
+		Query: fmt.Sprintf(`
+resourcecontainerchanges
+| extend targetResourceId = tostring(properties.targetResourceId)
+| where targetResourceId in~ (%s)
+| extend provisioningState = tostring(properties.changes['properties.provisioningState'].newValue)
+| where provisioningState =~ 'Deleting'
+| summarize deletingSince = max(todatetime(properties.changeAttributes.timestamp)) by targetResourceId
+`, graph.Strings(resourceGroupIds)),
+		Scope: graph.SubscriptionScope(cc.Client.SubscriptionID),
+	}
+	rows, err := graph.Run[resourceGroupDeletingSince](ctx, graph.NewClient(cc.Client.ResourceManager.ResourceGraphClient), query)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]time.Time)
+	for _, row := range rows {
+		out[strings.ToLower(row.ResourceGroupID)] = row.DeletingSince
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+package cleaners
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/graph"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+func TestSummariseRemainingResources(t *testing.T) {
+	testData := []struct {
+		name      string
+		resources []graph.Resource
+		expected  []report.RemainingResources
+	}{
+		{
+			name:      "empty",
+			resources: []graph.Resource{},
+			expected:  []report.RemainingResources{},
+		},
+		{
+			name: "grouped by type insensitively",
+			resources: []graph.Resource{
+				{Type: "Microsoft.Storage/storageAccounts"},
+				{Type: "microsoft.storage/storageaccounts"},
+				{Type: "Microsoft.Web/sites"},
+			},
+			expected: []report.RemainingResources{
+				{Type: "Microsoft.Storage/storageAccounts", Count: 2},
+				{Type: "Microsoft.Web/sites", Count: 1},
+			},
+		},
+		{
+			name: "known blockers first",
+			resources: []graph.Resource{
+				{Type: "Microsoft.Storage/storageAccounts"},
+				{Type: "Microsoft.Storage/storageAccounts"},
+				{Type: "Microsoft.Network/virtualNetworks"},
+				{Type: "Microsoft.Compute/disks"},
+				{Type: "Microsoft.RecoveryServices/vaults"},
+				{Type: "Microsoft.RecoveryServices/vaults"},
+			},
+			expected: []report.RemainingResources{
+				{Type: "Microsoft.RecoveryServices/vaults", Count: 2, KnownBlocker: knownDeletionBlockers["microsoft.recoveryservices/vaults"]},
+				{Type: "Microsoft.Network/virtualNetworks", Count: 1, KnownBlocker: knownDeletionBlockers["microsoft.network/virtualnetworks"]},
+				{Type: "Microsoft.Storage/storageAccounts", Count: 2},
+				{Type: "Microsoft.Compute/disks", Count: 1},
+			},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			actual := summariseRemainingResources(v.resources)
+			if !reflect.DeepEqual(actual, v.expected) {
+				t.Fatalf("expected %+v but got %+v", v.expected, actual)
+			}
+		})
+	}
+}
@@ -4,16 +4,19 @@ import (
 	"context"
 
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
 )
 
-var SubscriptionCleaners = []SubscriptionCleaner{
-	deleteNetAppSubscriptionCleaner{},
-	deleteStorageSyncSubscriptionCleaner{},
-	deleteResourceGroupsInSubscriptionCleaner{},
-	purgeSoftDeletedManagedHSMsInSubscriptionCleaner{},
-	purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner{},
+// DefaultSubscriptionCleaners returns the built-in Subscription Cleaners, where `resourceGroupCleaners`
+// are run against each Resource Group prior to it being deleted
+func DefaultSubscriptionCleaners(resourceGroupCleaners []ResourceGroupCleaner) []SubscriptionCleaner {
+	return []SubscriptionCleaner{
+		deleteNetAppSubscriptionCleaner{},
+		deleteStorageSyncSubscriptionCleaner{},
+		NewDeleteResourceGroupsCleaner(resourceGroupCleaners),
+		deleteExpiredInSubscriptionCleaner{},
+		purgeSoftDeletedManagedHSMsInSubscriptionCleaner{},
+		purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner{},
+	}
 }
 
 type SubscriptionCleaner interface {
@@ -21,5 +24,5 @@ type SubscriptionCleaner interface {
 	Name() string
 
 	// Cleanup performs this clean-up operation against the given Subscription
-	Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, client *clients.AzureClient, opts options.Options) error
+	Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, cc *CleanupContext) error
 }
@@ -0,0 +1,512 @@
+package cleaners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/lang/pointer"
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/resourceids"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resourcegroups"
+	"github.com/hashicorp/go-azure-sdk/sdk/client"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/graph"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+)
+
+var _ SubscriptionCleaner = deleteExpiredInSubscriptionCleaner{}
+
+// deleteExpiredInSubscriptionCleaner deletes the Resource Groups and resources anywhere within the Subscription
+// whose expiry tag (e.g. `ExpiresOn=2026-11-01`) has been reached - regardless of the Prefix, since these are
+// typically created by hand. This only runs when `Expiry` is enabled in the Options.
+type deleteExpiredInSubscriptionCleaner struct{}
+
+func (d deleteExpiredInSubscriptionCleaner) Name() string {
+	return "Delete Expired Resources in Subscription"
+}
+
+// ResourceTypes returns the Resource Graph resource type, since the expired items are found using Resource Graph
+func (d deleteExpiredInSubscriptionCleaner) ResourceTypes() []string {
+	return []string{
+		"Microsoft.ResourceGraph/resources",
+	}
+}
+
+func (d deleteExpiredInSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, cc *CleanupContext) error {
+	if !cc.Options.Expiry.Enabled {
+		cc.Logger.Printf("[DEBUG] Deleting expired resources isn't enabled - Skipping..")
+		return nil
+	}
+	tag := cc.Options.Expiry.Tag
+	if tag == "" {
+		tag = options.DefaultExpiryTag
+	}
+
+	cc.Logger.Printf("[DEBUG] Finding the resources within %s which have expired according to the tag %q..", subscriptionId, tag)
+	expired, err := findExpired(ctx, cc, subscriptionId, tag, time.Now())
+	if err != nil {
+		return fmt.Errorf("finding the expired resources: %+v", err)
+	}
+
+	// the expiry tag bypasses the Prefix, so the same limits apply as for the Resource Groups matching it
+	radius := BlastRadius{
+		Description:         "expired Resource Groups and resources",
+		Count:               len(expired.ResourceGroups) + len(expired.Resources),
+		ResourceGroups:      expired.affectedResourceGroups(),
+		TotalResourceGroups: expired.TotalResourceGroups,
+	}
+	if err := CheckBlastRadius(cc, radius); err != nil {
+		return err
+	}
+
+	for _, protected := range expired.Protected {
+		req := gateway.Request{
+			Operation:    gateway.OperationDelete,
+			Target:       protected.ID.ID(),
+			IgnorePrefix: true,
+		}
+		cc.Gateway.Skip(ctx, req, fmt.Sprintf("contains %q which is protected by the tag %q", protected.ProtectedBy, protected.Tag))
+	}
+	for _, protected := range expired.ProtectedResources {
+		req := gateway.Request{
+			Operation:    gateway.OperationDelete,
+			Target:       protected.ID,
+			IgnorePrefix: true,
+		}
+		cc.Gateway.Skip(ctx, req, protected.Reason)
+	}
+
+	pending := &pendingDeletions{}
+	for _, item := range expired.ResourceGroups {
+		cc.Logger.Printf("[DEBUG] Resource Group %q expired on %s", item.ID.ResourceGroupName, item.ExpiresOn.Format(time.DateOnly))
+		cc.Events().Notify(ctx, events.Event{
+			Type:   events.TypeResourceDiscovered,
+			Target: item.ID.ID(),
+			Reason: fmt.Sprintf("expired on %s", item.ExpiresOn.Format(time.DateOnly)),
+		})
+		if cc.Options.Quarantine.Enabled {
+			ready, err := quarantineResourceGroup(ctx, cc, item.ID, time.Now(), true)
+			if err != nil {
+				if !errors.Is(err, gateway.ErrBlocked) {
+					cc.Logger.Printf("[DEBUG]   Error quarantining Resource Group %q: %s", item.ID.ResourceGroupName, err)
+				}
+				continue
+			}
+			if !ready {
+				continue
+			}
+		}
+		deleteExpiredResourceGroup(ctx, cc, item, pending)
+	}
+
+	apiVersions := make(map[string]string)
+	for _, item := range expired.Resources {
+		cc.Logger.Printf("[DEBUG] Resource %q expired on %s", item.ID, item.ExpiresOn.Format(time.DateOnly))
+		cc.Events().Notify(ctx, events.Event{
+			Type:   events.TypeResourceDiscovered,
+			Target: item.ID,
+			Reason: fmt.Sprintf("expired on %s", item.ExpiresOn.Format(time.DateOnly)),
+		})
+		if cc.Options.Quarantine.Enabled {
+			// only Resource Groups can be marked for deletion, so the resource is left for a run without quarantine
+			req := gateway.Request{
+				Operation:    gateway.OperationDelete,
+				Target:       item.ID,
+				IgnorePrefix: true,
+			}
+			cc.Gateway.Skip(ctx, req, "quarantine only applies to Resource Groups")
+			continue
+		}
+		if err := deleteExpiredResource(ctx, cc, subscriptionId, item, apiVersions); err != nil && !errors.Is(err, gateway.ErrBlocked) {
+			cc.Logger.Printf("[DEBUG]   Error during deletion of %q: %s", item.ID, err)
+		}
+	}
+
+	failures, err := checkPendingDeletions(ctx, cc, pending.list())
+	if err != nil {
+		return fmt.Errorf("checking the status of the Resource Group deletions: %+v", err)
+	}
+	for _, failed := range failures {
+		cc.Recorder.RecordDeletionFailure(failed.Failure)
+	}
+
+	return nil
+}
+
+// expiredResourceGroup is a Resource Group whose expiry tag has been reached
+type expiredResourceGroup struct {
+	ID        commonids.ResourceGroupId
+	ExpiresOn time.Time
+	Tags      map[string]string
+}
+
+// expiredResource is a resource whose expiry tag has been reached, which isn't within an expired Resource Group
+type expiredResource struct {
+	ID        string
+	Type      string
+	ExpiresOn time.Time
+	Tags      map[string]string
+}
+
+type expiredItems struct {
+	ResourceGroups []expiredResourceGroup
+	Resources      []expiredResource
+
+	// Protected are the expired Resource Groups which contain a resource with a protection tag
+	Protected []ProtectedResourceGroup
+
+	// ProtectedResources are the expired resources within a Resource Group which is protected, either by its own
+	// tags or because it contains a resource with a protection tag
+	ProtectedResources []protectedExpiredResource
+
+	// TotalResourceGroups is the total number of Resource Groups within the Subscription
+	TotalResourceGroups int
+}
+
+// affectedResourceGroups returns the number of Resource Groups which are either expired, or contain an expired
+// resource which would be deleted
+func (e expiredItems) affectedResourceGroups() int {
+	names := make(map[string]struct{})
+	for _, item := range e.ResourceGroups {
+		names[strings.ToLower(item.ID.ResourceGroupName)] = struct{}{}
+	}
+	for _, item := range e.Resources {
+		if parsed, err := resourceids.ParseAzureResourceID(item.ID); err == nil {
+			names[strings.ToLower(parsed.ResourceGroup)] = struct{}{}
+		}
+	}
+	return len(names)
+}
+
+// protectedExpiredResource is an expired resource which isn't deleted since its Resource Group is protected
+type protectedExpiredResource struct {
+	ID     string
+	Reason string
+}
+
+// findExpired finds the Resource Groups and resources within the Subscription whose expiry tag `tag` is on or
+// before `now` - resources within an expired Resource Group are deleted along with it, so aren't returned.
+//
+// Since the expiry tag bypasses the Prefix, an expired resource is only returned when its Resource Group isn't
+// protected - the same as if the Resource Group itself were being deleted.
+func findExpired(ctx context.Context, cc *CleanupContext, subscriptionId commonids.SubscriptionId, tag string, now time.Time) (*expiredItems, error) {
+	// Tag keys are case-insensitive in Resource Manager but not in Resource Graph, so the resources which might
+	// contain the tag are narrowed down here and then checked below. Every Resource Group is returned, so that
+	// the tags on the Resource Group containing an expired resource can be checked.
+	query := graph.Query{
+		Query: fmt.Sprintf(`
+resourcecontainers
+| where type =~ 'microsoft.resources/subscriptions/resourcegroups'
+| union (resources | where tostring(tags) contains %s)
+| project id, name, type, resourceGroup, location, tags
+`, graph.String(tag)),
+		Scope: graph.SubscriptionScope(subscriptionId.SubscriptionId),
+	}
+	rows, err := graph.Run[graph.Resource](ctx, graph.NewClient(cc.Client.ResourceManager.ResourceGraphClient), query)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceGroups := make([]ResourceGroupCandidate, 0)
+	resourceGroupTags := make(map[string]map[string]string)
+	expiresOn := make(map[string]expiredResourceGroup)
+	resources := make([]expiredResource, 0)
+	for _, row := range rows {
+		isResourceGroup := strings.EqualFold(row.Type, "microsoft.resources/subscriptions/resourcegroups")
+		if isResourceGroup {
+			resourceGroupTags[strings.ToLower(row.Name)] = row.Tags
+		}
+
+		value, ok := tagValue(row.Tags, tag)
+		if !ok {
+			continue
+		}
+		expiry, err := parseExpiry(value)
+		if err != nil {
+			cc.Logger.Printf("[DEBUG] %q has the tag %q set to %q which isn't a date - Skipping..", row.ID, tag, value)
+			continue
+		}
+		if now.Before(*expiry) {
+			continue
+		}
+
+		if isResourceGroup {
+			id := commonids.NewResourceGroupID(subscriptionId.SubscriptionId, row.Name)
+			resourceGroups = append(resourceGroups, ResourceGroupCandidate{
+				ID: id,
+			})
+			expiresOn[strings.ToLower(row.Name)] = expiredResourceGroup{
+				ID:        id,
+				ExpiresOn: *expiry,
+				Tags:      row.Tags,
+			}
+			continue
+		}
+
+		resources = append(resources, expiredResource{
+			ID:        row.ID,
+			Type:      row.Type,
+			ExpiresOn: *expiry,
+			Tags:      row.Tags,
+		})
+	}
+
+	out := expiredItems{
+		ResourceGroups:      make([]expiredResourceGroup, 0),
+		Resources:           make([]expiredResource, 0),
+		TotalResourceGroups: len(resourceGroupTags),
+	}
+	if len(resourceGroups) > 0 {
+		// a Resource Group is also protected when any of the resources within it carry a protection tag
+		protected, err := findProtectedResourceGroups(ctx, cc, resourceGroups)
+		if err != nil {
+			return nil, fmt.Errorf("finding Resource Groups containing protected resources: %+v", err)
+		}
+		out.Protected = protected
+		for _, item := range protected {
+			delete(expiresOn, strings.ToLower(item.ID.ResourceGroupName))
+		}
+	}
+	for _, item := range expiresOn {
+		out.ResourceGroups = append(out.ResourceGroups, item)
+	}
+	sort.Slice(out.ResourceGroups, func(i, j int) bool {
+		return out.ResourceGroups[i].ID.ResourceGroupName < out.ResourceGroups[j].ID.ResourceGroupName
+	})
+
+	remaining := make([]expiredResource, 0)
+	containing := make(map[string]ResourceGroupCandidate)
+	for _, item := range resources {
+		parsed, err := resourceids.ParseAzureResourceID(item.ID)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %+v", item.ID, err)
+		}
+		key := strings.ToLower(parsed.ResourceGroup)
+		if _, ok := expiresOn[key]; ok {
+			continue
+		}
+		remaining = append(remaining, item)
+		containing[key] = ResourceGroupCandidate{
+			ID: commonids.NewResourceGroupID(subscriptionId.SubscriptionId, parsed.ResourceGroup),
+		}
+	}
+
+	// the Resource Group containing an expired resource is checked in the same way as a Resource Group being
+	// deleted, since the resource would otherwise be deleted from a Resource Group which is protected
+	protectedBy := make(map[string]string)
+	for key, candidate := range containing {
+		if protectionTag := cc.Filters().ProtectedBy(pointer.To(resourceGroupTags[key])); protectionTag != nil {
+			protectedBy[key] = fmt.Sprintf("Resource Group %q is protected by the tag %q", candidate.ID.ResourceGroupName, *protectionTag)
+		}
+	}
+	if len(containing) > 0 {
+		candidates := make([]ResourceGroupCandidate, 0)
+		for _, candidate := range containing {
+			candidates = append(candidates, candidate)
+		}
+		protected, err := findProtectedResourceGroups(ctx, cc, candidates)
+		if err != nil {
+			return nil, fmt.Errorf("finding Resource Groups containing protected resources: %+v", err)
+		}
+		for _, item := range protected {
+			key := strings.ToLower(item.ID.ResourceGroupName)
+			if _, exists := protectedBy[key]; !exists {
+				protectedBy[key] = fmt.Sprintf("Resource Group %q contains %q which is protected by the tag %q", item.ID.ResourceGroupName, item.ProtectedBy, item.Tag)
+			}
+		}
+	}
+
+	for _, item := range remaining {
+		parsed, err := resourceids.ParseAzureResourceID(item.ID)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %+v", item.ID, err)
+		}
+		if reason, ok := protectedBy[strings.ToLower(parsed.ResourceGroup)]; ok {
+			out.ProtectedResources = append(out.ProtectedResources, protectedExpiredResource{
+				ID:     item.ID,
+				Reason: reason,
+			})
+			continue
+		}
+		out.Resources = append(out.Resources, item)
+	}
+	sort.Slice(out.Resources, func(i, j int) bool {
+		return out.Resources[i].ID < out.Resources[j].ID
+	})
+	sort.Slice(out.ProtectedResources, func(i, j int) bool {
+		return out.ProtectedResources[i].ID < out.ProtectedResources[j].ID
+	})
+
+	return &out, nil
+}
+
+// expiryLayouts are the formats the expiry tag can be specified in
+var expiryLayouts = []string{
+	time.DateOnly,
+	time.RFC3339,
+}
+
+// parseExpiry parses the value of the expiry tag, where a date (e.g. `2026-11-01`) expires at the start of that
+// day in UTC
+func parseExpiry(input string) (*time.Time, error) {
+	for _, layout := range expiryLayouts {
+		if v, err := time.Parse(layout, strings.TrimSpace(input)); err == nil {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a date in the format `2006-01-02` but got %q", input)
+}
+
+// tagValue returns the value of the Tag with the specified key, which is compared case-insensitively
+func tagValue(tags map[string]string, key string) (string, bool) {
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// deleteExpiredResourceGroup issues the deletion of the expired Resource Group, adding it to `pending` when it's
+// completing asynchronously - errors are logged rather than returned, so that the remaining items are deleted
+func deleteExpiredResourceGroup(ctx context.Context, cc *CleanupContext, item expiredResourceGroup, pending *pendingDeletions) {
+	req := gateway.Request{
+		Operation:    gateway.OperationDelete,
+		Target:       item.ID.ID(),
+		Tags:         &item.Tags,
+		IgnorePrefix: true,
+	}
+	err := cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+		resp, err := cc.Client.ResourceManager.ResourcesGroupsClient.Delete(ctx, item.ID, resourcegroups.DefaultDeleteOperationOptions())
+		if err != nil {
+			return err
+		}
+		if operationUrl := operationURLFromResponse(resp.HttpResponse); operationUrl != "" {
+			pending.add(pendingDeletion{
+				ID:           item.ID,
+				OperationURL: operationUrl,
+				Tags:         &item.Tags,
+			})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+		cc.Logger.Printf("[DEBUG]   Error during deletion of Resource Group %q: %s", item.ID.ResourceGroupName, err)
+	}
+}
+
+// deleteExpiredResource deletes the expired resource using the latest API Version of its Resource Type, which is
+// looked up from the Resource Provider (and cached in `apiVersions`) since the resource could be of any type
+func deleteExpiredResource(ctx context.Context, cc *CleanupContext, subscriptionId commonids.SubscriptionId, item expiredResource, apiVersions map[string]string) error {
+	req := gateway.Request{
+		Operation:    gateway.OperationDelete,
+		Target:       item.ID,
+		Tags:         &item.Tags,
+		IgnorePrefix: true,
+	}
+	return cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+		key := strings.ToLower(item.Type)
+		apiVersion, ok := apiVersions[key]
+		if !ok {
+			v, err := latestAPIVersion(ctx, cc, subscriptionId, item.Type)
+			if err != nil {
+				return fmt.Errorf("determining the API Version for %q: %+v", item.Type, err)
+			}
+			apiVersion = v
+			apiVersions[key] = v
+		}
+
+		opts := client.RequestOptions{
+			ContentType: "application/json; charset=utf-8",
+			ExpectedStatusCodes: []int{
+				http.StatusOK,
+				http.StatusAccepted,
+				http.StatusNoContent,
+			},
+			HttpMethod: http.MethodDelete,
+			Path:       item.ID,
+		}
+		sdkReq, err := cc.Client.ResourceManager.ResourcesGroupsClient.Client.NewRequest(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("building request: %+v", err)
+		}
+		sdkReq.URL.RawQuery = url.Values{"api-version": []string{apiVersion}}.Encode()
+
+		// NOTE: like the Resource Groups, these are fire-and-forget rather than polled
+		resp, err := sdkReq.Execute(ctx)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+}
+
+// latestAPIVersion returns the latest stable (or when there isn't one, the latest preview) API Version for the
+// Resource Type (e.g. `Microsoft.Network/virtualNetworks`), as registered by its Resource Provider
+func latestAPIVersion(ctx context.Context, cc *CleanupContext, subscriptionId commonids.SubscriptionId, resourceType string) (string, error) {
+	namespace, typeName, ok := strings.Cut(resourceType, "/")
+	if !ok {
+		return "", fmt.Errorf("expected a Resource Type in the format `Namespace/type` but got %q", resourceType)
+	}
+
+	opts := client.RequestOptions{
+		ContentType: "application/json; charset=utf-8",
+		ExpectedStatusCodes: []int{
+			http.StatusOK,
+		},
+		HttpMethod: http.MethodGet,
+		Path:       fmt.Sprintf("%s/providers/%s", subscriptionId.ID(), namespace),
+	}
+	// the Providers API is part of Resource Manager, so this uses the API Version of the Resource Groups client
+	req, err := cc.Client.ResourceManager.ResourcesGroupsClient.Client.NewRequest(ctx, opts)
+	if err != nil {
+		return "", fmt.Errorf("building request: %+v", err)
+	}
+	resp, err := req.Execute(ctx)
+	if err != nil {
+		return "", fmt.Errorf("retrieving the Resource Provider %q: %+v", namespace, err)
+	}
+
+	var provider resourceProvider
+	if err := resp.Unmarshal(&provider); err != nil {
+		return "", fmt.Errorf("parsing the Resource Provider %q: %+v", namespace, err)
+	}
+	return provider.latestAPIVersion(typeName)
+}
+
+type resourceProvider struct {
+	ResourceTypes []resourceProviderResourceType `json:"resourceTypes"`
+}
+
+type resourceProviderResourceType struct {
+	ResourceType string   `json:"resourceType"`
+	APIVersions  []string `json:"apiVersions"`
+}
+
+func (p resourceProvider) latestAPIVersion(typeName string) (string, error) {
+	for _, item := range p.ResourceTypes {
+		if !strings.EqualFold(item.ResourceType, typeName) {
+			continue
+		}
+
+		versions := append([]string{}, item.APIVersions...)
+		// API Versions are dates (optionally with a suffix such as `-preview`), so sort lexically newest first
+		sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+		for _, version := range versions {
+			if !strings.Contains(strings.ToLower(version), "preview") {
+				return version, nil
+			}
+		}
+		if len(versions) > 0 {
+			return versions[0], nil
+		}
+	}
+	return "", fmt.Errorf("no API Versions were found for %q", typeName)
+}
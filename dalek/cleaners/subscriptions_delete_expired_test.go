@@ -0,0 +1,156 @@
+package cleaners
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/lang/pointer"
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+func TestParseExpiry(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected *time.Time
+	}{
+		{
+			input:    "2026-11-01",
+			expected: pointer.To(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		{
+			input:    " 2026-11-01 ",
+			expected: pointer.To(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		{
+			input:    "2026-11-01T12:30:00Z",
+			expected: pointer.To(time.Date(2026, 11, 1, 12, 30, 0, 0, time.UTC)),
+		},
+		{
+			input: "01/11/2026",
+		},
+		{
+			input: "",
+		},
+	}
+	for _, v := range testData {
+		actual, err := parseExpiry(v.input)
+		if v.expected == nil {
+			if err == nil {
+				t.Errorf("expected %q to be invalid but got %s", v.input, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsing %q: %+v", v.input, err)
+			continue
+		}
+		if !actual.Equal(*v.expected) {
+			t.Errorf("expected %q to be %s but got %s", v.input, v.expected, actual)
+		}
+	}
+}
+
+func TestResourceProviderLatestAPIVersion(t *testing.T) {
+	provider := resourceProvider{
+		ResourceTypes: []resourceProviderResourceType{
+			{
+				ResourceType: "virtualNetworks",
+				APIVersions:  []string{"2023-01-01", "2024-05-01-preview", "2023-09-01"},
+			},
+			{
+				ResourceType: "networkManagers",
+				APIVersions:  []string{"2021-02-01-preview", "2022-01-01-preview"},
+			},
+		},
+	}
+
+	testData := []struct {
+		typeName string
+		expected string
+	}{
+		{
+			typeName: "virtualnetworks",
+			expected: "2023-09-01",
+		},
+		{
+			// when there's no stable API Version, the latest preview is used
+			typeName: "networkManagers",
+			expected: "2022-01-01-preview",
+		},
+		{
+			typeName: "publicIPAddresses",
+		},
+	}
+	for _, v := range testData {
+		actual, err := provider.latestAPIVersion(v.typeName)
+		if v.expected == "" {
+			if err == nil {
+				t.Errorf("expected no API Version for %q but got %q", v.typeName, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("determining the API Version for %q: %+v", v.typeName, err)
+			continue
+		}
+		if actual != v.expected {
+			t.Errorf("expected the API Version for %q to be %q but got %q", v.typeName, v.expected, actual)
+		}
+	}
+}
+
+func TestDeleteExpiredIgnoresPrefix(t *testing.T) {
+	disableDelays(t)
+	cassette, err := transports.LoadCassette(filepath.Join("testdata", "cassettes", "expired.json"))
+	if err != nil {
+		t.Fatalf("loading cassette: %+v", err)
+	}
+	replayer := transports.NewReplayer(*cassette)
+	client := testclient.New(t, replayer)
+	r := report.New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	opts := options.Options{
+		ActuallyDelete: true,
+		Prefix:         "acctest",
+		Expiry: options.Expiry{
+			Enabled: true,
+			Tag:     options.DefaultExpiryTag,
+		},
+	}
+	cleaner := deleteExpiredInSubscriptionCleaner{}
+	if err := cleaner.Cleanup(ctx, commonids.NewSubscriptionID(testclient.SubscriptionID), newCleanupContext(client, r, opts)); err != nil {
+		t.Fatalf("running the cleaner: %+v", err)
+	}
+	assertReplayed(t, replayer, r)
+
+	outcomes := make(map[string]report.Outcome)
+	for _, action := range r.Actions() {
+		outcomes[action.Target] = action.Outcome
+	}
+	expected := map[string]report.Outcome{
+		commonids.NewResourceGroupID(testclient.SubscriptionID, "sandbox-expired").ID():                                                        report.OutcomeSucceeded,
+		commonids.NewResourceGroupID(testclient.SubscriptionID, "sandbox-protected").ID():                                                      report.OutcomeSkipped,
+		"/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/shared/providers/Microsoft.Storage/storageAccounts/sandboxstorage": report.OutcomeSucceeded,
+		// the Resource Group is protected by its tags
+		"/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/production/providers/Microsoft.Storage/storageAccounts/productionstorage": report.OutcomeSkipped,
+		// the Resource Group contains a protected resource
+		"/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/team/providers/Microsoft.Storage/storageAccounts/teamstorage": report.OutcomeSkipped,
+	}
+	if len(outcomes) != len(expected) {
+		t.Fatalf("expected %d actions but got %d: %+v", len(expected), len(outcomes), outcomes)
+	}
+	for target, outcome := range expected {
+		if outcomes[target] != outcome {
+			t.Errorf("expected the outcome for %q to be %q but got %q", target, outcome, outcomes[target])
+		}
+	}
+}
@@ -3,8 +3,6 @@ package cleaners
 import (
 	"context"
 	"fmt"
-	"log"
-	"strings"
 	"time"
 
 	"github.com/hashicorp/go-azure-helpers/lang/response"
@@ -13,25 +11,32 @@ import (
 	"github.com/hashicorp/go-azure-sdk/resource-manager/netapp/2023-05-01/netappaccounts"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/netapp/2023-05-01/volumes"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/netapp/2023-05-01/volumesreplication"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
 )
 
 type deleteNetAppSubscriptionCleaner struct{}
 
 var _ SubscriptionCleaner = deleteNetAppSubscriptionCleaner{}
 
+// netAppConsistencyDelay is how long to wait for a NetApp resource to decouple from its parent - this is a
+// variable so that tests replaying a cassette don't need to wait
+var netAppConsistencyDelay = 30 * time.Second
+
+// netAppRetries is the number of times a NetApp resource is deleted before giving up, since the NetApp API is
+// eventually consistent and a delete can fail until the resources within it have been fully removed
+const netAppRetries = 3
+
 func (p deleteNetAppSubscriptionCleaner) Name() string {
 	return "Removing Net App"
 }
 
-func (p deleteNetAppSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, client *clients.AzureClient, opts options.Options) error {
-	netAppAccountClient := client.ResourceManager.NetAppAccountClient
-	netAppCapcityPoolClient := client.ResourceManager.NetAppCapacityPoolClient
-	netAppVolumeClient := client.ResourceManager.NetAppVolumeClient
-	netAppVolumeReplicationClient := client.ResourceManager.NetAppVolumeReplicationClient
+func (p deleteNetAppSubscriptionCleaner) ResourceTypes() []string {
+	return []string{
+		"Microsoft.NetApp/netAppAccounts",
+	}
+}
 
-	accountLists, err := netAppAccountClient.AccountsListBySubscription(ctx, subscriptionId)
+func (p deleteNetAppSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, cc *CleanupContext) error {
+	accountLists, err := cc.Client.ResourceManager.NetAppAccountClient.AccountsListBySubscription(ctx, subscriptionId)
 	if err != nil {
 		return fmt.Errorf("listing NetApp Accounts for %s: %+v", subscriptionId, err)
 	}
@@ -40,114 +45,125 @@ func (p deleteNetAppSubscriptionCleaner) Cleanup(ctx context.Context, subscripti
 		return fmt.Errorf("listing NetApp Accounts: model was nil")
 	}
 
+	accounts := make([]Listed[netappaccounts.NetAppAccountId], 0)
 	for _, account := range *accountLists.Model {
 		if account.Id == nil {
 			continue
 		}
 
-		accountIdForCapacityPool, err := capacitypools.ParseNetAppAccountID(*account.Id)
+		accountId, err := netappaccounts.ParseNetAppAccountID(*account.Id)
 		if err != nil {
 			return err
 		}
+		accounts = append(accounts, Listed[netappaccounts.NetAppAccountId]{
+			ID:   *accountId,
+			Tags: account.Tags,
+		})
+	}
 
-		if !strings.HasPrefix(accountIdForCapacityPool.ResourceGroupName, opts.Prefix) {
-			log.Printf("[DEBUG] Not deleting %q as it does not match target RG prefix %q", *accountIdForCapacityPool, opts.Prefix)
-			continue
+	return TearDown(ctx, cc, accounts, netAppAccountTeardown)
+}
+
+// netAppAccountTeardown deletes the Volumes (and their Replication) within each Capacity Pool, then the Capacity
+// Pools, then the NetApp Account - retrying each delete to work around the eventual consistency in the NetApp API.
+var netAppAccountTeardown = Level[netappaccounts.NetAppAccountId]{
+	Name: "NetApp Account",
+	Children: []ChildLevel[netappaccounts.NetAppAccountId]{
+		Children(listNetAppCapacityPools, Level[capacitypools.CapacityPoolId]{
+			Name: "NetApp Capacity Pool",
+			Children: []ChildLevel[capacitypools.CapacityPoolId]{
+				Children(listNetAppVolumes, Level[volumes.VolumeId]{
+					Name:    "NetApp Volume",
+					Delete:  deleteNetAppVolume,
+					Retries: netAppRetries,
+				}),
+			},
+			Delete: func(ctx context.Context, cc *CleanupContext, id capacitypools.CapacityPoolId) error {
+				if _, err := cc.Client.ResourceManager.NetAppCapacityPoolClient.PoolsDelete(ctx, id); err != nil {
+					return fmt.Errorf("deleting %s: %+v", id, err)
+				}
+
+				// waiting because there is some eventual consistency for when the capacity pool decouples from the account
+				return sleep(ctx, netAppConsistencyDelay)
+			},
+			Retries: netAppRetries,
+		}),
+	},
+	Delete: func(ctx context.Context, cc *CleanupContext, id netappaccounts.NetAppAccountId) error {
+		if _, err := cc.Client.ResourceManager.NetAppAccountClient.AccountsDelete(ctx, id); err != nil {
+			return fmt.Errorf("deleting %s: %+v", id, err)
 		}
+		return nil
+	},
+	Retries: netAppRetries,
+}
 
-		if !opts.ActuallyDelete {
-			log.Printf("[DEBUG] Would have deleted %s..", accountIdForCapacityPool)
+func listNetAppCapacityPools(ctx context.Context, cc *CleanupContext, accountId netappaccounts.NetAppAccountId) ([]Listed[capacitypools.CapacityPoolId], error) {
+	id := capacitypools.NewNetAppAccountID(accountId.SubscriptionId, accountId.ResourceGroupName, accountId.NetAppAccountName)
+	capacityPoolList, err := cc.Client.ResourceManager.NetAppCapacityPoolClient.PoolsListComplete(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Listed[capacitypools.CapacityPoolId], 0)
+	for _, capacityPool := range capacityPoolList.Items {
+		if capacityPool.Id == nil {
 			continue
 		}
 
-		capacityPoolList, err := netAppCapcityPoolClient.PoolsListComplete(ctx, *accountIdForCapacityPool)
+		capacityPoolId, err := capacitypools.ParseCapacityPoolID(*capacityPool.Id)
 		if err != nil {
-			return fmt.Errorf("listing NetApp Capacity Pools for %s: %+v", accountIdForCapacityPool, err)
+			return nil, err
 		}
+		out = append(out, Listed[capacitypools.CapacityPoolId]{
+			ID:   *capacityPoolId,
+			Tags: capacityPool.Tags,
+		})
+	}
+	return out, nil
+}
 
-		for _, capacityPool := range capacityPoolList.Items {
-			if capacityPool.Id == nil {
-				continue
-			}
-
-			capacityPoolForVolumesId, err := volumes.ParseCapacityPoolID(*capacityPool.Id)
-			if err != nil {
-				return err
-			}
-
-			if !opts.ActuallyDelete {
-				log.Printf("[DEBUG] Would have deleted %s..", capacityPoolForVolumesId)
-				continue
-			}
-
-			volumeList, err := netAppVolumeClient.ListComplete(ctx, *capacityPoolForVolumesId)
-			if err != nil {
-				return fmt.Errorf("listing NetApp Volumes for %s: %+v", capacityPoolForVolumesId, err)
-			}
-
-			for _, volume := range volumeList.Items {
-				if volume.Id == nil {
-					continue
-				}
-
-				volumeId, err := volumes.ParseVolumeID(*volume.Id)
-				if err != nil {
-					return err
-				}
-
-				if !opts.ActuallyDelete {
-					log.Printf("[DEBUG] Would have deleted %s..", volumeId)
-					continue
-				}
-
-				volumeReplicationId, err := volumesreplication.ParseVolumeID(*volume.Id)
-				if err != nil {
-					return nil
-				}
-
-				if resp, err := netAppVolumeReplicationClient.VolumesDeleteReplication(ctx, *volumeReplicationId); err != nil {
-					if !response.WasNotFound(resp.HttpResponse) {
-						return fmt.Errorf("deleting replication for %s: %+v", volumeReplicationId, err)
-					}
-				}
-
-				// sleeping because there is some eventual consistency for when the replication decouples from the volume
-				time.Sleep(30 * time.Second)
-
-				forceDelete := true
-				// the netapp api doesn't error if the delete fails so we'll just fire and forget as to not break the dalek
-				if _, err = netAppVolumeClient.Delete(ctx, *volumeId, volumes.DeleteOperationOptions{ForceDelete: &forceDelete}); err != nil {
-					// Potential Eventual Consistency Issues so we'll just log and move on
-					log.Printf("[DEBUG] Unable to delete %s: %+v", volumeId, err)
-				}
-			}
-
-			capacityPoolId, err := capacitypools.ParseCapacityPoolID(*capacityPool.Id)
-			if err != nil {
-				return err
-			}
-
-			// the netapp api doesn't error if the delete fails so we'll just fire and forget as to not break the dalek
-			if _, err = netAppCapcityPoolClient.PoolsDelete(ctx, *capacityPoolId); err != nil {
-				// Potential Eventual Consistency Issues so we'll just log and move on
-				log.Printf("[DEBUG] Unable to delete %s: %+v", capacityPoolId, err)
-			}
+func listNetAppVolumes(ctx context.Context, cc *CleanupContext, capacityPoolId capacitypools.CapacityPoolId) ([]Listed[volumes.VolumeId], error) {
+	id := volumes.NewCapacityPoolID(capacityPoolId.SubscriptionId, capacityPoolId.ResourceGroupName, capacityPoolId.NetAppAccountName, capacityPoolId.CapacityPoolName)
+	volumeList, err := cc.Client.ResourceManager.NetAppVolumeClient.ListComplete(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 
-			// sleeping because there is some eventual consistency for when the capacity pool decouples from the account
-			time.Sleep(30 * time.Second)
+	out := make([]Listed[volumes.VolumeId], 0)
+	for _, volume := range volumeList.Items {
+		if volume.Id == nil {
+			continue
 		}
 
-		accountId, err := netappaccounts.ParseNetAppAccountID(*account.Id)
+		volumeId, err := volumes.ParseVolumeID(*volume.Id)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		out = append(out, Listed[volumes.VolumeId]{
+			ID:   *volumeId,
+			Tags: volume.Tags,
+		})
+	}
+	return out, nil
+}
 
-		// the netapp api doesn't error if the delete fails so we'll just fire and forget as to not break the dalek
-		if _, err = netAppAccountClient.AccountsDelete(ctx, *accountId); err != nil {
-			// Potential Eventual Consistency Issues so we'll just log and move on
-			log.Printf("[DEBUG] Unable to delete %s: %+v", accountId, err)
+func deleteNetAppVolume(ctx context.Context, cc *CleanupContext, id volumes.VolumeId) error {
+	volumeReplicationId := volumesreplication.NewVolumeID(id.SubscriptionId, id.ResourceGroupName, id.NetAppAccountName, id.CapacityPoolName, id.VolumeName)
+	if resp, err := cc.Client.ResourceManager.NetAppVolumeReplicationClient.VolumesDeleteReplication(ctx, volumeReplicationId); err != nil {
+		if !response.WasNotFound(resp.HttpResponse) {
+			return fmt.Errorf("deleting replication for %s: %+v", volumeReplicationId, err)
 		}
 	}
 
+	// waiting because there is some eventual consistency for when the replication decouples from the volume
+	if err := sleep(ctx, netAppConsistencyDelay); err != nil {
+		return err
+	}
+
+	forceDelete := true
+	if _, err := cc.Client.ResourceManager.NetAppVolumeClient.Delete(ctx, id, volumes.DeleteOperationOptions{ForceDelete: &forceDelete}); err != nil {
+		return fmt.Errorf("deleting %s: %+v", id, err)
+	}
 	return nil
 }
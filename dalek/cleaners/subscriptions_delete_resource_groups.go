@@ -2,166 +2,726 @@ package cleaners
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-azure-helpers/lang/pointer"
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
-	"github.com/hashicorp/go-azure-sdk/resource-manager/resourcegraph/2022-10-01/resources"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resourcegroups"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/filters"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/graph"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
 )
 
 var _ SubscriptionCleaner = deleteResourceGroupsInSubscriptionCleaner{}
 
 type deleteResourceGroupsInSubscriptionCleaner struct {
+	resourceGroupCleaners []ResourceGroupCleaner
+	remediations          RemediationCatalog
+}
+
+// NewDeleteResourceGroupsCleaner returns a Subscription Cleaner which deletes each Resource Group matching
+// the filters, first running `resourceGroupCleaners` against each Resource Group which needs them. When a
+// deletion fails with an error in the DefaultRemediationCatalog, the matching cleaners are run and the
+// Resource Group is deleted again.
+func NewDeleteResourceGroupsCleaner(resourceGroupCleaners []ResourceGroupCleaner) SubscriptionCleaner {
+	return deleteResourceGroupsInSubscriptionCleaner{
+		resourceGroupCleaners: resourceGroupCleaners,
+		remediations:          DefaultRemediationCatalog(),
+	}
 }
 
 func (d deleteResourceGroupsInSubscriptionCleaner) Name() string {
 	return "Delete Resource Groups in Subscription"
 }
 
-func (d deleteResourceGroupsInSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, client *clients.AzureClient, opts options.Options) error {
-	log.Printf("[DEBUG] Loading the first %d resource groups to delete", opts.NumberOfResourceGroupsToDelete)
+func (d deleteResourceGroupsInSubscriptionCleaner) ResourceTypes() []string {
+	return []string{
+		"Microsoft.Resources/resourceGroups",
+	}
+}
+
+func (d deleteResourceGroupsInSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, cc *CleanupContext) error {
+	candidates, err := FindResourceGroupsToDelete(ctx, cc, subscriptionId)
+	if err != nil {
+		return err
+	}
+
+	if counts := candidates.CountByDay(); len(counts) > 0 {
+		days := make([]string, 0, len(counts))
+		for day := range counts {
+			days = append(days, day)
+		}
+		sort.Strings(days)
+		cc.Logger.Printf("[DEBUG] Resource Groups to delete by the day they were created:")
+		for _, day := range days {
+			cc.Logger.Printf("[DEBUG]   %s: %d", day, counts[day])
+		}
+	}
+
+	// Resource Groups which are already being deleted are skipped, but those which have been Deleting for
+	// a while are likely stuck - so diagnose what's left in them
+	if err := diagnoseStuckDeletions(ctx, cc, candidates.Deleting); err != nil {
+		cc.Logger.Printf("[DEBUG] Error diagnosing the Resource Groups which are being deleted: %+v", err)
+	}
+
+	for _, protected := range candidates.Protected {
+		req := gateway.Request{
+			Operation: gateway.OperationDelete,
+			Target:    protected.ID.ID(),
+		}
+		cc.Gateway.Skip(ctx, req, fmt.Sprintf("contains %q which is protected by the tag %q", protected.ProtectedBy, protected.Tag))
+	}
+
+	pending := &pendingDeletions{}
+	for _, candidate := range candidates.ResourceGroups {
+		id := candidate.ID
+		cc.Logger.Printf("[DEBUG] Resource Group: %q", id.ResourceGroupName)
+		cc.Events().Notify(ctx, events.Event{
+			Type:   events.TypeResourceDiscovered,
+			Target: id.ID(),
+		})
+
+		budget := cc.Options.Timeouts.ResourceGroup
+		err := RunWithinBudget(ctx, budget, func(ctx context.Context) error {
+			return d.cleanupResourceGroup(ctx, cc, candidate, pending)
+		})
+		if errors.Is(err, ErrBudgetExceeded) {
+			cc.RecordOverrun(ctx, "", id.ID(), budget, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// the deletions are issued without polling, so check on them afterwards to find out why any failed - and
+	// where the failure is one we know how to fix, remediate it and delete the Resource Group again
+	remediated := make(map[string]struct{})
+	for deletions := pending.list(); len(deletions) > 0; {
+		failures, err := checkPendingDeletions(ctx, cc, deletions)
+		if err != nil {
+			return fmt.Errorf("checking the status of the Resource Group deletions: %+v", err)
+		}
+
+		retries := &pendingDeletions{}
+		for _, failed := range failures {
+			key := strings.ToLower(failed.ID.ID())
+			remediations, _ := SupportedResourceGroupCleaners(cc.Client.Profile, d.remediations.Match(failed.Failure))
+			if _, alreadyRemediated := remediated[key]; alreadyRemediated || len(remediations) == 0 {
+				cc.Recorder.RecordDeletionFailure(failed.Failure)
+				continue
+			}
+			remediated[key] = struct{}{}
+
+			for _, cleaner := range remediations {
+				failed.Failure.Remediations = append(failed.Failure.Remediations, cleaner.Name())
+			}
+			cc.Recorder.RecordDeletionFailure(failed.Failure)
+
+			cc.Logger.Printf("[DEBUG] Remediating the failed deletion of %s..", failed.ID)
+			runResourceGroupCleaners(ctx, cc, failed.ID, remediations)
+			deleteResourceGroup(ctx, cc, failed.ID, failed.Tags, retries)
+		}
+		deletions = retries.list()
+	}
+
+	return nil
+}
+
+// cleanupResourceGroup runs the Resource Group Cleaners against the candidate, then deletes it - adding the
+// deletion to `pending` when it's completing asynchronously
+func (d deleteResourceGroupsInSubscriptionCleaner) cleanupResourceGroup(ctx context.Context, cc *CleanupContext, candidate ResourceGroupCandidate, pending *pendingDeletions) error {
+	id := candidate.ID
+	if err := recordResourceGroupContents(ctx, cc, id); err != nil {
+		cc.Logger.Printf("[DEBUG]   Error recording the contents of Resource Group %q: %+v", id.ResourceGroupName, err)
+	}
 
-	listOpts := resourcegroups.ListOperationOptions{
-		Top: pointer.To(opts.NumberOfResourceGroupsToDelete),
+	if cc.Options.Quarantine.Enabled {
+		ready, err := quarantineResourceGroup(ctx, cc, id, time.Now(), false)
+		if err != nil {
+			if errors.Is(err, gateway.ErrBlocked) {
+				return nil
+			}
+			cc.Logger.Printf("[DEBUG]   Error quarantining Resource Group %q: %s", id.ResourceGroupName, err)
+			return nil
+		}
+		if !ready {
+			return nil
+		}
 	}
-	groups, err := client.ResourceManager.ResourcesGroupsClient.List(ctx, subscriptionId, listOpts)
+
+	// Locks and Nested Items within the Resource Group can cause issues during deletion
+	// as such we have a set of Cleaners to go through and remove these locks/items
+	// which are split out for simplicity since there's a number of them
+	//
+	// However since there's a non-trivial number of these (each of which makes several
+	// requests), only the Cleaners for the Resource Types within the Resource Group are run
+	resourceGroupCleaners, err := d.cleanersForResourceGroup(ctx, cc, id)
 	if err != nil {
-		return fmt.Errorf("listing Resource Groups: %+v", err)
+		return fmt.Errorf("determining the Resource Group Cleaners needed for %s: %+v", id, err)
 	}
 
-	if groups.Model == nil {
-		log.Printf("[DEBUG]   No Resource Groups found")
-		return nil
+	if len(resourceGroupCleaners) > 0 {
+		cc.Logger.Printf("[DEBUG] Running %d of %d Resource Group Cleaners for %s..", len(resourceGroupCleaners), len(d.resourceGroupCleaners), id)
+		runResourceGroupCleaners(ctx, cc, id, resourceGroupCleaners)
+	} else {
+		cc.Logger.Printf("[DEBUG] Skipping Resource Group Cleaners for %s..", id)
 	}
 
-	resourceGroups := make([]string, 0)
-	for _, resource := range *groups.Model {
-		if strings.EqualFold(*resource.Properties.ProvisioningState, "Deleting") {
-			log.Printf("[DEBUG] Resource Group %q is already being deleted - Skipping..", *resource.Name)
+	deleteResourceGroup(ctx, cc, id, candidate.Tags, pending)
+	return nil
+}
+
+// runResourceGroupCleaners runs each of the selected `resourceGroupCleaners` against the Resource Group, each
+// within its own time budget - errors are logged rather than returned, so that the remaining cleaners still run
+func runResourceGroupCleaners(ctx context.Context, cc *CleanupContext, id commonids.ResourceGroupId, resourceGroupCleaners []ResourceGroupCleaner) {
+	for _, cleaner := range resourceGroupCleaners {
+		if !cc.Filters().CleanerSelected(cleaner.Name()) {
+			cc.Logger.Printf("[DEBUG] Resource Group Cleaner %q wasn't selected - Skipping..", cleaner.Name())
 			continue
 		}
-		if !shouldDeleteResourceGroup(resource, opts.Prefix) {
-			log.Printf("[DEBUG] Resource Group %q shouldn't be deleted - Skipping..", *resource.Name)
+		cc.Logger.Printf("[DEBUG] Running Resource Group Cleaner %q..", cleaner.Name())
+		cc.Events().Notify(ctx, events.Event{
+			Type:    events.TypeCleanerStarted,
+			Cleaner: cleaner.Name(),
+			Target:  id.ID(),
+		})
+		cleanerContext := cc.ForCleaner(cleaner.Name())
+		budget := cc.Options.Timeouts.ResourceGroupCleaner
+		err := RunWithinBudget(ctx, budget, func(ctx context.Context) error {
+			return cleaner.Cleanup(ctx, id, cleanerContext)
+		})
+		cc.Events().Notify(ctx, events.Event{
+			Type:    events.TypeCleanerCompleted,
+			Cleaner: cleaner.Name(),
+			Target:  id.ID(),
+			Error:   err,
+		})
+		if errors.Is(err, ErrBudgetExceeded) {
+			cleanerContext.RecordOverrun(ctx, cleaner.Name(), id.ID(), budget, err)
 			continue
 		}
+		if err != nil {
+			cc.Logger.Printf("running Cleaner %q for %s: %+v", cleaner.Name(), id, err)
+			continue
+		}
+	}
+}
 
-		resourceGroups = append(resourceGroups, *resource.Name)
+// deleteResourceGroup issues the deletion of the Resource Group, adding it to `pending` when it's completing
+// asynchronously - errors are logged rather than returned, so that the remaining Resource Groups are deleted
+func deleteResourceGroup(ctx context.Context, cc *CleanupContext, id commonids.ResourceGroupId, tags *map[string]string, pending *pendingDeletions) {
+	req := gateway.Request{
+		Operation: gateway.OperationDelete,
+		Target:    id.ID(),
+		Tags:      tags,
+	}
+	err := cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+		// NOTE: we're intentionally not using DeleteThenPoll since fire-and-forgetting these is fine - the
+		// status of each deletion is checked once they've all been issued
+		resp, err := cc.Client.ResourceManager.ResourcesGroupsClient.Delete(ctx, id, resourcegroups.DefaultDeleteOperationOptions())
+		if err != nil {
+			return err
+		}
+		if operationUrl := operationURLFromResponse(resp.HttpResponse); operationUrl != "" {
+			pending.add(pendingDeletion{
+				ID:           id,
+				OperationURL: operationUrl,
+				Tags:         tags,
+			})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+		cc.Logger.Printf("[DEBUG]   Error during deletion of Resource Group %q: %s", id.ResourceGroupName, err)
+	}
+}
+
+// cleanersForResourceGroup returns the Resource Group Cleaners (in order) which support any of the Resource
+// Types present within the Resource Group
+func (d deleteResourceGroupsInSubscriptionCleaner) cleanersForResourceGroup(ctx context.Context, cc *CleanupContext, id commonids.ResourceGroupId) ([]ResourceGroupCleaner, error) {
+	items, err := cc.Inventory.InResourceGroup(ctx, id.ResourceGroupName)
+	if err != nil {
+		return nil, err
 	}
-	sort.Strings(resourceGroups)
 
-	// pull out a list of Resource Types supported by the cleaners
-	resourceTypes := make([]string, 0)
-	for _, cleaner := range ResourceGroupCleaners {
-		resourceTypes = append(resourceTypes, cleaner.ResourceTypes()...)
+	presentTypes := make(map[string]struct{})
+	for _, item := range items {
+		presentTypes[strings.ToLower(item.Type)] = struct{}{}
 	}
 
-	for _, groupName := range resourceGroups {
-		log.Printf("[DEBUG] Resource Group: %q", groupName)
+	out := make([]ResourceGroupCleaner, 0)
+	for _, cleaner := range d.resourceGroupCleaners {
+		for _, resourceType := range cleaner.ResourceTypes() {
+			if _, ok := presentTypes[strings.ToLower(resourceType)]; ok {
+				out = append(out, cleaner)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// recordResourceGroupContents records the number of resources of each Resource Type within the Resource Group
+// into the report, so that the Resource Types which are left behind most often can be tracked over time
+func recordResourceGroupContents(ctx context.Context, cc *CleanupContext, id commonids.ResourceGroupId) error {
+	items, err := cc.Inventory.InResourceGroup(ctx, id.ResourceGroupName)
+	if err != nil {
+		return err
+	}
+
+	resourceTypes := make(map[string]int)
+	for _, item := range items {
+		resourceTypes[strings.ToLower(item.Type)]++
+	}
+	cc.Recorder.RecordResourceGroupContents(report.ResourceGroupContents{
+		ResourceGroup: id.ID(),
+		ResourceTypes: resourceTypes,
+	})
+	return nil
+}
+
+// ResourceGroupCandidate is a Resource Group which matches the filters and will be deleted
+type ResourceGroupCandidate struct {
+	ID commonids.ResourceGroupId
+
+	// CreatedAt is when the Resource Group was created, when known - this is inferred from the name when
+	// a NamePattern is configured, or from the oldest resource within it when a MinimumAge is configured
+	CreatedAt *time.Time
 
-		id := commonids.NewResourceGroupID(subscriptionId.SubscriptionId, groupName)
-		if !opts.ActuallyDelete {
-			log.Printf("[DEBUG]   Would have deleted %s..", id)
+	Location string
+	Tags     *map[string]string
+}
+
+// CountByDay returns the number of Resource Groups created on each day (formatted as `2006-01-02`), for
+// the Resource Groups whose creation time is known
+func (c ResourceGroupCandidates) CountByDay() map[string]int {
+	out := make(map[string]int)
+	for _, candidate := range c.ResourceGroups {
+		if candidate.CreatedAt != nil {
+			out[candidate.CreatedAt.UTC().Format("2006-01-02")]++
+		}
+	}
+	return out
+}
+
+// ResourceGroupCandidates is the set of Resource Groups which would be deleted from a Subscription
+type ResourceGroupCandidates struct {
+	// ResourceGroups is the list of Resource Groups which match the filters, sorted by name
+	ResourceGroups []ResourceGroupCandidate
+
+	// Protected is the list of Resource Groups which match the filters, but contain a protected resource
+	Protected []ProtectedResourceGroup
+
+	// Deleting is the list of Resource Groups which match the filters, but are already being deleted
+	Deleting []commonids.ResourceGroupId
+
+	// TotalResourceGroups is the total number of Resource Groups within the Subscription
+	TotalResourceGroups int
+}
+
+// ProtectedResourceGroup is a Resource Group which matches the filters but contains a resource with a protection tag
+type ProtectedResourceGroup struct {
+	ID commonids.ResourceGroupId
+
+	// ProtectedBy is the Resource ID of the resource with the protection tag
+	ProtectedBy string
+
+	// Tag is the protection tag found on the resource
+	Tag string
+}
+
+// FindResourceGroupsToDelete determines which Resource Groups within the Subscription match the filters,
+// limited to the first `NumberOfResourceGroupsToDelete`.
+//
+// Since this is needed several times during a run (e.g. to check the blast radius and then to delete the Resource
+// Groups) the Resource Groups are only retrieved once per run, with any selection (and the limit) applied to them
+// each time this is called.
+func FindResourceGroupsToDelete(ctx context.Context, cc *CleanupContext, subscriptionId commonids.SubscriptionId) (*ResourceGroupCandidates, error) {
+	all, err := cc.candidates.get(ctx, subscriptionId, func(ctx context.Context) (*ResourceGroupCandidates, error) {
+		return findResourceGroupCandidates(ctx, cc, subscriptionId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	evaluator := cc.Filters()
+	result := ResourceGroupCandidates{
+		ResourceGroups:      make([]ResourceGroupCandidate, 0),
+		Protected:           make([]ProtectedResourceGroup, 0),
+		Deleting:            make([]commonids.ResourceGroupId, 0),
+		TotalResourceGroups: all.TotalResourceGroups,
+	}
+	for _, candidate := range all.ResourceGroups {
+		if evaluator.ResourceGroupSelected(candidate.ID.ResourceGroupName) {
+			result.ResourceGroups = append(result.ResourceGroups, candidate)
+		}
+	}
+	for _, protected := range all.Protected {
+		if evaluator.ResourceGroupSelected(protected.ID.ResourceGroupName) {
+			result.Protected = append(result.Protected, protected)
+		}
+	}
+	for _, id := range all.Deleting {
+		if evaluator.ResourceGroupSelected(id.ResourceGroupName) {
+			result.Deleting = append(result.Deleting, id)
+		}
+	}
+
+	if limit := int(cc.Options.NumberOfResourceGroupsToDelete); limit > 0 && len(result.ResourceGroups) > limit {
+		cc.Logger.Printf("[DEBUG] Limiting to the first %d of %d Resource Groups", limit, len(result.ResourceGroups))
+		result.ResourceGroups = result.ResourceGroups[0:limit]
+	}
+
+	return &result, nil
+}
+
+// candidatesCache caches the Resource Groups which match the filters within each Subscription for the duration
+// of a run, see FindResourceGroupsToDelete
+type candidatesCache struct {
+	lock         sync.Mutex
+	subscription map[string]*ResourceGroupCandidates
+}
+
+func (c *candidatesCache) get(ctx context.Context, subscriptionId commonids.SubscriptionId, find func(ctx context.Context) (*ResourceGroupCandidates, error)) (*ResourceGroupCandidates, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := strings.ToLower(subscriptionId.ID())
+	if existing, ok := c.subscription[key]; ok {
+		return existing, nil
+	}
+
+	candidates, err := find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.subscription == nil {
+		c.subscription = make(map[string]*ResourceGroupCandidates)
+	}
+	c.subscription[key] = candidates
+	return candidates, nil
+}
+
+// findResourceGroupCandidates retrieves the Resource Groups within the Subscription and determines which of
+// them match the filters, sorted by name
+func findResourceGroupCandidates(ctx context.Context, cc *CleanupContext, subscriptionId commonids.SubscriptionId) (*ResourceGroupCandidates, error) {
+	evaluator := cc.Filters()
+	cc.Logger.Printf("[DEBUG] Loading the Resource Groups within %s", subscriptionId)
+	groups, err := cc.Client.ResourceManager.ResourcesGroupsClient.ListComplete(ctx, subscriptionId, resourcegroups.DefaultListOperationOptions())
+	if err != nil {
+		return nil, fmt.Errorf("listing Resource Groups: %+v", err)
+	}
+
+	// the resources within every Resource Group are retrieved in a single (paged) query, rather than a query
+	// per Resource Group - which is then used to determine which cleaners each Resource Group needs
+	cc.Logger.Printf("[DEBUG] Taking a snapshot of the resources within %s", subscriptionId)
+	if err := cc.Inventory.Load(ctx); err != nil {
+		return nil, fmt.Errorf("taking a snapshot of the resources: %+v", err)
+	}
+
+	result := ResourceGroupCandidates{
+		ResourceGroups:      make([]ResourceGroupCandidate, 0),
+		Deleting:            make([]commonids.ResourceGroupId, 0),
+		TotalResourceGroups: len(groups.Items),
+	}
+	for _, resource := range groups.Items {
+		if resource.Name == nil {
 			continue
 		}
+		if !shouldDeleteResourceGroup(resource, evaluator) {
+			cc.Logger.Printf("[DEBUG] Resource Group %q shouldn't be deleted - Skipping..", *resource.Name)
+			continue
+		}
+		if resource.Properties != nil && strings.EqualFold(pointer.From(resource.Properties.ProvisioningState), "Deleting") {
+			cc.Logger.Printf("[DEBUG] Resource Group %q is already being deleted - Skipping..", *resource.Name)
+			result.Deleting = append(result.Deleting, commonids.NewResourceGroupID(subscriptionId.SubscriptionId, *resource.Name))
+			continue
+		}
+
+		result.ResourceGroups = append(result.ResourceGroups, ResourceGroupCandidate{
+			ID:        commonids.NewResourceGroupID(subscriptionId.SubscriptionId, *resource.Name),
+			CreatedAt: evaluator.CreatedAtFromName(*resource.Name),
+			Location:  resource.Location,
+			Tags:      resource.Tags,
+		})
+	}
+	if minimumAge := cc.Options.Age.MinimumAge; minimumAge > 0 {
+		result.ResourceGroups = filterByMinimumAge(ctx, cc, result.ResourceGroups, minimumAge, time.Now())
+	}
+
+	// a Resource Group is also protected when any of the resources within it carry a protection tag
+	protected, err := findProtectedResourceGroups(ctx, cc, result.ResourceGroups)
+	if err != nil {
+		return nil, fmt.Errorf("finding Resource Groups containing protected resources: %+v", err)
+	}
+	result.Protected = protected
+	if len(protected) > 0 {
+		protectedNames := make(map[string]struct{})
+		for _, item := range protected {
+			protectedNames[strings.ToLower(item.ID.ResourceGroupName)] = struct{}{}
+		}
+		unprotected := make([]ResourceGroupCandidate, 0)
+		for _, candidate := range result.ResourceGroups {
+			if _, ok := protectedNames[strings.ToLower(candidate.ID.ResourceGroupName)]; ok {
+				continue
+			}
+			unprotected = append(unprotected, candidate)
+		}
+		result.ResourceGroups = unprotected
+	}
+
+	sort.Slice(result.ResourceGroups, func(i, j int) bool {
+		return result.ResourceGroups[i].ID.ResourceGroupName < result.ResourceGroups[j].ID.ResourceGroupName
+	})
 
-		// Locks and Nested Items within the Resource Group can cause issues during deletion
-		// as such we have a set of Cleaners to go through and remove these locks/items
-		// which are split out for simplicity since there's a number of them
-		//
-		// However since there's a non-trivial number of these, let's try and determine if we
-		// need to run the cleaners first
-		needsCleaners, err := d.resourceGroupContainsResourceTypes(ctx, client, id, resourceTypes)
+	return &result, nil
+}
+
+// changeHistoryRetention is how long Resource Graph retains the change history for
+const changeHistoryRetention = 14 * 24 * time.Hour
+
+// filterByMinimumAge returns the candidates which were created at least `minimumAge` before `now`, determining
+// when each was created (when this couldn't be inferred from the name) from the oldest resource within it in
+// the Inventory.
+//
+// Since an empty Resource Group (or one where no resource has a creation time) has nothing to age it by, it's
+// aged by when it was created according to the change history retained by Resource Graph - and when there's no
+// record of it being created, it predates the change history so is treated as being `changeHistoryRetention` old.
+// Resource Groups whose age can't be determined (e.g. when a lookup fails, or Resource Graph isn't available) are
+// skipped.
+func filterByMinimumAge(ctx context.Context, cc *CleanupContext, candidates []ResourceGroupCandidate, minimumAge time.Duration, now time.Time) []ResourceGroupCandidate {
+	empty := make([]commonids.ResourceGroupId, 0)
+	for i, candidate := range candidates {
+		if candidate.CreatedAt != nil {
+			continue
+		}
+		resources, err := cc.Inventory.InResourceGroup(ctx, candidate.ID.ResourceGroupName)
 		if err != nil {
-			return fmt.Errorf("determining if %s contains the resource types needed for cleaning: %+v", id, err)
+			cc.Logger.Printf("[DEBUG] Error determining when Resource Group %q was created - Skipping: %+v", candidate.ID.ResourceGroupName, err)
+			continue
 		}
+		createdAt := OldestResourceCreatedAt(cc, resources, now)
+		if createdAt == nil {
+			empty = append(empty, candidate.ID)
+			continue
+		}
+		candidates[i].CreatedAt = createdAt
+	}
 
-		if *needsCleaners {
-			log.Printf("[DEBUG] Running Resource Group Cleaners for %s..", id)
-			for _, cleaner := range ResourceGroupCleaners {
-				log.Printf("[DEBUG] Running Resource Group Cleaner %q..", cleaner.Name())
-				if err := cleaner.Cleanup(ctx, id, client, opts); err != nil {
-					log.Printf("running Cleaner %q for %s: %+v", cleaner.Name(), id, err)
-					continue
-				}
+	if len(empty) > 0 {
+		createdAt, err := emptyResourceGroupsCreatedAt(ctx, cc, empty, now)
+		if err != nil {
+			cc.Logger.Printf("[DEBUG] Error determining when the %d empty Resource Groups were created: %+v", len(empty), err)
+		}
+		for i, candidate := range candidates {
+			if v, ok := createdAt[strings.ToLower(candidate.ID.ID())]; ok && candidate.CreatedAt == nil {
+				candidates[i].CreatedAt = pointer.To(v)
 			}
-		} else {
-			log.Printf("[DEBUG] Skipping Resource Group Cleaners for %s..", id)
 		}
+	}
 
-		log.Printf("[DEBUG]   Deleting Resource Group %q..", groupName)
-		// NOTE: we're intentionally not using DeleteThenPoll since fire-and-forgetting these is fine
-		if _, err := client.ResourceManager.ResourcesGroupsClient.Delete(ctx, id, resourcegroups.DefaultDeleteOperationOptions()); err != nil {
-			log.Printf("[DEBUG]   Error during deletion of Resource Group %q: %s", groupName, err)
+	out := make([]ResourceGroupCandidate, 0)
+	for _, candidate := range candidates {
+		if candidate.CreatedAt == nil {
+			cc.Logger.Printf("[DEBUG] Resource Group %q has an unknown age - Skipping..", candidate.ID.ResourceGroupName)
 			continue
 		}
-		log.Printf("[DEBUG]   Deletion triggered for Resource Group %q", groupName)
+		if age := now.Sub(*candidate.CreatedAt); age < minimumAge {
+			cc.Logger.Printf("[DEBUG] Resource Group %q is %s old, which is newer than the minimum age of %s - Skipping..", candidate.ID.ResourceGroupName, age.Round(time.Minute), minimumAge)
+			continue
+		}
+		out = append(out, candidate)
 	}
+	return out
+}
 
-	return nil
+// OldestResourceCreatedAt returns when the oldest of the `resources` (from the Inventory) within a Resource Group
+// was created, since Resource Groups don't expose their creation time - or nil when there's nothing to age it by
+// (e.g. the Resource Group is empty).
+//
+// When the Inventory comes from Resource Graph a resource without a creation time predates the change history
+// retained by Resource Graph, so is treated as being created `changeHistoryRetention` before `now` - otherwise
+// (using the Resources API) these are ignored, since their age is unknown.
+func OldestResourceCreatedAt(cc *CleanupContext, resources []graph.Resource, now time.Time) *time.Time {
+	predatesChangeHistory := cc.Client.Profile.SupportsResourceGraph()
+
+	var oldest *time.Time
+	for _, resource := range resources {
+		createdAt := resource.CreatedAt
+		if createdAt == nil {
+			if !predatesChangeHistory {
+				continue
+			}
+			createdAt = pointer.To(now.Add(-changeHistoryRetention))
+		}
+		if oldest == nil || createdAt.Before(*oldest) {
+			oldest = createdAt
+		}
+	}
+	return oldest
+}
+
+type resourceGroupCreatedAt struct {
+	ResourceGroupID string    `json:"targetResourceId"`
+	CreatedAt       time.Time `json:"createdAt"`
 }
 
-func (d deleteResourceGroupsInSubscriptionCleaner) resourceGroupContainsResourceTypes(ctx context.Context, client *clients.AzureClient, id commonids.ResourceGroupId, resourceTypes []string) (*bool, error) {
-	items := make([]string, 0)
-	for _, resourceType := range resourceTypes {
-		items = append(items, fmt.Sprintf("'%s'", resourceType))
-	}
-	query := fmt.Sprintf(`
-resources
-| where type in~ (%s)
-| where resourceGroup =~ '%s'
-| project id
-| sort by (tolower(tostring(id))) asc
-`, strings.Join(items, ", "), id.ResourceGroupName)
-	payload := resources.QueryRequest{
-		Options: &resources.QueryRequestOptions{
-			Top: pointer.To(int64(1000)),
-		},
-		Query: query,
-		Subscriptions: &[]string{
-			id.SubscriptionId,
-		},
-	}
-	resp, err := client.ResourceManager.ResourceGraphClient.Resources(ctx, payload)
+// emptyResourceGroupsCreatedAt returns when each of the (empty) Resource Groups was most recently created, keyed by
+// the lower-cased Resource ID - Resource Groups without a record of this in the change history retained by
+// Resource Graph predate it, so are treated as being created `changeHistoryRetention` before `now`.
+func emptyResourceGroupsCreatedAt(ctx context.Context, cc *CleanupContext, ids []commonids.ResourceGroupId, now time.Time) (map[string]time.Time, error) {
+	if !cc.Client.Profile.SupportsResourceGraph() {
+		return nil, fmt.Errorf("the change history isn't available since Resource Graph isn't available in the API Profile %q", cc.Client.Profile.Name)
+	}
+
+	resourceGroupIds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		resourceGroupIds = append(resourceGroupIds, id.ID())
+	}
+	query := graph.Query{
+		Query: fmt.Sprintf(`
+resourcecontainerchanges
+| extend targetResourceId = tostring(properties.targetResourceId)
+| where targetResourceId in~ (%s)
+| where tostring(properties.changeType) =~ 'Create'
+| summarize createdAt = max(todatetime(properties.changeAttributes.timestamp)) by targetResourceId
+`, graph.Strings(resourceGroupIds)),
+		Scope: graph.SubscriptionScope(cc.Client.SubscriptionID),
+	}
+	rows, err := graph.Run[resourceGroupCreatedAt](ctx, graph.NewClient(cc.Client.ResourceManager.ResourceGraphClient), query)
 	if err != nil {
-		return nil, fmt.Errorf("performing graph query %q: %+v", query, err)
+		return nil, err
 	}
 
-	if resp.Model == nil {
-		return nil, fmt.Errorf("performing graph query %q: response was nil", query)
+	out := make(map[string]time.Time)
+	for _, id := range ids {
+		out[strings.ToLower(id.ID())] = now.Add(-changeHistoryRetention)
 	}
-	if resp.Model.Data == nil {
-		return nil, fmt.Errorf("performing graph query %q: response.data was nil", query)
+	for _, row := range rows {
+		out[strings.ToLower(row.ResourceGroupID)] = row.CreatedAt
 	}
+	return out, nil
+}
 
-	itemsRaw, ok := resp.Model.Data.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("expected the data to be an []interface but got %+v", resp.Model.Data)
+func findProtectedResourceGroups(ctx context.Context, cc *CleanupContext, candidates []ResourceGroupCandidate) ([]ProtectedResourceGroup, error) {
+	resources, err := cc.Inventory.Resources(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	containsItems := len(itemsRaw) > 0
-	return pointer.To(containsItems), nil
-}
+	// Resource Graph returns the Resource Group name in lower-case, so map this back to the Resource Group ID
+	ids := make(map[string]commonids.ResourceGroupId)
+	for _, candidate := range candidates {
+		ids[strings.ToLower(candidate.ID.ResourceGroupName)] = candidate.ID
+	}
 
-func shouldDeleteResourceGroup(input resourcegroups.ResourceGroup, prefix string) bool {
-	if prefix != "" {
-		if !strings.HasPrefix(strings.ToLower(*input.Name), strings.ToLower(prefix)) {
-			return false
+	protected := make(map[string]ProtectedResourceGroup)
+	for _, resource := range resources {
+		key := strings.ToLower(resource.ResourceGroup)
+		id, isCandidate := ids[key]
+		if !isCandidate {
+			continue
+		}
+		if _, exists := protected[key]; exists {
+			continue
+		}
+		tag := cc.Filters().ProtectedBy(&resource.Tags)
+		if tag == nil {
+			continue
+		}
+
+		cc.Logger.Printf("[DEBUG] Resource Group %q contains %q which is protected by the tag %q - Skipping..", id.ResourceGroupName, resource.ID, *tag)
+		protected[key] = ProtectedResourceGroup{
+			ID:          id,
+			ProtectedBy: resource.ID,
+			Tag:         *tag,
 		}
 	}
 
-	if tags := input.Tags; tags != nil {
-		for k := range *tags {
-			if strings.EqualFold(k, "donotdelete") {
-				return false
-			}
+	out := make([]ProtectedResourceGroup, 0)
+	for _, item := range protected {
+		out = append(out, item)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID.ResourceGroupName < out[j].ID.ResourceGroupName
+	})
+	return out, nil
+}
+
+func shouldDeleteResourceGroup(input resourcegroups.ResourceGroup, evaluator filters.Evaluator) bool {
+	return evaluator.ShouldDeleteResourceGroup(*input.Name, input.Tags)
+}
+
+const (
+	// QuarantineMarkedAtTag is the Tag containing the (RFC3339) time a Resource Group was marked for deletion
+	QuarantineMarkedAtTag = "dalek-marked-at"
+
+	// QuarantineRunIDTag is the Tag containing the ID of the run which marked a Resource Group for deletion
+	QuarantineRunIDTag = "dalek-run-id"
+)
+
+// quarantineResourceGroup marks the Resource Group for deletion when it isn't already marked, returning
+// true when the Resource Group has been marked for longer than the grace period and can be deleted.
+//
+// The tags are retrieved again here (rather than using those from the list) so that removing the tag
+// during the grace period saves the Resource Group, even part-way through a run. `ignorePrefix` is passed
+// through to the Gateway, for Resource Groups which are deleted regardless of the Prefix (e.g. once expired).
+func quarantineResourceGroup(ctx context.Context, cc *CleanupContext, id commonids.ResourceGroupId, now time.Time, ignorePrefix bool) (bool, error) {
+	existing, err := cc.Client.ResourceManager.ResourcesGroupsClient.Get(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("retrieving %s: %+v", id, err)
+	}
+	var tags *map[string]string
+	if existing.Model != nil {
+		tags = existing.Model.Tags
+	}
+
+	for k, v := range pointer.From(tags) {
+		if !strings.EqualFold(k, QuarantineMarkedAtTag) {
+			continue
+		}
+
+		markedAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return false, fmt.Errorf("parsing the %q tag %q: %+v", k, v, err)
 		}
+		if remaining := markedAt.Add(cc.Options.Quarantine.GracePeriod).Sub(now); remaining > 0 {
+			cc.Logger.Printf("[DEBUG]   Resource Group %q was marked for deletion at %s - %s of the grace period remains, Skipping..", id.ResourceGroupName, v, remaining.Round(time.Second))
+			return false, nil
+		}
+
+		cc.Logger.Printf("[DEBUG]   Resource Group %q was marked for deletion at %s and the grace period has elapsed", id.ResourceGroupName, v)
+		return true, nil
+	}
+
+	updatedTags := make(map[string]string)
+	for k, v := range pointer.From(tags) {
+		updatedTags[k] = v
 	}
+	updatedTags[QuarantineMarkedAtTag] = now.UTC().Format(time.RFC3339)
+	updatedTags[QuarantineRunIDTag] = cc.Options.RunID
 
-	return true
+	req := gateway.Request{
+		Operation:    gateway.OperationUpdate,
+		Target:       id.ID(),
+		Tags:         tags,
+		IgnorePrefix: ignorePrefix,
+	}
+	err = cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+		cc.Logger.Printf("[DEBUG]   Marking Resource Group %q for deletion..", id.ResourceGroupName)
+		payload := resourcegroups.ResourceGroupPatchable{
+			Tags: pointer.To(updatedTags),
+		}
+		_, err := cc.Client.ResourceManager.ResourcesGroupsClient.Update(ctx, id, payload)
+		return err
+	})
+	return false, err
 }
@@ -0,0 +1,167 @@
+package cleaners
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/lang/pointer"
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// TestDeleteResourceGroupsOnlyRunsCleanersForPresentResourceTypes replays the `resource_groups` cassette (where
+// the Resource Group only contains a Lock) with every Resource Group Cleaner registered - any other cleaner
+// which ran would send requests which aren't in the cassette.
+func TestDeleteResourceGroupsOnlyRunsCleanersForPresentResourceTypes(t *testing.T) {
+	disableDelays(t)
+	cassette, err := transports.LoadCassette(filepath.Join("testdata", "cassettes", "resource_groups.json"))
+	if err != nil {
+		t.Fatalf("loading cassette: %+v", err)
+	}
+	replayer := transports.NewReplayer(*cassette)
+	client := testclient.New(t, replayer)
+	r := report.New()
+	started := make([]string, 0)
+	dispatcher := events.NewDispatcher("", events.ObserverFunc(func(ctx context.Context, event events.Event) {
+		if event.Type == events.TypeCleanerStarted {
+			started = append(started, event.Cleaner)
+		}
+	}))
+	cc := NewCleanupContext(client, gateway.New(faultOptions, r, log.Default(), dispatcher), r, log.Default(), faultOptions)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cleaner := NewDeleteResourceGroupsCleaner(DefaultResourceGroupCleaners())
+	if err := cleaner.Cleanup(ctx, commonids.NewSubscriptionID(testclient.SubscriptionID), cc); err != nil {
+		t.Fatalf("running the cleaner: %+v", err)
+	}
+	assertReplayed(t, replayer, r)
+
+	if expected := (removeLocksFromResourceGroupCleaner{}).Name(); len(started) != 1 || started[0] != expected {
+		t.Errorf("expected only %q to run but got %q", expected, started)
+	}
+}
+
+func TestFindResourceGroupsToDeleteMinimumAge(t *testing.T) {
+	now := time.Now().UTC()
+	subscriptionUrl := "https://management.azure.com/subscriptions/" + testclient.SubscriptionID
+	queryUrl := "https://management.azure.com/providers/Microsoft.ResourceGraph/resources?api-version=2022-10-01"
+	encode := func(input interface{}) json.RawMessage {
+		out, err := json.Marshal(input)
+		if err != nil {
+			t.Fatalf("encoding: %+v", err)
+		}
+		return out
+	}
+	resourceGroup := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":       commonids.NewResourceGroupID(testclient.SubscriptionID, name).ID(),
+			"name":     name,
+			"location": "westeurope",
+		}
+	}
+	// the creation time of each resource comes from the Inventory, rather than listing the resources in each Resource Group
+	resource := func(resourceGroupName string, createdAt *time.Time) map[string]interface{} {
+		out := map[string]interface{}{
+			"id":            commonids.NewResourceGroupID(testclient.SubscriptionID, resourceGroupName).ID() + "/providers/Microsoft.Network/virtualNetworks/example",
+			"name":          "example",
+			"type":          "microsoft.network/virtualnetworks",
+			"resourceGroup": resourceGroupName,
+			"location":      "westeurope",
+			"createdAt":     nil,
+		}
+		if createdAt != nil {
+			out["createdAt"] = createdAt.Format(time.RFC3339)
+		}
+		return out
+	}
+	inventory := []map[string]interface{}{
+		resource("acctestRG-new", pointer.To(now.Add(-time.Hour))),
+		resource("acctestRG-new", pointer.To(now.Add(-2*time.Hour))),
+		resource("acctestRG-old", pointer.To(now.Add(-time.Hour))),
+		resource("acctestRG-old", pointer.To(now.Add(-48*time.Hour))),
+		// created before the change history retained by Resource Graph
+		resource("acctestRG-predates", nil),
+	}
+	cassette := transports.Cassette{
+		Interactions: []transports.Interaction{
+			{
+				Request: transports.CassetteRequest{Method: "GET", URL: subscriptionUrl + "/resourceGroups?api-version=2022-09-01"},
+				Response: transports.CassetteResponse{
+					StatusCode: 200,
+					Body: encode(map[string]interface{}{
+						"value": []map[string]interface{}{
+							resourceGroup("acctestRG-empty-new"),
+							resourceGroup("acctestRG-empty-old"),
+							resourceGroup("acctestRG-new"),
+							resourceGroup("acctestRG-old"),
+							resourceGroup("acctestRG-predates"),
+						},
+					}),
+				},
+			},
+			{
+				Request: transports.CassetteRequest{Method: "POST", URL: queryUrl},
+				Response: transports.CassetteResponse{
+					StatusCode: 200,
+					Body:       encode(map[string]interface{}{"count": len(inventory), "data": inventory, "resultTruncated": "false", "totalRecords": len(inventory)}),
+				},
+			},
+			{
+				// only the empty Resource Group created recently has a record in the change history
+				Request: transports.CassetteRequest{Method: "POST", URL: queryUrl},
+				Response: transports.CassetteResponse{
+					StatusCode: 200,
+					Body: encode(map[string]interface{}{
+						"count": 1,
+						"data": []map[string]interface{}{
+							{
+								"targetResourceId": commonids.NewResourceGroupID(testclient.SubscriptionID, "acctestRG-empty-new").ID(),
+								"createdAt":        now.Add(-time.Hour).Format(time.RFC3339),
+							},
+						},
+						"resultTruncated": "false",
+						"totalRecords":    1,
+					}),
+				},
+			},
+		},
+	}
+	replayer := transports.NewReplayer(cassette)
+	client := testclient.New(t, replayer)
+	opts := faultOptions
+	opts.Age.MinimumAge = 24 * time.Hour
+	cc := newCleanupContext(client, report.New(), opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// the Resource Groups are only retrieved once per run, so the second call is served from the cache
+	for i := 0; i < 2; i++ {
+		candidates, err := FindResourceGroupsToDelete(ctx, cc, commonids.NewSubscriptionID(testclient.SubscriptionID))
+		if err != nil {
+			t.Fatalf("finding the Resource Groups to delete: %+v", err)
+		}
+
+		names := make([]string, 0)
+		for _, candidate := range candidates.ResourceGroups {
+			names = append(names, candidate.ID.ResourceGroupName)
+		}
+		if expected := []string{"acctestRG-empty-old", "acctestRG-old", "acctestRG-predates"}; !reflect.DeepEqual(names, expected) {
+			t.Fatalf("expected the Resource Groups %q but got %q", expected, names)
+		}
+	}
+	for _, interaction := range replayer.Unused() {
+		t.Errorf("expected every interaction in the cassette to be replayed but %s %s wasn't", interaction.Request.Method, interaction.Request.URL)
+	}
+}
@@ -3,15 +3,11 @@ package cleaners
 import (
 	"context"
 	"fmt"
-	"log"
-	"strings"
 
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/storagesync/2020-03-01/cloudendpointresource"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/storagesync/2020-03-01/storagesyncservicesresource"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/storagesync/2020-03-01/syncgroupresource"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
 )
 
 type deleteStorageSyncSubscriptionCleaner struct{}
@@ -22,10 +18,14 @@ func (p deleteStorageSyncSubscriptionCleaner) Name() string {
 	return "Removing Storage Sync"
 }
 
-func (p deleteStorageSyncSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, client *clients.AzureClient, opts options.Options) error {
-	storageSyncClient := client.ResourceManager.StorageSyncClient
-	storageSyncGroupClient := client.ResourceManager.StorageSyncGroupClient
-	storageSyncCloudEndpointClient := client.ResourceManager.StorageSyncCloudEndpointClient
+func (p deleteStorageSyncSubscriptionCleaner) ResourceTypes() []string {
+	return []string{
+		"Microsoft.StorageSync/storageSyncServices",
+	}
+}
+
+func (p deleteStorageSyncSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, cc *CleanupContext) error {
+	storageSyncClient := cc.Client.ResourceManager.StorageSyncClient
 
 	storageSyncList, err := storageSyncClient.StorageSyncServicesListBySubscription(ctx, subscriptionId)
 	if err != nil {
@@ -36,97 +36,101 @@ func (p deleteStorageSyncSubscriptionCleaner) Cleanup(ctx context.Context, subsc
 		return fmt.Errorf("listing storage syncs: model/value was nil")
 	}
 
+	storageSyncs := make([]Listed[storagesyncservicesresource.StorageSyncServiceId], 0)
 	for _, storageSync := range *storageSyncList.Model.Value {
 		if storageSync.Id == nil {
 			continue
 		}
 
-		storageSyncForGroupId, err := syncgroupresource.ParseStorageSyncServiceID(*storageSync.Id)
+		storageSyncId, err := storagesyncservicesresource.ParseStorageSyncServiceID(*storageSync.Id)
 		if err != nil {
 			return err
 		}
+		storageSyncs = append(storageSyncs, Listed[storagesyncservicesresource.StorageSyncServiceId]{
+			ID:   *storageSyncId,
+			Tags: storageSync.Tags,
+		})
+	}
 
-		if !strings.HasPrefix(storageSyncForGroupId.ResourceGroupName, opts.Prefix) {
-			log.Printf("[DEBUG] Not deleting %q as it does not match target RG prefix %q", *storageSyncForGroupId, opts.Prefix)
-			continue
-		}
+	return TearDown(ctx, cc, storageSyncs, storageSyncServiceTeardown)
+}
 
-		if !opts.ActuallyDelete {
-			log.Printf("[DEBUG] Would have deleted %s..", storageSyncForGroupId)
-			continue
-		}
+// storageSyncServiceTeardown deletes the Cloud Endpoints within each Sync Group, then the Sync Groups, then
+// the Storage Sync Service
+var storageSyncServiceTeardown = Level[storagesyncservicesresource.StorageSyncServiceId]{
+	Name: "Storage Sync Service",
+	Children: []ChildLevel[storagesyncservicesresource.StorageSyncServiceId]{
+		Children(listStorageSyncGroups, Level[syncgroupresource.SyncGroupId]{
+			Name: "Storage Sync Group",
+			Children: []ChildLevel[syncgroupresource.SyncGroupId]{
+				Children(listStorageSyncCloudEndpoints, Level[cloudendpointresource.CloudEndpointId]{
+					Name: "Storage Sync Cloud Endpoint",
+					Delete: func(ctx context.Context, cc *CleanupContext, id cloudendpointresource.CloudEndpointId) error {
+						return cc.Client.ResourceManager.StorageSyncCloudEndpointClient.CloudEndpointsDeleteThenPoll(ctx, id)
+					},
+				}),
+			},
+			Delete: func(ctx context.Context, cc *CleanupContext, id syncgroupresource.SyncGroupId) error {
+				_, err := cc.Client.ResourceManager.StorageSyncGroupClient.SyncGroupsDelete(ctx, id)
+				return err
+			},
+		}),
+	},
+	Delete: func(ctx context.Context, cc *CleanupContext, id storagesyncservicesresource.StorageSyncServiceId) error {
+		return cc.Client.ResourceManager.StorageSyncClient.StorageSyncServicesDeleteThenPoll(ctx, id)
+	},
+}
 
-		groupList, err := storageSyncGroupClient.SyncGroupsListByStorageSyncService(ctx, *storageSyncForGroupId)
-		if err != nil {
-			return fmt.Errorf("listing storage sync groups for %s: %+v", storageSyncForGroupId, err)
-		}
+func listStorageSyncGroups(ctx context.Context, cc *CleanupContext, storageSyncId storagesyncservicesresource.StorageSyncServiceId) ([]Listed[syncgroupresource.SyncGroupId], error) {
+	id := syncgroupresource.NewStorageSyncServiceID(storageSyncId.SubscriptionId, storageSyncId.ResourceGroupName, storageSyncId.StorageSyncServiceName)
+	groupList, err := cc.Client.ResourceManager.StorageSyncGroupClient.SyncGroupsListByStorageSyncService(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 
-		if groupList.Model == nil || groupList.Model.Value == nil {
+	out := make([]Listed[syncgroupresource.SyncGroupId], 0)
+	if groupList.Model == nil || groupList.Model.Value == nil {
+		return out, nil
+	}
+	for _, group := range *groupList.Model.Value {
+		if group.Id == nil {
 			continue
 		}
 
-		for _, group := range *groupList.Model.Value {
-			if group.Id == nil {
-				continue
-			}
+		groupId, err := syncgroupresource.ParseSyncGroupID(*group.Id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Listed[syncgroupresource.SyncGroupId]{
+			ID: *groupId,
+		})
+	}
+	return out, nil
+}
 
-			groupIdForCloudEndpoint, err := cloudendpointresource.ParseSyncGroupID(*group.Id)
-			if err != nil {
-				return err
-			}
-
-			if !opts.ActuallyDelete {
-				log.Printf("[DEBUG] Would have deleted %s..", groupIdForCloudEndpoint)
-				continue
-			}
-
-			cloudEndpointList, err := storageSyncCloudEndpointClient.CloudEndpointsListBySyncGroup(ctx, *groupIdForCloudEndpoint)
-			if err != nil {
-				return fmt.Errorf("listing cloud endpoints for %s: %+v", groupIdForCloudEndpoint, err)
-			}
-
-			if cloudEndpointList.Model == nil || cloudEndpointList.Model.Value == nil {
-				continue
-			}
-
-			for _, endpoint := range *cloudEndpointList.Model.Value {
-				if endpoint.Id == nil {
-					continue
-				}
-
-				endpointId, err := cloudendpointresource.ParseCloudEndpointID(*endpoint.Id)
-				if err != nil {
-					return err
-				}
-
-				if !opts.ActuallyDelete {
-					log.Printf("[DEBUG] Would have deleted %s..", endpointId)
-					continue
-				}
-
-				if err = storageSyncCloudEndpointClient.CloudEndpointsDeleteThenPoll(ctx, *endpointId); err != nil {
-					return fmt.Errorf("deleting %s: %+v", endpointId, err)
-				}
-			}
-
-			groupId, err := syncgroupresource.ParseSyncGroupID(*group.Id)
-			if err != nil {
-				return err
-			}
+func listStorageSyncCloudEndpoints(ctx context.Context, cc *CleanupContext, groupId syncgroupresource.SyncGroupId) ([]Listed[cloudendpointresource.CloudEndpointId], error) {
+	id := cloudendpointresource.NewSyncGroupID(groupId.SubscriptionId, groupId.ResourceGroupName, groupId.StorageSyncServiceName, groupId.SyncGroupName)
+	cloudEndpointList, err := cc.Client.ResourceManager.StorageSyncCloudEndpointClient.CloudEndpointsListBySyncGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 
-			if _, err = storageSyncGroupClient.SyncGroupsDelete(ctx, *groupId); err != nil {
-				return fmt.Errorf("deleting %s: %+v", groupId, err)
-			}
+	out := make([]Listed[cloudendpointresource.CloudEndpointId], 0)
+	if cloudEndpointList.Model == nil || cloudEndpointList.Model.Value == nil {
+		return out, nil
+	}
+	for _, endpoint := range *cloudEndpointList.Model.Value {
+		if endpoint.Id == nil {
+			continue
 		}
 
-		storageSyncId, err := storagesyncservicesresource.ParseStorageSyncServiceID(*storageSync.Id)
+		endpointId, err := cloudendpointresource.ParseCloudEndpointID(*endpoint.Id)
 		if err != nil {
-			return err
-		}
-		if err = storageSyncClient.StorageSyncServicesDeleteThenPoll(ctx, *storageSyncId); err != nil {
-			return fmt.Errorf("deleting %s: %+v", storageSyncId, err)
+			return nil, err
 		}
+		out = append(out, Listed[cloudendpointresource.CloudEndpointId]{
+			ID: *endpointId,
+		})
 	}
-
-	return nil
+	return out, nil
 }
@@ -2,14 +2,12 @@ package cleaners
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
 
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/machinelearningservices/2023-10-01/workspaces"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
 )
 
 var _ SubscriptionCleaner = purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner{}
@@ -21,8 +19,14 @@ func (p purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner) Name() s
 	return "Purging Soft Deleted Machine Learning Workspaces in Subscription"
 }
 
-func (p purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, client *clients.AzureClient, opts options.Options) error {
-	softDeletedWorkspaces, err := client.ResourceManager.MachineLearningWorkspacesClient.ListBySubscriptionComplete(ctx, subscriptionId, workspaces.DefaultListBySubscriptionOperationOptions())
+func (p purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner) ResourceTypes() []string {
+	return []string{
+		"Microsoft.MachineLearningServices/workspaces",
+	}
+}
+
+func (p purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, cc *CleanupContext) error {
+	softDeletedWorkspaces, err := cc.Client.ResourceManager.MachineLearningWorkspacesClient.ListBySubscriptionComplete(ctx, subscriptionId, workspaces.DefaultListBySubscriptionOperationOptions())
 	if err != nil {
 		return fmt.Errorf("loading the Machine Learning Workspaces within %s: %+v", subscriptionId, err)
 	}
@@ -33,23 +37,25 @@ func (p purgeSoftDeletedMachineLearningWorkspacesInSubscriptionCleaner) Cleanup(
 			return fmt.Errorf("parsing Machine Learning Workspace ID %q: %+v", *workspace.Id, err)
 		}
 
-		if !strings.HasSuffix(workspaceId.ResourceGroupName, opts.Prefix) {
-			log.Printf("[DEBUG] Not deleting Machine Learning Workspace %q as it does not match target RG prefix %q", *workspaceId, opts.Prefix)
+		// the Resource Group name must start with the prefix, as for every other Cleaner (and as the gateway
+		// requires) - this used to match Resource Groups whose name ended with the prefix
+		if !cc.Filters().MatchesPrefix(workspaceId.ResourceGroupName) {
+			cc.Logger.Printf("[DEBUG] Not deleting Machine Learning Workspace %q as it does not match target RG prefix %q", *workspaceId, cc.Options.Prefix)
 			continue
 		}
 
-		log.Printf("[DEBUG] Purging Soft-Deleted %s..", *workspaceId)
-		if !opts.ActuallyDelete {
-			log.Printf("[DEBUG] Would have purged soft-deleted Machine Learning Workspace %q..", *workspaceId)
-			continue
+		req := gateway.Request{
+			Operation: gateway.OperationPurge,
+			Target:    workspaceId.ID(),
+			Tags:      workspace.Tags,
 		}
-
-		purge := true
-		log.Printf("[DEBUG] Purging Soft-Deleted %s..", *workspaceId)
-		if err := client.ResourceManager.MachineLearningWorkspacesClient.DeleteThenPoll(ctx, *workspaceId, workspaces.DeleteOperationOptions{ForceToPurge: &purge}); err != nil {
+		err = cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+			purge := true
+			return cc.Client.ResourceManager.MachineLearningWorkspacesClient.DeleteThenPoll(ctx, *workspaceId, workspaces.DeleteOperationOptions{ForceToPurge: &purge})
+		})
+		if err != nil && !errors.Is(err, gateway.ErrBlocked) {
 			return fmt.Errorf("purging %s: %+v", *workspaceId, err)
 		}
-		log.Printf("[DEBUG] Purged Soft-Deleted %s.", *workspaceId)
 	}
 	return nil
 }
@@ -2,13 +2,12 @@ package cleaners
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/keyvault/2023-07-01/managedhsms"
-	"github.com/tombuildsstuff/azurerm-dalek/clients"
-	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
 )
 
 var _ SubscriptionCleaner = purgeSoftDeletedManagedHSMsInSubscriptionCleaner{}
@@ -20,8 +19,14 @@ func (p purgeSoftDeletedManagedHSMsInSubscriptionCleaner) Name() string {
 	return "Purging Soft Deleted Key Vaults in Subscription"
 }
 
-func (p purgeSoftDeletedManagedHSMsInSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, client *clients.AzureClient, opts options.Options) error {
-	softDeletedHSMs, err := client.ResourceManager.ManagedHSMsClient.ListDeletedComplete(ctx, subscriptionId)
+func (p purgeSoftDeletedManagedHSMsInSubscriptionCleaner) ResourceTypes() []string {
+	return []string{
+		"Microsoft.KeyVault/managedHSMs",
+	}
+}
+
+func (p purgeSoftDeletedManagedHSMsInSubscriptionCleaner) Cleanup(ctx context.Context, subscriptionId commonids.SubscriptionId, cc *CleanupContext) error {
+	softDeletedHSMs, err := cc.Client.ResourceManager.ManagedHSMsClient.ListDeletedComplete(ctx, subscriptionId)
 	if err != nil {
 		return fmt.Errorf("loading the Soft-Deleted Managed HSMs within %s: %+v", subscriptionId, err)
 	}
@@ -30,18 +35,16 @@ func (p purgeSoftDeletedManagedHSMsInSubscriptionCleaner) Cleanup(ctx context.Co
 		if err != nil {
 			return fmt.Errorf("parsing Managed HSM ID %q: %+v", *hsm.Id, err)
 		}
-		log.Printf("[DEBUG] Purging Soft-Deleted %s..", *hsmId)
-
-		if !opts.ActuallyDelete {
-			log.Printf("[DEBUG] Would have purged soft-deleted Managed HSM %q..", *hsmId)
-			continue
+		req := gateway.Request{
+			Operation: gateway.OperationPurge,
+			Target:    hsmId.ID(),
 		}
-
-		log.Printf("[DEBUG] Purging Soft-Deleted %s..", *hsmId)
-		if err := client.ResourceManager.ManagedHSMsClient.PurgeDeletedThenPoll(ctx, *hsmId); err != nil {
+		err = cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+			return cc.Client.ResourceManager.ManagedHSMsClient.PurgeDeletedThenPoll(ctx, *hsmId)
+		})
+		if err != nil && !errors.Is(err, gateway.ErrBlocked) {
 			return fmt.Errorf("purging %s: %+v", *hsmId, err)
 		}
-		log.Printf("[DEBUG] Purged Soft-Deleted %s.", *hsmId)
 	}
 	return nil
 }
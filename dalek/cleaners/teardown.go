@@ -0,0 +1,180 @@
+package cleaners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/resourceids"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+)
+
+// teardownRetryDelay is how long to wait before retrying a failed deletion - this is a variable so that tests
+// replaying a cassette don't need to wait
+var teardownRetryDelay = 30 * time.Second
+
+// ResourceID is implemented by each of the typed Resource IDs in the SDK
+type ResourceID interface {
+	ID() string
+	String() string
+}
+
+// Listed is a resource returned when listing the resources of type T
+type Listed[T ResourceID] struct {
+	ID T
+
+	// Tags are the Tags on the resource, which are checked by the Gateway before it's deleted
+	Tags *map[string]string
+}
+
+// Level describes how to tear down a resource of type T within a hierarchy - each of its Children are torn
+// down (in order) and then the resource itself is deleted through the Gateway, so that dry-run, the protection
+// filters and reporting are handled the same way for every resource.
+type Level[T ResourceID] struct {
+	// Name is the kind of resource, e.g. `NetApp Volume`, which is used in log messages
+	Name string
+
+	// Children are the kinds of resource within this resource, which must be torn down before it's deleted
+	Children []ChildLevel[T]
+
+	// Delete deletes the resource, which is only called when the Dalek is actually deleting things
+	Delete func(ctx context.Context, cc *CleanupContext, id T) error
+
+	// Retries is the number of times Delete is retried when it returns an error
+	Retries int
+}
+
+// ChildLevel is a kind of resource within a parent resource of type P, see Children
+type ChildLevel[P ResourceID] interface {
+	tearDownWithin(ctx context.Context, cc *CleanupContext, parent Listed[P], blocked *string) error
+}
+
+type childLevel[P ResourceID, C ResourceID] struct {
+	list  func(ctx context.Context, cc *CleanupContext, parent P) ([]Listed[C], error)
+	level Level[C]
+}
+
+// Children returns a ChildLevel which uses `list` to find the resources of type C within a parent of type P,
+// tearing each of them down using `level`
+func Children[P ResourceID, C ResourceID](list func(ctx context.Context, cc *CleanupContext, parent P) ([]Listed[C], error), level Level[C]) ChildLevel[P] {
+	return childLevel[P, C]{
+		list:  list,
+		level: level,
+	}
+}
+
+func (c childLevel[P, C]) tearDownWithin(ctx context.Context, cc *CleanupContext, parent Listed[P], blocked *string) error {
+	items, err := c.list(ctx, cc, parent.ID)
+	if err != nil {
+		return fmt.Errorf("listing the %ss within %s: %+v", c.level.Name, parent.ID, err)
+	}
+
+	errs := make([]error, 0)
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		// not every child resource supports tags, so those which don't are protected by the tags on their parent
+		if item.Tags == nil {
+			item.Tags = parent.Tags
+		}
+		if err := c.level.tearDown(ctx, cc, item, blocked); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TearDown tears down each of the `roots` within a Resource Group matching the Prefix using `level`. A resource
+// which can't be torn down doesn't stop the others from being torn down, instead the errors for each are combined
+// and returned once every root has been walked.
+func TearDown[T ResourceID](ctx context.Context, cc *CleanupContext, roots []Listed[T], level Level[T]) error {
+	errs := make([]error, 0)
+	for _, root := range roots {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		parsed, err := resourceids.ParseAzureResourceID(root.ID.ID())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("parsing %q: %+v", root.ID.ID(), err))
+			continue
+		}
+		if !cc.Filters().MatchesPrefix(parsed.ResourceGroup) {
+			cc.Logger.Printf("[DEBUG] Not deleting %q as it does not match target RG prefix %q", root.ID, cc.Options.Prefix)
+			continue
+		}
+
+		if err := level.tearDown(ctx, cc, root, nil); err != nil {
+			cc.Logger.Printf("[DEBUG] Tearing down %s %s failed, moving on to the next one: %+v", level.Name, root.ID, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// tearDown tears down the resources within `item` and then deletes it. The Gateway's filters are checked before
+// walking the children, so that when `item` is blocked (or `blocked` is set, because a parent is) the whole
+// subtree is skipped rather than being deleted out from under a protected parent. Every child is walked even
+// when one of them fails, but `item` itself is then skipped since it can't be deleted whilst it contains them.
+func (l Level[T]) tearDown(ctx context.Context, cc *CleanupContext, item Listed[T], blocked *string) error {
+	req := gateway.Request{
+		Operation: gateway.OperationDelete,
+		Target:    item.ID.ID(),
+		Tags:      item.Tags,
+	}
+	if blocked == nil {
+		if reason := cc.Gateway.Blocked(req); reason != nil {
+			cc.Gateway.Skip(ctx, req, *reason)
+			reason := fmt.Sprintf("the parent %s %s was skipped: %s", l.Name, item.ID, *reason)
+			blocked = &reason
+		}
+	} else {
+		cc.Gateway.Skip(ctx, req, *blocked)
+	}
+
+	errs := make([]error, 0)
+	for _, child := range l.Children {
+		if err := child.tearDownWithin(ctx, cc, item, blocked); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if blocked != nil {
+		return errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		cc.Gateway.Skip(ctx, req, fmt.Sprintf("%d of the resources within it couldn't be deleted", len(errs)))
+		return errors.Join(errs...)
+	}
+
+	err := cc.Gateway.Do(ctx, req, func(ctx context.Context) error {
+		cc.Logger.Printf("[DEBUG] Deleting %s %s..", l.Name, item.ID)
+		err := l.Delete(ctx, cc, item.ID)
+		for attempt := 1; err != nil && attempt <= l.Retries; attempt++ {
+			cc.Logger.Printf("[DEBUG] Deleting %s %s failed, retrying in %s (attempt %d of %d): %+v", l.Name, item.ID, teardownRetryDelay, attempt, l.Retries, err)
+			if err := sleep(ctx, teardownRetryDelay); err != nil {
+				return err
+			}
+			err = l.Delete(ctx, cc, item.ID)
+		}
+		return err
+	})
+	if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+		return fmt.Errorf("deleting %s: %+v", item.ID, err)
+	}
+	return nil
+}
+
+// sleep waits for `duration` to pass, returning early with an error if the context is cancelled
+func sleep(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+		return nil
+	}
+}
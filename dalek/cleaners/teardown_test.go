@@ -0,0 +1,131 @@
+package cleaners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+type teardownTestId string
+
+func (id teardownTestId) ID() string {
+	return string(id)
+}
+
+func (id teardownTestId) String() string {
+	return fmt.Sprintf("Test ID %q", string(id))
+}
+
+func TestTearDown(t *testing.T) {
+	disableDelays(t)
+	parentId := func(resourceGroupName, name string) teardownTestId {
+		return teardownTestId(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Test/parents/%s", testclient.SubscriptionID, resourceGroupName, name))
+	}
+	roots := []Listed[teardownTestId]{
+		{ID: parentId("acctestRG-1", "first")},
+		{ID: parentId("production", "second")},
+		{ID: parentId("acctestRG-2", "third"), Tags: &map[string]string{"DoNotDelete": "true"}},
+		{ID: parentId("acctestRG-3", "fourth")},
+	}
+
+	testData := []struct {
+		name           string
+		actuallyDelete bool
+		failures       int
+		retries        int
+		expectError    bool
+		expected       []string
+		expectedCounts map[report.Outcome]int
+	}{
+		{
+			name:           "children are deleted before their parent",
+			actuallyDelete: true,
+			// the children of `third` are skipped since it's protected
+			expected:       []string{"first/children/1", "first/children/2", "first", "fourth/children/1", "fourth/children/2", "fourth"},
+			expectedCounts: map[report.Outcome]int{report.OutcomeSucceeded: 6, report.OutcomeSkipped: 3},
+		},
+		{
+			name:           "dry-run",
+			expectedCounts: map[report.Outcome]int{report.OutcomeDryRun: 6, report.OutcomeSkipped: 3},
+		},
+		{
+			name:           "failures are retried",
+			actuallyDelete: true,
+			failures:       1,
+			retries:        1,
+			expected:       []string{"first/children/1", "first/children/1", "first/children/2", "first", "fourth/children/1", "fourth/children/2", "fourth"},
+			expectedCounts: map[report.Outcome]int{report.OutcomeSucceeded: 6, report.OutcomeSkipped: 3},
+		},
+		{
+			name:           "failures are returned",
+			actuallyDelete: true,
+			failures:       2,
+			retries:        1,
+			expectError:    true,
+			// the sibling and the later roots are still deleted, but `first` is skipped since one of its children remains
+			expected:       []string{"first/children/1", "first/children/1", "first/children/2", "fourth/children/1", "fourth/children/2", "fourth"},
+			expectedCounts: map[report.Outcome]int{report.OutcomeFailed: 1, report.OutcomeSucceeded: 4, report.OutcomeSkipped: 4},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			deleted := make([]string, 0)
+			failures := v.failures
+			deleteFunc := func(ctx context.Context, cc *CleanupContext, id teardownTestId) error {
+				name := strings.SplitN(id.ID(), "/parents/", 2)[1]
+				deleted = append(deleted, name)
+				if failures > 0 {
+					failures--
+					return errors.New("failure")
+				}
+				return nil
+			}
+			level := Level[teardownTestId]{
+				Name: "Parent",
+				Children: []ChildLevel[teardownTestId]{
+					Children(func(ctx context.Context, cc *CleanupContext, parent teardownTestId) ([]Listed[teardownTestId], error) {
+						return []Listed[teardownTestId]{
+							{ID: teardownTestId(parent.ID() + "/children/1")},
+							{ID: teardownTestId(parent.ID() + "/children/2")},
+						}, nil
+					}, Level[teardownTestId]{
+						Name:    "Child",
+						Delete:  deleteFunc,
+						Retries: v.retries,
+					}),
+				},
+				Delete: deleteFunc,
+			}
+
+			opts := options.Options{
+				ActuallyDelete: v.actuallyDelete,
+				Prefix:         "acctest",
+			}
+			r := report.New()
+			cc := newCleanupContext(testclient.New(t, transports.NewReplayer(transports.Cassette{})), r, opts)
+			err := TearDown(faultContext(t), cc, roots, level)
+			if v.expectError != (err != nil) {
+				t.Fatalf("expected an error %t but got: %+v", v.expectError, err)
+			}
+
+			if len(v.expected) > 0 && !reflect.DeepEqual(deleted, v.expected) {
+				t.Errorf("expected %q to be deleted but got %q", v.expected, deleted)
+			}
+			counts := make(map[report.Outcome]int)
+			for _, action := range r.Actions() {
+				counts[action.Outcome]++
+			}
+			if !reflect.DeepEqual(counts, v.expectedCounts) {
+				t.Errorf("expected the outcomes %+v but got %+v", v.expectedCounts, counts)
+			}
+		})
+	}
+}
@@ -1,18 +1,241 @@
 package dalek
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/hashicorp/go-azure-sdk/sdk/environments"
 	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/cleaners"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/filters"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/history"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/interactive"
 	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
 )
 
+// Dalek runs the Cleaners against a Subscription - the state of a run (such as the Report, the cached Resource Groups
+// and the Inventory) is built by New, so each Dalek can only be run once and a new Dalek is needed for each run.
 type Dalek struct {
-	client *clients.AzureClient
-	opts   options.Options
+	cleanup *cleaners.CleanupContext
+	client  *clients.AzureClient
+	events  *events.Dispatcher
+	gateway *gateway.Gateway
+	history *historyConfig
+	logger  *log.Logger
+	opts    options.Options
+	report  *report.Report
+
+	// ownsClient specifies whether the AzureClient was built by (and so should be closed by) this Dalek
+	ownsClient bool
+	prompter   *interactive.Prompter
+
+	subscriptionCleaners  []cleaners.SubscriptionCleaner
+	resourceGroupCleaners []cleaners.ResourceGroupCleaner
+
+	// ran is whether Run has been called, since each Dalek can only be run once
+	ran     bool
+	runLock sync.Mutex
+}
+
+// Option configures a Dalek created using New
+type Option func(c *config)
+
+type config struct {
+	client        *clients.AzureClient
+	clientOptions clients.ClientOptions
+	credentials   *clients.Credentials
+	authorizers   *authorizersConfig
+	historyStore  *history.Store
+	logger        *log.Logger
+	observers     []events.Observer
+	prompter      *interactive.Prompter
+
+	subscriptionCleaners  []cleaners.SubscriptionCleaner
+	resourceGroupCleaners []cleaners.ResourceGroupCleaner
+}
+
+type authorizersConfig struct {
+	authorizers    clients.Authorizers
+	environment    environments.Environment
+	subscriptionId string
+}
+
+// WithAzureClient uses an existing AzureClient, which remains owned by the caller - this must be built with
+// `gateway.Guard` as the Guard in the ClientOptions, so that nothing can be mutated outside of the deletion gateway
+func WithAzureClient(client *clients.AzureClient) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+// WithAuthorizers builds the AzureClient for the specified Environment and Subscription using existing Authorizers
+func WithAuthorizers(environment environments.Environment, subscriptionId string, authorizers clients.Authorizers) Option {
+	return func(c *config) {
+		c.authorizers = &authorizersConfig{
+			authorizers:    authorizers,
+			environment:    environment,
+			subscriptionId: subscriptionId,
+		}
+	}
+}
+
+// WithCredentials builds the AzureClient by authenticating using the specified Credentials
+func WithCredentials(credentials clients.Credentials) Option {
+	return func(c *config) {
+		c.credentials = &credentials
+	}
+}
+
+// WithClientOptions configures the AzureClient built using WithAuthorizers or WithCredentials
+func WithClientOptions(clientOptions clients.ClientOptions) Option {
+	return func(c *config) {
+		c.clientOptions = clientOptions
+	}
+}
+
+// WithSubscriptionCleaner registers an additional Subscription Cleaner, which runs after the built-in ones
+func WithSubscriptionCleaner(cleaner cleaners.SubscriptionCleaner) Option {
+	return func(c *config) {
+		c.subscriptionCleaners = append(c.subscriptionCleaners, cleaner)
+	}
+}
+
+// WithResourceGroupCleaner registers an additional Resource Group Cleaner, which runs after the built-in ones
+func WithResourceGroupCleaner(cleaner cleaners.ResourceGroupCleaner) Option {
+	return func(c *config) {
+		c.resourceGroupCleaners = append(c.resourceGroupCleaners, cleaner)
+	}
+}
+
+// WithLogger specifies the Logger used by the Dalek, defaulting to the standard Logger
+func WithLogger(logger *log.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithObserver registers an Observer which is notified of each Event during the run
+func WithObserver(observer events.Observer) Option {
+	return func(c *config) {
+		c.observers = append(c.observers, observer)
+	}
+}
+
+// WithPrompter asks the user which Resource Groups and Cleaners to use, and to confirm each deletion
+func WithPrompter(prompter *interactive.Prompter) Option {
+	return func(c *config) {
+		c.prompter = prompter
+	}
+}
+
+// WithHistory appends an Entry describing each run to the specified Store once it completes
+func WithHistory(store *history.Store) Option {
+	return func(c *config) {
+		c.historyStore = store
+	}
+}
+
+// New returns a Dalek configured using the specified Options - exactly one of WithAzureClient,
+// WithAuthorizers or WithCredentials must be specified.
+func New(ctx context.Context, opts options.Options, configure ...Option) (*Dalek, error) {
+	cfg := config{
+		logger: log.Default(),
+	}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+
+	var nameAgeExtractor *filters.NameAgeExtractor
+	if opts.Age.NamePattern != "" {
+		extractor, err := filters.NewNameAgeExtractor(opts.Age.NamePattern, opts.Age.NameTimeLayout)
+		if err != nil {
+			return nil, fmt.Errorf("building the age extractor: %+v", err)
+		}
+		nameAgeExtractor = extractor
+	}
+
+	// any mutating requests are only sent when issued through the deletion gateway
+	clientOptions := cfg.clientOptions
+	clientOptions.Guard = gateway.Guard
+
+	client := cfg.client
+	ownsClient := false
+	switch {
+	case cfg.client != nil && cfg.authorizers == nil && cfg.credentials == nil:
+		if !cfg.client.Guarded() {
+			return nil, fmt.Errorf("the AzureClient specified using `WithAzureClient` must be built with `gateway.Guard` as the Guard in the ClientOptions")
+		}
+
+	case cfg.client == nil && cfg.authorizers != nil && cfg.credentials == nil:
+		c, err := clients.NewAzureClient(cfg.authorizers.environment, cfg.authorizers.authorizers, cfg.authorizers.subscriptionId, clientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("building Azure Clients: %+v", err)
+		}
+		client = c
+		ownsClient = true
+
+	case cfg.client == nil && cfg.authorizers == nil && cfg.credentials != nil:
+		c, err := clients.BuildAzureClient(ctx, *cfg.credentials, clientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("building Azure Clients: %+v", err)
+		}
+		client = c
+		ownsClient = true
+
+	default:
+		return nil, fmt.Errorf("exactly one of `WithAzureClient`, `WithAuthorizers` or `WithCredentials` must be specified")
+	}
+
+	// Cleaners for services which aren't available using the API Profile (e.g. on Azure Stack Hub) are turned off
+	resourceGroupCleaners, unsupportedResourceGroupCleaners := cleaners.SupportedResourceGroupCleaners(client.Profile, append(cleaners.DefaultResourceGroupCleaners(), cfg.resourceGroupCleaners...))
+	for _, cleaner := range unsupportedResourceGroupCleaners {
+		cfg.logger.Printf("[DEBUG] Resource Group Cleaner %q isn't supported by the API Profile %q - Skipping..", cleaner.Name(), client.Profile.Name)
+	}
+	subscriptionCleaners, unsupportedSubscriptionCleaners := cleaners.SupportedSubscriptionCleaners(client.Profile, append(cleaners.DefaultSubscriptionCleaners(resourceGroupCleaners), cfg.subscriptionCleaners...))
+	for _, cleaner := range unsupportedSubscriptionCleaners {
+		cfg.logger.Printf("[DEBUG] Subscription Cleaner %q isn't supported by the API Profile %q - Skipping..", cleaner.Name(), client.Profile.Name)
+	}
+
+	var hist *historyConfig
+	observers := cfg.observers
+	if cfg.historyStore != nil {
+		hist = &historyConfig{
+			store:    cfg.historyStore,
+			recorder: history.NewRecorder(),
+		}
+		observers = append(append([]events.Observer{}, observers...), hist.recorder)
+	}
+
+	r := report.New()
+	dispatcher := events.NewDispatcher(opts.RunID, observers...)
+	gw := gateway.New(opts, r, cfg.logger, dispatcher)
+	if nameAgeExtractor != nil {
+		gw.InferAgeFromNames(*nameAgeExtractor)
+	}
+	return &Dalek{
+		cleanup:               cleaners.NewCleanupContext(client, gw, r, cfg.logger, opts),
+		client:                client,
+		events:                dispatcher,
+		gateway:               gw,
+		history:               hist,
+		logger:                cfg.logger,
+		opts:                  opts,
+		ownsClient:            ownsClient,
+		prompter:              cfg.prompter,
+		report:                r,
+		resourceGroupCleaners: resourceGroupCleaners,
+		subscriptionCleaners:  subscriptionCleaners,
+	}, nil
 }
 
-func NewDalek(client *clients.AzureClient, opts options.Options) Dalek {
-	return Dalek{
-		client: client,
-		opts:   opts,
+// Close releases the AzureClient, when it was built by this Dalek
+func (d *Dalek) Close() {
+	if d.ownsClient {
+		d.client.Close()
 	}
 }
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"time"
+)
+
+type Type string
+
+const (
+	// TypeRunStarted is sent before any Cleaners are run
+	TypeRunStarted Type = "RunStarted"
+
+	// TypeRunCompleted is sent once the run has finished, Error is set when the run failed
+	TypeRunCompleted Type = "RunCompleted"
+
+	// TypeCleanerStarted is sent before a Cleaner is run against Target
+	TypeCleanerStarted Type = "CleanerStarted"
+
+	// TypeCleanerCompleted is sent after a Cleaner has been run against Target, Error is set when the Cleaner failed
+	TypeCleanerCompleted Type = "CleanerCompleted"
+
+	// TypeBudgetExceeded is sent when a Cleaner (or a Resource Group, when Cleaner is empty) doesn't complete
+	// within its time budget for Target, in which case the run moves on without it
+	TypeBudgetExceeded Type = "BudgetExceeded"
+
+	// TypeResourceDiscovered is sent when Target has been found to match the filters
+	TypeResourceDiscovered Type = "ResourceDiscovered"
+
+	// TypeResourceSkipped is sent when an Operation against Target isn't performed, with the Reason why
+	TypeResourceSkipped Type = "ResourceSkipped"
+
+	// TypeDeleteIssued is sent immediately before an Operation is performed against Target
+	TypeDeleteIssued Type = "DeleteIssued"
+
+	// TypeDeleteSucceeded is sent once an Operation against Target has completed successfully
+	TypeDeleteSucceeded Type = "DeleteSucceeded"
+
+	// TypeDeleteFailed is sent when an Operation against Target has failed, with the Error
+	TypeDeleteFailed Type = "DeleteFailed"
+)
+
+// Event describes something which happened during a run of the Dalek - the fields populated depend on the Type
+type Event struct {
+	Type Type
+	Time time.Time
+
+	// RunID is the ID of the run which this Event belongs to
+	RunID string
+
+	// Cleaner is the name of the Cleaner which this Event relates to, if any
+	Cleaner string
+
+	// Operation is the kind of mutation being performed, e.g. `delete`
+	Operation string
+
+	// Target is the Resource ID (or a description of the object) which this Event relates to
+	Target string
+
+	// Reason is why the Target was skipped
+	Reason string
+
+	// Error is the error which occurred, if any
+	Error error
+}
+
+// Observer receives each Event as it happens - Observers are called synchronously, so an Observer can (for example)
+// export a resource when it receives TypeDeleteIssued, before it's deleted.
+type Observer interface {
+	Notify(ctx context.Context, event Event)
+}
+
+var _ Observer = ObserverFunc(nil)
+
+// ObserverFunc allows a func to be used as an Observer
+type ObserverFunc func(ctx context.Context, event Event)
+
+func (f ObserverFunc) Notify(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+// Dispatcher sends each Event to each of the registered Observers
+type Dispatcher struct {
+	runId     string
+	observers []Observer
+}
+
+func NewDispatcher(runId string, observers ...Observer) *Dispatcher {
+	return &Dispatcher{
+		runId:     runId,
+		observers: observers,
+	}
+}
+
+// Notify sends `event` to each of the Observers, populating the RunID and Time
+func (d *Dispatcher) Notify(ctx context.Context, event Event) {
+	if d == nil {
+		return
+	}
+
+	event.RunID = d.runId
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, observer := range d.observers {
+		observer.Notify(ctx, event)
+	}
+}
@@ -0,0 +1,54 @@
+package filters
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// DefaultNameTimestampLayout is the layout of the timestamp at the start of the random integer used in
+// acceptance test names, e.g. `2401161234` in `acctestRG-240116123456789`
+const DefaultNameTimestampLayout = "0601021504"
+
+// NameAgeExtractor infers when a Resource Group was created from a timestamp within its name, for when the
+// creation time isn't available from Resource Manager
+type NameAgeExtractor struct {
+	pattern *regexp.Regexp
+	layout  string
+}
+
+// NewNameAgeExtractor returns a NameAgeExtractor which parses the first capture group of `pattern` (or the
+// whole match when `pattern` has no capture groups) using the time layout `layout`, in UTC
+func NewNameAgeExtractor(pattern string, layout string) (*NameAgeExtractor, error) {
+	expr, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the pattern %q: %+v", pattern, err)
+	}
+	if layout == "" {
+		return nil, fmt.Errorf("a time layout must be specified")
+	}
+
+	return &NameAgeExtractor{
+		pattern: expr,
+		layout:  layout,
+	}, nil
+}
+
+// CreatedAt returns when the Resource Group with the specified name was created, or nil when the name
+// doesn't contain a valid timestamp
+func (e NameAgeExtractor) CreatedAt(name string) *time.Time {
+	match := e.pattern.FindStringSubmatch(name)
+	if len(match) == 0 {
+		return nil
+	}
+
+	timestamp := match[0]
+	if len(match) > 1 {
+		timestamp = match[1]
+	}
+	createdAt, err := time.ParseInLocation(e.layout, timestamp, time.UTC)
+	if err != nil {
+		return nil
+	}
+	return &createdAt
+}
@@ -0,0 +1,37 @@
+package filters
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNameAgeExtractor(t *testing.T) {
+	extractor, err := NewNameAgeExtractor(`(?i)^acctestRG-(\d{10})`, DefaultNameTimestampLayout)
+	if err != nil {
+		t.Fatalf("building the extractor: %+v", err)
+	}
+
+	testData := map[string]*time.Time{
+		"acctestRG-240116123456789":  timePointer(time.Date(2024, 1, 16, 12, 34, 0, 0, time.UTC)),
+		"ACCTESTRG-231231235900001":  timePointer(time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC)),
+		"acctestRG-241399999999999":  nil,
+		"acctestRG-dalek":            nil,
+		"production-240116123456789": nil,
+	}
+	for name, expected := range testData {
+		actual := extractor.CreatedAt(name)
+		if expected == nil {
+			if actual != nil {
+				t.Errorf("expected no creation time for %q but got %s", name, actual)
+			}
+			continue
+		}
+		if actual == nil || !actual.Equal(*expected) {
+			t.Errorf("expected %q to have been created at %s but got %v", name, expected, actual)
+		}
+	}
+}
+
+func timePointer(input time.Time) *time.Time {
+	return &input
+}
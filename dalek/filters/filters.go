@@ -0,0 +1,126 @@
+package filters
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+)
+
+// DefaultProtectionTags are the Tag keys which prevent a resource from being deleted
+var DefaultProtectionTags = []string{
+	"DoNotDelete",
+}
+
+// Evaluator determines whether a resource is a candidate for deletion
+type Evaluator struct {
+	prefix         string
+	protectionTags []string
+
+	// selectedResourceGroups and selectedCleaners are the (lower-cased) names chosen when running
+	// interactively, when nil everything is selected
+	selectedResourceGroups map[string]struct{}
+	selectedCleaners       map[string]struct{}
+
+	// nameAgeExtractor, when set, infers when a Resource Group was created from its name
+	nameAgeExtractor *NameAgeExtractor
+}
+
+func NewEvaluator(opts options.Options) Evaluator {
+	return Evaluator{
+		prefix:         opts.Prefix,
+		protectionTags: DefaultProtectionTags,
+	}
+}
+
+// MatchesPrefix returns whether the specified Resource Group name matches the configured prefix
+func (e Evaluator) MatchesPrefix(resourceGroupName string) bool {
+	if e.prefix == "" {
+		return true
+	}
+
+	return strings.HasPrefix(strings.ToLower(resourceGroupName), strings.ToLower(e.prefix))
+}
+
+// WithSelection returns a copy of this Evaluator which only matches the specified Resource Groups and Cleaners
+func (e Evaluator) WithSelection(resourceGroupNames []string, cleanerNames []string) Evaluator {
+	e.selectedResourceGroups = toSet(resourceGroupNames)
+	e.selectedCleaners = toSet(cleanerNames)
+	return e
+}
+
+// ResourceGroupSelected returns whether the specified Resource Group has been selected
+func (e Evaluator) ResourceGroupSelected(resourceGroupName string) bool {
+	if e.selectedResourceGroups == nil {
+		return true
+	}
+
+	_, ok := e.selectedResourceGroups[strings.ToLower(resourceGroupName)]
+	return ok
+}
+
+// CleanerSelected returns whether the Cleaner with the specified name has been selected
+func (e Evaluator) CleanerSelected(name string) bool {
+	if e.selectedCleaners == nil {
+		return true
+	}
+
+	_, ok := e.selectedCleaners[strings.ToLower(name)]
+	return ok
+}
+
+// WithNameAgeExtractor returns a copy of this Evaluator which infers when a Resource Group was created from its name
+func (e Evaluator) WithNameAgeExtractor(extractor NameAgeExtractor) Evaluator {
+	e.nameAgeExtractor = &extractor
+	return e
+}
+
+// CreatedAtFromName returns when the Resource Group with the specified name was created, inferred from its name,
+// or nil when this can't be inferred
+func (e Evaluator) CreatedAtFromName(resourceGroupName string) *time.Time {
+	if e.nameAgeExtractor == nil {
+		return nil
+	}
+
+	return e.nameAgeExtractor.CreatedAt(resourceGroupName)
+}
+
+// ProtectionTags returns the Tag keys which prevent a resource from being deleted
+func (e Evaluator) ProtectionTags() []string {
+	return e.protectionTags
+}
+
+// ProtectedBy returns the Tag key which protects a resource with the specified tags from deletion, if any
+func (e Evaluator) ProtectedBy(tags *map[string]string) *string {
+	if tags == nil {
+		return nil
+	}
+
+	for k := range *tags {
+		for _, protectionTag := range e.protectionTags {
+			if strings.EqualFold(k, protectionTag) {
+				key := k
+				return &key
+			}
+		}
+	}
+
+	return nil
+}
+
+// ShouldDeleteResourceGroup returns whether the Resource Group with the specified name and tags should be deleted
+func (e Evaluator) ShouldDeleteResourceGroup(name string, tags *map[string]string) bool {
+	if !e.MatchesPrefix(name) || !e.ResourceGroupSelected(name) {
+		return false
+	}
+
+	return e.ProtectedBy(tags) == nil
+}
+
+func toSet(input []string) map[string]struct{} {
+	out := make(map[string]struct{})
+	for _, v := range input {
+		out[strings.ToLower(v)] = struct{}{}
+	}
+	return out
+}
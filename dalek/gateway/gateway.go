@@ -0,0 +1,238 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/filters"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+type Operation string
+
+const (
+	OperationBreakPairing Operation = "break pairing"
+	OperationCommit       Operation = "commit"
+	OperationDelete       Operation = "delete"
+	OperationPurge        Operation = "purge"
+	OperationUndelete     Operation = "undelete"
+	OperationUpdate       Operation = "update"
+)
+
+// ErrBlocked is returned (wrapped with the reason) from Gateway.Do when the mutation wasn't performed since it was
+// blocked by the filters or declined during confirmation - so that a cleaner can leave the resources within a
+// blocked parent alone. Dry-runs aren't blocked, so that the resources within a parent are still included in the plan.
+var ErrBlocked = errors.New("blocked by the deletion gateway")
+
+// Request describes a single mutating operation against Azure
+type Request struct {
+	// Operation is the kind of mutation being performed
+	Operation Operation
+
+	// Target is the Resource ID of the item being mutated, or a description of the item when
+	// it isn't an Azure Resource Manager resource (e.g. a Microsoft Graph object)
+	Target string
+
+	// Tags are the tags assigned to the Target, when known, which are checked against the protection filters
+	Tags *map[string]string
+
+	// IgnorePrefix skips checking the Resource Group matches the prefix, for cleaners which decide what to delete
+	// by other means (e.g. an expiry tag) - dry-run, the selection and the protection tags still apply
+	IgnorePrefix bool
+}
+
+// Confirmer confirms each mutation prior to it being performed, e.g. by prompting the user. Confirm should return
+// once `ctx` is cancelled, rather than continuing to wait for an answer.
+type Confirmer interface {
+	Confirm(ctx context.Context, req Request) (bool, error)
+}
+
+type budgetPauserKey struct{}
+
+// WithBudgetPauser returns a context in which Do calls `pause` whilst waiting for a mutation to be confirmed, so
+// that the time spent waiting on the user doesn't count against a time budget. `pause` returns a func which resumes
+// the budget - any budgets this is nested within are paused too.
+func WithBudgetPauser(ctx context.Context, pause func() (resume func())) context.Context {
+	parent, _ := ctx.Value(budgetPauserKey{}).(func() func())
+	return context.WithValue(ctx, budgetPauserKey{}, func() func() {
+		resume := pause()
+		if parent == nil {
+			return resume
+		}
+		resumeParent := parent()
+		return func() {
+			resume()
+			resumeParent()
+		}
+	})
+}
+
+func pauseBudgets(ctx context.Context) (resume func()) {
+	if pause, ok := ctx.Value(budgetPauserKey{}).(func() func()); ok {
+		return pause()
+	}
+	return func() {}
+}
+
+// Gateway is the only way a cleaner can mutate Azure - it enforces dry-run and the protection filters
+// and records each action in the Report.
+type Gateway struct {
+	actuallyDelete bool
+	confirmer      Confirmer
+	events         *events.Dispatcher
+	filters        filters.Evaluator
+	logger         *log.Logger
+	report         *report.Report
+}
+
+func New(opts options.Options, report *report.Report, logger *log.Logger, dispatcher *events.Dispatcher) *Gateway {
+	return &Gateway{
+		actuallyDelete: opts.ActuallyDelete,
+		events:         dispatcher,
+		filters:        filters.NewEvaluator(opts),
+		logger:         logger,
+		report:         report,
+	}
+}
+
+// Events returns the Dispatcher used to notify Observers of each Event
+func (g *Gateway) Events() *events.Dispatcher {
+	return g.events
+}
+
+// Filters returns the Evaluator used by this Gateway
+func (g *Gateway) Filters() filters.Evaluator {
+	return g.filters
+}
+
+// RequireConfirmation requires that each mutation is confirmed using `confirmer` before it's performed
+func (g *Gateway) RequireConfirmation(confirmer Confirmer) {
+	g.confirmer = confirmer
+}
+
+// Select limits the Resource Groups and Cleaners which the Gateway's filters match to those specified
+func (g *Gateway) Select(resourceGroupNames []string, cleanerNames []string) {
+	g.filters = g.filters.WithSelection(resourceGroupNames, cleanerNames)
+}
+
+// InferAgeFromNames uses `extractor` to infer when each Resource Group was created from its name
+func (g *Gateway) InferAgeFromNames(extractor filters.NameAgeExtractor) {
+	g.filters = g.filters.WithNameAgeExtractor(extractor)
+}
+
+// Do performs the mutation `fn` described by `req`, provided that the Dalek is actually deleting things and
+// the Target passes the protection filters. Requests blocked by the filters (or declined during confirmation)
+// return an error wrapping ErrBlocked, whereas dry-runs return nil.
+func (g *Gateway) Do(ctx context.Context, req Request, fn func(ctx context.Context) error) error {
+	action := report.Action{
+		Operation: string(req.Operation),
+		Target:    req.Target,
+	}
+
+	if reason := g.blockedBy(req); reason != nil {
+		g.Skip(ctx, req, *reason)
+		return fmt.Errorf("%w: %s", ErrBlocked, *reason)
+	}
+
+	if !g.actuallyDelete {
+		g.logger.Printf("[DEBUG] Would have run %s against %s..", req.Operation, req.Target)
+		action.Outcome = report.OutcomeDryRun
+		g.report.RecordAction(action)
+		g.notify(ctx, events.TypeResourceSkipped, req, func(e *events.Event) {
+			e.Reason = "dry-run"
+		})
+		return nil
+	}
+
+	if g.confirmer != nil {
+		resume := pauseBudgets(ctx)
+		confirmed, err := g.confirmer.Confirm(ctx, req)
+		resume()
+		if err != nil {
+			return fmt.Errorf("confirming %s against %s: %+v", req.Operation, req.Target, err)
+		}
+		if !confirmed {
+			reason := "declined during confirmation"
+			g.Skip(ctx, req, reason)
+			return fmt.Errorf("%w: %s", ErrBlocked, reason)
+		}
+	}
+
+	g.logger.Printf("[DEBUG] Running %s against %s..", req.Operation, req.Target)
+	g.notify(ctx, events.TypeDeleteIssued, req, nil)
+	if err := fn(withAuthorization(ctx)); err != nil {
+		action.Outcome = report.OutcomeFailed
+		action.Error = err.Error()
+		g.report.RecordAction(action)
+		g.notify(ctx, events.TypeDeleteFailed, req, func(e *events.Event) {
+			e.Error = err
+		})
+		return fmt.Errorf("running %s against %s: %+v", req.Operation, req.Target, err)
+	}
+	g.logger.Printf("[DEBUG] Completed %s against %s.", req.Operation, req.Target)
+
+	action.Outcome = report.OutcomeSucceeded
+	g.report.RecordAction(action)
+	g.notify(ctx, events.TypeDeleteSucceeded, req, nil)
+	return nil
+}
+
+// Skip records that the mutation described by `req` wasn't performed for the specified reason
+func (g *Gateway) Skip(ctx context.Context, req Request, reason string) {
+	g.logger.Printf("[DEBUG] Not going to %s %s: %s", req.Operation, req.Target, reason)
+	g.report.RecordAction(report.Action{
+		Operation: string(req.Operation),
+		Target:    req.Target,
+		Outcome:   report.OutcomeSkipped,
+		Reason:    reason,
+	})
+	g.notify(ctx, events.TypeResourceSkipped, req, func(e *events.Event) {
+		e.Reason = reason
+	})
+}
+
+// Blocked returns the reason the mutation described by `req` would be blocked by the filters, or nil if it'd be
+// performed - this allows a cleaner to check a parent resource before tearing down the resources within it, where
+// the parent itself is only mutated once they've gone (and so Do can't be used to check it)
+func (g *Gateway) Blocked(req Request) *string {
+	return g.blockedBy(req)
+}
+
+func (g *Gateway) notify(ctx context.Context, eventType events.Type, req Request, configure func(e *events.Event)) {
+	event := events.Event{
+		Type:      eventType,
+		Operation: string(req.Operation),
+		Target:    req.Target,
+	}
+	if configure != nil {
+		configure(&event)
+	}
+	g.events.Notify(ctx, event)
+}
+
+var resourceGroupSegment = regexp.MustCompile(`(?i)/resourceGroups/([^/]+)`)
+
+func (g *Gateway) blockedBy(req Request) *string {
+	if match := resourceGroupSegment.FindStringSubmatch(req.Target); len(match) == 2 {
+		if !req.IgnorePrefix && !g.filters.MatchesPrefix(match[1]) {
+			reason := fmt.Sprintf("Resource Group %q doesn't match the prefix", match[1])
+			return &reason
+		}
+		if !g.filters.ResourceGroupSelected(match[1]) {
+			reason := fmt.Sprintf("Resource Group %q wasn't selected", match[1])
+			return &reason
+		}
+	}
+
+	if tag := g.filters.ProtectedBy(req.Tags); tag != nil {
+		reason := fmt.Sprintf("protected by the tag %q", *tag)
+		return &reason
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type authorizationKey struct{}
+
+func withAuthorization(ctx context.Context) context.Context {
+	return context.WithValue(ctx, authorizationKey{}, true)
+}
+
+func isAuthorized(ctx context.Context) bool {
+	v, ok := ctx.Value(authorizationKey{}).(bool)
+	return ok && v
+}
+
+// readOnlyPostPaths are the paths which use a POST but don't mutate anything
+var readOnlyPostPaths = []string{
+	"/providers/Microsoft.ResourceGraph/resources",
+}
+
+// Guard is a Request Middleware which rejects any mutating HTTP request which wasn't issued via Gateway.Do,
+// meaning that a cleaner can't bypass the dry-run/protection filters by calling the SDK directly.
+func Guard(req *http.Request) (*http.Request, error) {
+	if !isMutating(req) || isAuthorized(req.Context()) {
+		return req, nil
+	}
+
+	return nil, fmt.Errorf("refusing to send %s %s since it wasn't issued through the deletion gateway", req.Method, req.URL.Path)
+}
+
+func isMutating(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+
+	case http.MethodPost:
+		for _, path := range readOnlyPostPaths {
+			if strings.EqualFold(strings.TrimSuffix(req.URL.Path, "/"), path) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-azure-helpers/lang/pointer"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resourcegraph/2022-10-01/resources"
+)
+
+// pageSize is the maximum number of rows Resource Graph returns in a single page
+const pageSize = 1000
+
+type Client struct {
+	client *resources.ResourcesClient
+}
+
+func NewClient(client *resources.ResourcesClient) *Client {
+	return &Client{
+		client: client,
+	}
+}
+
+// Scope defines the Subscriptions and/or Management Groups that a Query is run against
+type Scope struct {
+	ManagementGroups []string
+	Subscriptions    []string
+}
+
+// SubscriptionScope returns a Scope for the specified Subscription IDs
+func SubscriptionScope(subscriptionIds ...string) Scope {
+	return Scope{
+		Subscriptions: subscriptionIds,
+	}
+}
+
+type Query struct {
+	// Query is the KQL Query to run - any user provided values should be quoted using String/Strings
+	Query string
+
+	// Scope is the set of Subscriptions/Management Groups to run this Query against
+	Scope Scope
+}
+
+// Run performs the specified Query, following the `$skipToken` until all of the rows have been
+// retrieved, decoding each row into T.
+func Run[T any](ctx context.Context, client *Client, query Query) ([]T, error) {
+	kql := strings.TrimSpace(query.Query)
+	payload := resources.QueryRequest{
+		Options: &resources.QueryRequestOptions{
+			ResultFormat: pointer.To(resources.ResultFormatObjectArray),
+			Top:          pointer.To(int64(pageSize)),
+		},
+		Query: kql,
+	}
+	if len(query.Scope.ManagementGroups) > 0 {
+		payload.ManagementGroups = pointer.To(query.Scope.ManagementGroups)
+	}
+	if len(query.Scope.Subscriptions) > 0 {
+		payload.Subscriptions = pointer.To(query.Scope.Subscriptions)
+	}
+
+	rows := make([]T, 0)
+	for {
+		resp, err := client.client.Resources(ctx, payload)
+		if err != nil {
+			return nil, fmt.Errorf("performing graph query %q: %+v", kql, err)
+		}
+		if resp.Model == nil {
+			return nil, fmt.Errorf("performing graph query %q: response was nil", kql)
+		}
+		if resp.Model.Data == nil {
+			return nil, fmt.Errorf("performing graph query %q: response.data was nil", kql)
+		}
+
+		page, err := decodeRows[T](resp.Model.Data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding the results of graph query %q: %+v", kql, err)
+		}
+		rows = append(rows, page...)
+
+		if resp.Model.SkipToken == nil || *resp.Model.SkipToken == "" {
+			break
+		}
+		payload.Options.SkipToken = resp.Model.SkipToken
+	}
+
+	return rows, nil
+}
+
+func decodeRows[T any](data interface{}) ([]T, error) {
+	itemsRaw, ok := data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected the data to be an []interface but got %+v", data)
+	}
+
+	rows := make([]T, 0, len(itemsRaw))
+	for index, itemRaw := range itemsRaw {
+		encoded, err := json.Marshal(itemRaw)
+		if err != nil {
+			return nil, fmt.Errorf("encoding row %d: %+v", index, err)
+		}
+		var row T
+		if err := json.Unmarshal(encoded, &row); err != nil {
+			return nil, fmt.Errorf("decoding row %d: %+v", index, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,260 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// queryRequest is the part of the body of a Resource Graph request which these tests check
+type queryRequest struct {
+	ManagementGroups []string `json:"managementGroups"`
+	Subscriptions    []string `json:"subscriptions"`
+	Query            string   `json:"query"`
+	Options          struct {
+		SkipToken *string `json:"$skipToken"`
+	} `json:"options"`
+}
+
+// replayQueries returns a Client which responds to each Resource Graph request with the next of `pages` (each
+// being the rows and the `$skipToken`, if any) - along with the requests which were sent
+func replayQueries(t *testing.T, pages ...queryPage) (*Client, *[]queryRequest) {
+	requests := make([]queryRequest, 0)
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var body queryRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, fmt.Errorf("decoding the request: %+v", err)
+		}
+		requests = append(requests, body)
+		if len(requests) > len(pages) {
+			return nil, fmt.Errorf("unexpected request %d", len(requests))
+		}
+
+		page := pages[len(requests)-1]
+		if page.rows == nil {
+			page.rows = make([]map[string]interface{}, 0)
+		}
+		response := map[string]interface{}{
+			"count":           len(page.rows),
+			"data":            page.rows,
+			"resultTruncated": "false",
+		}
+		if page.skipToken != "" {
+			response["$skipToken"] = page.skipToken
+		}
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			return nil, fmt.Errorf("encoding the response: %+v", err)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type": []string{"application/json; charset=utf-8"},
+			},
+			Body:    io.NopCloser(bytes.NewReader(encoded)),
+			Request: req,
+		}, nil
+	})
+
+	client := testclient.New(t, transport)
+	return NewClient(client.ResourceManager.ResourceGraphClient), &requests
+}
+
+type queryPage struct {
+	rows      []map[string]interface{}
+	skipToken string
+}
+
+type row struct {
+	Name string `json:"name"`
+}
+
+func TestRunFollowsSkipToken(t *testing.T) {
+	rows := func(names ...string) []map[string]interface{} {
+		out := make([]map[string]interface{}, 0)
+		for _, name := range names {
+			out = append(out, map[string]interface{}{"name": name})
+		}
+		return out
+	}
+
+	testData := []struct {
+		name               string
+		pages              []queryPage
+		expected           []string
+		expectedSkipTokens []*string
+	}{
+		{
+			name: "no rows",
+			pages: []queryPage{
+				{rows: rows()},
+			},
+			expected:           []string{},
+			expectedSkipTokens: []*string{nil},
+		},
+		{
+			name: "single page",
+			pages: []queryPage{
+				{rows: rows("first", "second")},
+			},
+			expected:           []string{"first", "second"},
+			expectedSkipTokens: []*string{nil},
+		},
+		{
+			name: "several pages",
+			pages: []queryPage{
+				{rows: rows("first", "second"), skipToken: "page-2"},
+				{rows: rows("third"), skipToken: "page-3"},
+				{rows: rows("fourth")},
+			},
+			expected:           []string{"first", "second", "third", "fourth"},
+			expectedSkipTokens: []*string{nil, stringPointer("page-2"), stringPointer("page-3")},
+		},
+		{
+			name: "empty last page",
+			pages: []queryPage{
+				{rows: rows("first"), skipToken: "page-2"},
+				{rows: rows()},
+			},
+			expected:           []string{"first"},
+			expectedSkipTokens: []*string{nil, stringPointer("page-2")},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			client, requests := replayQueries(t, v.pages...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			query := Query{
+				Query: `
+resources
+| project name
+`,
+				Scope: SubscriptionScope(testclient.SubscriptionID),
+			}
+			result, err := Run[row](ctx, client, query)
+			if err != nil {
+				t.Fatalf("running the query: %+v", err)
+			}
+
+			actual := make([]string, 0)
+			for _, item := range result {
+				actual = append(actual, item.Name)
+			}
+			if !reflect.DeepEqual(actual, v.expected) {
+				t.Fatalf("expected the rows %q but got %q", v.expected, actual)
+			}
+
+			if len(*requests) != len(v.expectedSkipTokens) {
+				t.Fatalf("expected %d requests but got %d", len(v.expectedSkipTokens), len(*requests))
+			}
+			for i, request := range *requests {
+				if !reflect.DeepEqual(request.Options.SkipToken, v.expectedSkipTokens[i]) {
+					t.Errorf("expected request %d to use the skip token %v but got %v", i, stringValue(v.expectedSkipTokens[i]), stringValue(request.Options.SkipToken))
+				}
+				// the query and scope are the same for each page
+				if request.Query != "resources\n| project name" {
+					t.Errorf("expected request %d to use the trimmed query but got %q", i, request.Query)
+				}
+				if !reflect.DeepEqual(request.Subscriptions, []string{testclient.SubscriptionID}) {
+					t.Errorf("expected request %d to be scoped to the Subscription but got %q", i, request.Subscriptions)
+				}
+			}
+		})
+	}
+}
+
+func TestRunScope(t *testing.T) {
+	testData := []struct {
+		name                     string
+		scope                    Scope
+		expectedManagementGroups []string
+		expectedSubscriptions    []string
+	}{
+		{
+			name:                  "subscription",
+			scope:                 SubscriptionScope(testclient.SubscriptionID),
+			expectedSubscriptions: []string{testclient.SubscriptionID},
+		},
+		{
+			name:                  "subscriptions",
+			scope:                 SubscriptionScope(testclient.SubscriptionID, "11111111-1111-1111-1111-111111111111"),
+			expectedSubscriptions: []string{testclient.SubscriptionID, "11111111-1111-1111-1111-111111111111"},
+		},
+		{
+			name: "management group",
+			scope: Scope{
+				ManagementGroups: []string{"acctestmg"},
+			},
+			expectedManagementGroups: []string{"acctestmg"},
+		},
+		{
+			name: "management group and subscription",
+			scope: Scope{
+				ManagementGroups: []string{"acctestmg"},
+				Subscriptions:    []string{testclient.SubscriptionID},
+			},
+			expectedManagementGroups: []string{"acctestmg"},
+			expectedSubscriptions:    []string{testclient.SubscriptionID},
+		},
+		{
+			// an empty scope is omitted, so the query runs against everything the caller can access
+			name:  "empty",
+			scope: Scope{},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			client, requests := replayQueries(t, queryPage{})
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			query := Query{
+				Query: "resources | project name",
+				Scope: v.scope,
+			}
+			if _, err := Run[row](ctx, client, query); err != nil {
+				t.Fatalf("running the query: %+v", err)
+			}
+
+			if len(*requests) != 1 {
+				t.Fatalf("expected 1 request but got %d", len(*requests))
+			}
+			request := (*requests)[0]
+			if !reflect.DeepEqual(request.ManagementGroups, v.expectedManagementGroups) {
+				t.Errorf("expected the Management Groups %q but got %q", v.expectedManagementGroups, request.ManagementGroups)
+			}
+			if !reflect.DeepEqual(request.Subscriptions, v.expectedSubscriptions) {
+				t.Errorf("expected the Subscriptions %q but got %q", v.expectedSubscriptions, request.Subscriptions)
+			}
+		})
+	}
+}
+
+func stringPointer(input string) *string {
+	return &input
+}
+
+func stringValue(input *string) string {
+	if input == nil {
+		return "<nil>"
+	}
+	return *input
+}
@@ -0,0 +1,122 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Inventory is a lazily-loaded snapshot of the resources within a Scope, which is retrieved (by default using
+// a single paged Query) the first time it's needed and then cached (indexed by Resource Group) for the remainder of
+// the run - so looking up the resources within a Resource Group doesn't require a Query per Resource Group.
+//
+// Since this is a snapshot, anything needing fresh data (e.g. to confirm a resource still exists) should call
+// the API for that resource directly.
+type Inventory struct {
+	loader Loader
+
+	lock            sync.Mutex
+	resources       []Resource
+	byResourceGroup map[string][]Resource
+}
+
+// Loader retrieves each of the resources within the Scope of an Inventory
+type Loader func(ctx context.Context) ([]Resource, error)
+
+// NewInventory returns an Inventory of the resources within the Scope, retrieved using Resource Graph
+func NewInventory(client *Client, scope Scope) *Inventory {
+	return NewInventoryUsingLoader(func(ctx context.Context) ([]Resource, error) {
+		query := Query{
+			// the `resources` table doesn't include when each resource was created, so this comes from the change history
+			Query: `
+resources
+| project id, name, type, resourceGroup, location, tags, targetResourceId = tolower(id)
+| join kind=leftouter (
+    resourcechanges
+    | where tostring(properties.changeType) =~ 'Create'
+    | summarize createdAt = max(todatetime(properties.changeAttributes.timestamp)) by targetResourceId = tolower(tostring(properties.targetResourceId))
+) on targetResourceId
+| project id, name, type, resourceGroup, location, tags, createdAt
+`,
+			Scope: scope,
+		}
+		return Run[Resource](ctx, client, query)
+	})
+}
+
+// NewInventoryUsingLoader returns an Inventory of the resources retrieved using `loader` - which allows the
+// resources to be retrieved from somewhere other than Resource Graph (e.g. on Azure Stack Hub, where Resource
+// Graph isn't available)
+func NewInventoryUsingLoader(loader Loader) *Inventory {
+	return &Inventory{
+		loader: loader,
+	}
+}
+
+// Load retrieves the snapshot of the resources within the Scope if it hasn't been retrieved already, which
+// allows the snapshot to be taken at the start of a run rather than when it's first needed
+func (i *Inventory) Load(ctx context.Context) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.resources != nil {
+		return nil
+	}
+
+	resources, err := i.loader(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Resource Graph returns the Resource Group name in lower-case, but this isn't guaranteed
+	byResourceGroup := make(map[string][]Resource)
+	for _, resource := range resources {
+		key := strings.ToLower(resource.ResourceGroup)
+		byResourceGroup[key] = append(byResourceGroup[key], resource)
+	}
+
+	i.resources = resources
+	i.byResourceGroup = byResourceGroup
+	return nil
+}
+
+// Resources returns each of the resources within the Scope of this Inventory
+func (i *Inventory) Resources(ctx context.Context) ([]Resource, error) {
+	if err := i.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.resources, nil
+}
+
+// InResourceGroup returns the resources within the specified Resource Group, optionally limited to the specified
+// Resource Types - both of which are compared case-insensitively.
+func (i *Inventory) InResourceGroup(ctx context.Context, resourceGroupName string, resourceTypes ...string) ([]Resource, error) {
+	if err := i.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	out := make([]Resource, 0)
+	for _, resource := range i.byResourceGroup[strings.ToLower(resourceGroupName)] {
+		if len(resourceTypes) > 0 && !containsInsensitively(resourceTypes, resource.Type) {
+			continue
+		}
+		out = append(out, resource)
+	}
+	return out, nil
+}
+
+func containsInsensitively(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+)
+
+func TestInventoryUsesASingleQuery(t *testing.T) {
+	page := func(skipToken string, resources ...Resource) json.RawMessage {
+		body := map[string]interface{}{
+			"count":           len(resources),
+			"data":            resources,
+			"resultTruncated": "false",
+			"totalRecords":    3,
+		}
+		if skipToken != "" {
+			body["$skipToken"] = skipToken
+		}
+		out, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding page: %+v", err)
+		}
+		return out
+	}
+	queryUrl := "https://management.azure.com/providers/Microsoft.ResourceGraph/resources?api-version=2022-10-01"
+	cassette := transports.Cassette{
+		Interactions: []transports.Interaction{
+			{
+				Request: transports.CassetteRequest{Method: "POST", URL: queryUrl},
+				Response: transports.CassetteResponse{
+					StatusCode: 200,
+					Body: page("page-2",
+						Resource{ID: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestrg-1/providers/Microsoft.ServiceBus/namespaces/first", Type: "Microsoft.ServiceBus/namespaces", ResourceGroup: "acctestrg-1"},
+						Resource{ID: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestrg-1/providers/Microsoft.Authorization/locks/second", Type: "microsoft.authorization/locks", ResourceGroup: "acctestrg-1"},
+					),
+				},
+			},
+			{
+				Request: transports.CassetteRequest{Method: "POST", URL: queryUrl},
+				Response: transports.CassetteResponse{
+					StatusCode: 200,
+					Body: page("",
+						Resource{ID: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestrg-2/providers/Microsoft.ServiceBus/namespaces/third", Type: "Microsoft.ServiceBus/namespaces", ResourceGroup: "acctestrg-2"},
+					),
+				},
+			},
+		},
+	}
+	replayer := transports.NewReplayer(cassette)
+	client := testclient.New(t, replayer)
+	inventory := NewInventory(NewClient(client.ResourceManager.ResourceGraphClient), SubscriptionScope(testclient.SubscriptionID))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	testData := []struct {
+		resourceGroup string
+		resourceTypes []string
+		expected      int
+	}{
+		{resourceGroup: "acctestRG-1", expected: 2},
+		{resourceGroup: "acctestRG-1", resourceTypes: []string{"Microsoft.Authorization/locks"}, expected: 1},
+		{resourceGroup: "acctestRG-2", expected: 1},
+		{resourceGroup: "acctestRG-2", resourceTypes: []string{"Microsoft.Authorization/locks"}, expected: 0},
+		{resourceGroup: "acctestRG-3", expected: 0},
+	}
+	for _, v := range testData {
+		resources, err := inventory.InResourceGroup(ctx, v.resourceGroup, v.resourceTypes...)
+		if err != nil {
+			t.Fatalf("retrieving the resources within %q: %+v", v.resourceGroup, err)
+		}
+		if len(resources) != v.expected {
+			t.Errorf("expected %d resources within %q (types %q) but got %d", v.expected, v.resourceGroup, v.resourceTypes, len(resources))
+		}
+	}
+
+	// both pages were retrieved once, and no further queries were made
+	for _, req := range replayer.Unmatched() {
+		t.Errorf("expected a single query but got %s %s", req.Method, req.URL)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Errorf("expected both pages to be retrieved but %d weren't", len(unused))
+	}
+}
@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"strings"
+)
+
+var stringLiteralReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// String returns the specified value as a quoted KQL string literal, which can be safely
+// interpolated into a Query.
+func String(input string) string {
+	return "'" + stringLiteralReplacer.Replace(input) + "'"
+}
+
+// Strings returns the specified values as a comma-separated list of quoted KQL string literals,
+// intended to be used with the `in` and `in~` operators. Since an empty list isn't valid KQL, when
+// there are no values this returns an empty dynamic array instead - which matches nothing.
+func Strings(input []string) string {
+	if len(input) == 0 {
+		return "dynamic([])"
+	}
+
+	items := make([]string, 0, len(input))
+	for _, v := range input {
+		items = append(items, String(v))
+	}
+	return strings.Join(items, ", ")
+}
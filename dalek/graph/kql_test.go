@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "",
+			expected: `''`,
+		},
+		{
+			input:    "acctestRG-1",
+			expected: `'acctestRG-1'`,
+		},
+		{
+			input:    "it's",
+			expected: `'it\'s'`,
+		},
+		{
+			input:    `double "quotes"`,
+			expected: `'double "quotes"'`,
+		},
+		{
+			input:    `back\slash`,
+			expected: `'back\\slash'`,
+		},
+		{
+			// the backslash is escaped first, so the escaped quote can't be turned back into a closing quote
+			input:    `\'`,
+			expected: `'\\\''`,
+		},
+		{
+			input:    "' or 1 == 1 //",
+			expected: `'\' or 1 == 1 //'`,
+		},
+		{
+			input:    "new\nline\ttab\rreturn",
+			expected: `'new\nline\ttab\rreturn'`,
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.input, func(t *testing.T) {
+			if actual := String(v.input); actual != v.expected {
+				t.Fatalf("expected %s but got %s", v.expected, actual)
+			}
+		})
+	}
+}
+
+func TestStrings(t *testing.T) {
+	testData := []struct {
+		name     string
+		input    []string
+		expected string
+	}{
+		{
+			name:     "nil",
+			input:    nil,
+			expected: "dynamic([])",
+		},
+		{
+			name:     "empty",
+			input:    []string{},
+			expected: "dynamic([])",
+		},
+		{
+			name:     "single",
+			input:    []string{"acctestRG-1"},
+			expected: `'acctestRG-1'`,
+		},
+		{
+			name:     "multiple",
+			input:    []string{"acctestRG-1", "it's", `back\slash`},
+			expected: `'acctestRG-1', 'it\'s', 'back\\slash'`,
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			if actual := Strings(v.input); actual != v.expected {
+				t.Fatalf("expected %s but got %s", v.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package graph
+
+import "time"
+
+// Resource is a row returned from the `resources` table, projected to the fields we use
+type Resource struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Type          string            `json:"type"`
+	ResourceGroup string            `json:"resourceGroup"`
+	Location      string            `json:"location"`
+	Tags          map[string]string `json:"tags"`
+
+	// CreatedAt is when the resource was created, when known - Resource Graph only retains the change history
+	// for 14 days, so this is nil for resources created before then
+	CreatedAt *time.Time `json:"createdAt"`
+}
@@ -0,0 +1,52 @@
+package dalek
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/history"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+type historyConfig struct {
+	store    *history.Store
+	recorder *history.Recorder
+}
+
+// recordHistory appends an Entry describing the run to the history, when a Store has been configured
+func (d *Dalek) recordHistory(startedAt time.Time, result *Result) {
+	if d.history == nil {
+		return
+	}
+
+	entry := history.Entry{
+		RunID:       d.opts.RunID,
+		StartedAt:   startedAt,
+		CompletedAt: time.Now(),
+		Configuration: history.Configuration{
+			SubscriptionID: commonids.NewSubscriptionID(d.client.SubscriptionID).ID(),
+			Prefix:         d.opts.Prefix,
+			ActuallyDelete: d.opts.ActuallyDelete,
+			Quarantine:     d.opts.Quarantine.Enabled,
+		},
+		Counts:           make(map[report.Outcome]int),
+		Errors:           make([]string, 0),
+		Failures:         result.ActionsWithOutcome(report.OutcomeFailed),
+		DeletionFailures: result.DeletionFailures,
+		Cleaners:         d.history.recorder.Cleaners(),
+		ResourceGroups:   result.ResourceGroups,
+	}
+	if d.opts.Age.MinimumAge > 0 {
+		entry.Configuration.MinimumAge = d.opts.Age.MinimumAge.String()
+	}
+	for _, action := range result.Actions {
+		entry.Counts[action.Outcome]++
+	}
+	for _, err := range result.Errors {
+		entry.Errors = append(entry.Errors, err.Error())
+	}
+
+	if err := d.history.store.Append(entry); err != nil {
+		d.logger.Printf("[DEBUG] Recording the run in the history: %+v", err)
+	}
+}
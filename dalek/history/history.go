@@ -0,0 +1,135 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// Entry is the record of a single run of the Dalek within the history
+type Entry struct {
+	RunID       string    `json:"runId"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+
+	// Configuration is the configuration used for this run
+	Configuration Configuration `json:"configuration"`
+
+	// Counts is the number of Actions with each Outcome
+	Counts map[report.Outcome]int `json:"counts"`
+
+	// Errors is each of the errors encountered during the run
+	Errors []string `json:"errors,omitempty"`
+
+	// Failures is each of the Actions which failed
+	Failures []report.Action `json:"failures,omitempty"`
+
+	// DeletionFailures is each of the Resource Group deletions which failed asynchronously
+	DeletionFailures []report.DeletionFailure `json:"deletionFailures,omitempty"`
+
+	// Cleaners is how long each Cleaner took against each Target
+	Cleaners []CleanerDuration `json:"cleaners,omitempty"`
+
+	// ResourceGroups is the Resource Types found within each of the Resource Groups which matched the filters
+	ResourceGroups []report.ResourceGroupContents `json:"resourceGroups,omitempty"`
+}
+
+// Duration returns how long the run took
+func (e Entry) Duration() time.Duration {
+	return e.CompletedAt.Sub(e.StartedAt)
+}
+
+// Configuration is the subset of the Options used for a run which is recorded in the history
+type Configuration struct {
+	SubscriptionID string `json:"subscriptionId"`
+	Prefix         string `json:"prefix"`
+	ActuallyDelete bool   `json:"actuallyDelete"`
+	Quarantine     bool   `json:"quarantine,omitempty"`
+	MinimumAge     string `json:"minimumAge,omitempty"`
+}
+
+// CleanerDuration is how long a Cleaner took to run against a Target (a Subscription or Resource Group)
+type CleanerDuration struct {
+	Cleaner  string        `json:"cleaner"`
+	Target   string        `json:"target"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Store is a history of runs stored as a JSON-lines file, with one Entry per line - which can be appended to
+// by concurrent runs within the same process
+type Store struct {
+	path string
+	lock sync.Mutex
+}
+
+func NewStore(path string) *Store {
+	return &Store{
+		path: path,
+	}
+}
+
+// Append appends the specified Entry to the history, creating the file if it doesn't exist
+func (s *Store) Append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding the entry for %q: %+v", entry.RunID, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening %q: %+v", s.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing to %q: %+v", s.path, err)
+	}
+	return nil
+}
+
+// Load returns each of the Entries within the history in the order they were recorded, which is empty when
+// the file doesn't exist
+func (s *Store) Load() ([]Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	out := make([]Entry, 0)
+	file, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return out, nil
+		}
+		return nil, fmt.Errorf("opening %q: %+v", s.path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// an entry for a large run can easily exceed the default limit of 64KB
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("parsing line %d of %q: %+v", line, s.path, err)
+		}
+		out = append(out, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %q: %+v", s.path, err)
+	}
+	return out, nil
+}
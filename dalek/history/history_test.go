@@ -0,0 +1,178 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+const (
+	resourceGroupOne = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestRG-1"
+	resourceGroupTwo = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestRG-2"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "history.jsonl"))
+
+	entries, err := store.Load()
+	if err != nil {
+		t.Fatalf("loading a history which doesn't exist: %+v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no entries but got %d", len(entries))
+	}
+
+	startedAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	expected := []Entry{
+		{
+			RunID:       "first",
+			StartedAt:   startedAt,
+			CompletedAt: startedAt.Add(time.Hour),
+			Configuration: Configuration{
+				Prefix:         "acctest",
+				ActuallyDelete: true,
+			},
+			Counts: map[report.Outcome]int{
+				report.OutcomeSucceeded: 2,
+				report.OutcomeFailed:    1,
+			},
+			Cleaners: []CleanerDuration{
+				{
+					Cleaner:  "Delete Resource Groups",
+					Target:   "/subscriptions/00000000-0000-0000-0000-000000000000",
+					Duration: 10 * time.Minute,
+				},
+			},
+			ResourceGroups: []report.ResourceGroupContents{
+				{
+					ResourceGroup: resourceGroupOne,
+					ResourceTypes: map[string]int{
+						"Microsoft.Network/virtualNetworks": 2,
+					},
+					Time: startedAt,
+				},
+			},
+		},
+		{
+			RunID:       "second",
+			StartedAt:   startedAt.Add(24 * time.Hour),
+			CompletedAt: startedAt.Add(25 * time.Hour),
+			Counts:      map[report.Outcome]int{},
+		},
+	}
+	for _, entry := range expected {
+		if err := store.Append(entry); err != nil {
+			t.Fatalf("appending %q: %+v", entry.RunID, err)
+		}
+	}
+
+	actual, err := store.Load()
+	if err != nil {
+		t.Fatalf("loading the history: %+v", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, actual)
+	}
+	if duration := actual[0].Duration(); duration != time.Hour {
+		t.Fatalf("expected the first run to have taken 1h but got %s", duration)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := NewRecorder()
+	startedAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	ctx := context.TODO()
+
+	recorder.Notify(ctx, events.Event{Type: events.TypeCleanerStarted, Cleaner: "first", Target: resourceGroupOne, Time: startedAt})
+	recorder.Notify(ctx, events.Event{Type: events.TypeCleanerStarted, Cleaner: "first", Target: resourceGroupTwo, Time: startedAt})
+	recorder.Notify(ctx, events.Event{Type: events.TypeCleanerCompleted, Cleaner: "first", Target: resourceGroupTwo, Time: startedAt.Add(time.Minute)})
+	// completions without a matching start are ignored
+	recorder.Notify(ctx, events.Event{Type: events.TypeCleanerCompleted, Cleaner: "second", Target: resourceGroupOne, Time: startedAt.Add(time.Minute)})
+
+	expected := []CleanerDuration{
+		{
+			Cleaner:  "first",
+			Target:   resourceGroupTwo,
+			Duration: time.Minute,
+		},
+	}
+	if actual := recorder.Cleaners(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, actual)
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	dayOne := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	dayTwo := dayOne.Add(24 * time.Hour)
+	entries := []Entry{
+		{
+			// outside of the period being summarised
+			RunID:     "old",
+			StartedAt: dayOne.Add(-30 * 24 * time.Hour),
+			Cleaners: []CleanerDuration{
+				{Cleaner: "Delete Resource Groups", Duration: 10 * time.Hour},
+			},
+			DeletionFailures: []report.DeletionFailure{
+				{ResourceGroup: resourceGroupTwo, Code: "ScopeLocked"},
+			},
+		},
+		{
+			RunID:     "first",
+			StartedAt: dayOne,
+			Cleaners: []CleanerDuration{
+				{Cleaner: "Delete Resource Groups", Duration: 10 * time.Minute},
+				{Cleaner: "Remove Locks", Duration: time.Minute},
+			},
+			Failures: []report.Action{
+				{Target: resourceGroupOne + "/providers/Microsoft.Network/virtualNetworks/vnet1", Outcome: report.OutcomeFailed, Error: "first"},
+				{Target: resourceGroupOne, Outcome: report.OutcomeFailed, Error: "second"},
+			},
+			ResourceGroups: []report.ResourceGroupContents{
+				{ResourceGroup: resourceGroupOne, ResourceTypes: map[string]int{"Microsoft.Network/virtualNetworks": 2}, Time: dayOne},
+				{ResourceGroup: resourceGroupTwo, ResourceTypes: map[string]int{"Microsoft.Network/virtualNetworks": 1, "Microsoft.Storage/storageAccounts": 1}, Time: dayOne},
+			},
+		},
+		{
+			RunID:     "second",
+			StartedAt: dayTwo,
+			Cleaners: []CleanerDuration{
+				{Cleaner: "Delete Resource Groups", Duration: 20 * time.Minute},
+			},
+			DeletionFailures: []report.DeletionFailure{
+				{ResourceGroup: resourceGroupOne, Code: "ScopeLocked", Message: "the scope is locked"},
+				{ResourceGroup: resourceGroupTwo, Code: "Conflict"},
+			},
+			ResourceGroups: []report.ResourceGroupContents{
+				{ResourceGroup: resourceGroupOne, ResourceTypes: map[string]int{"Microsoft.Network/virtualNetworks": 2}, Time: dayTwo},
+				// the same Resource Group found twice on the same day is only counted once
+				{ResourceGroup: resourceGroupOne, ResourceTypes: map[string]int{}, Time: dayTwo.Add(time.Hour)},
+			},
+		},
+	}
+
+	actual := Summarise(entries, dayOne.Add(-time.Hour), 1)
+	expected := Trends{
+		Runs: 2,
+		LeakedPerDay: []DayCount{
+			{Day: "2026-10-01", ResourceGroups: 2},
+			{Day: "2026-10-02", ResourceGroups: 1},
+		},
+		SlowestCleaners: []CleanerStats{
+			{Cleaner: "Delete Resource Groups", Count: 2, Average: 15 * time.Minute, Max: 20 * time.Minute},
+		},
+		RepeatedFailures: []ResourceGroupFailures{
+			{ResourceGroup: "/subscriptions/00000000-0000-0000-0000-000000000000/resourcegroups/acctestrg-1", Runs: 2, LastError: "ScopeLocked: the scope is locked"},
+		},
+		LeakedTypes: []TypeCount{
+			{Type: "microsoft.network/virtualnetworks", ResourceGroups: 3, Resources: 5},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, actual)
+	}
+}
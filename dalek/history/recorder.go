@@ -0,0 +1,68 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+)
+
+var _ events.Observer = &Recorder{}
+
+// Recorder is an Observer which records how long each Cleaner took, using the CleanerStarted and
+// CleanerCompleted Events
+type Recorder struct {
+	lock     sync.Mutex
+	started  map[cleanerTarget]time.Time
+	cleaners []CleanerDuration
+}
+
+type cleanerTarget struct {
+	cleaner string
+	target  string
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		started:  make(map[cleanerTarget]time.Time),
+		cleaners: make([]CleanerDuration, 0),
+	}
+}
+
+func (r *Recorder) Notify(_ context.Context, event events.Event) {
+	key := cleanerTarget{
+		cleaner: event.Cleaner,
+		target:  event.Target,
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	switch event.Type {
+	case events.TypeCleanerStarted:
+		r.started[key] = event.Time
+
+	case events.TypeCleanerCompleted:
+		started, ok := r.started[key]
+		if !ok {
+			return
+		}
+		delete(r.started, key)
+		r.cleaners = append(r.cleaners, CleanerDuration{
+			Cleaner:  event.Cleaner,
+			Target:   event.Target,
+			Duration: event.Time.Sub(started),
+		})
+	}
+}
+
+// Cleaners returns how long each of the Cleaners which have completed took
+func (r *Recorder) Cleaners() []CleanerDuration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]CleanerDuration, len(r.cleaners))
+	copy(out, r.cleaners)
+	return out
+}
@@ -0,0 +1,242 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// resourceGroupIdPattern matches the Resource Group ID at the start of a Resource ID
+var resourceGroupIdPattern = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+`)
+
+// Trends summarises the history of runs
+type Trends struct {
+	// Runs is the number of runs which were summarised
+	Runs int
+
+	// LeakedPerDay is the number of distinct Resource Groups matching the filters found on each day
+	LeakedPerDay []DayCount
+
+	// SlowestCleaners are the Cleaners which took the longest on average
+	SlowestCleaners []CleanerStats
+
+	// RepeatedFailures are the Resource Groups which failed to be cleaned up in more than one run
+	RepeatedFailures []ResourceGroupFailures
+
+	// LeakedTypes are the Resource Types found in the most Resource Groups
+	LeakedTypes []TypeCount
+}
+
+// DayCount is the number of Resource Groups found on a given day (formatted as `2006-01-02`)
+type DayCount struct {
+	Day            string
+	ResourceGroups int
+}
+
+// CleanerStats are the durations of a Cleaner across each of the Targets it was run against
+type CleanerStats struct {
+	Cleaner string
+	Count   int
+	Average time.Duration
+	Max     time.Duration
+}
+
+// ResourceGroupFailures is the number of runs in which a Resource Group failed to be cleaned up
+type ResourceGroupFailures struct {
+	ResourceGroup string
+	Runs          int
+
+	// LastError is the most recent error for this Resource Group
+	LastError string
+}
+
+// TypeCount is the number of Resource Groups (and resources) of a Resource Type which were found
+type TypeCount struct {
+	Type           string
+	ResourceGroups int
+	Resources      int
+}
+
+// Summarise summarises the Entries which started on or after `since`, limiting each list to the `top` entries
+func Summarise(entries []Entry, since time.Time, top int) Trends {
+	leakedPerDay := make(map[string]map[string]struct{})
+	cleaners := make(map[string]*CleanerStats)
+	cleanerTotals := make(map[string]time.Duration)
+	failures := make(map[string]*ResourceGroupFailures)
+	types := make(map[string]*TypeCount)
+
+	out := Trends{}
+	for _, entry := range entries {
+		if entry.StartedAt.Before(since) {
+			continue
+		}
+		out.Runs++
+
+		for _, resourceGroup := range entry.ResourceGroups {
+			day := resourceGroup.Time.UTC().Format("2006-01-02")
+			if resourceGroup.Time.IsZero() {
+				day = entry.StartedAt.UTC().Format("2006-01-02")
+			}
+			if _, ok := leakedPerDay[day]; !ok {
+				leakedPerDay[day] = make(map[string]struct{})
+			}
+			leakedPerDay[day][strings.ToLower(resourceGroup.ResourceGroup)] = struct{}{}
+
+			for resourceType, count := range resourceGroup.ResourceTypes {
+				key := strings.ToLower(resourceType)
+				if _, ok := types[key]; !ok {
+					types[key] = &TypeCount{
+						Type: key,
+					}
+				}
+				types[key].ResourceGroups++
+				types[key].Resources += count
+			}
+		}
+
+		for _, cleaner := range entry.Cleaners {
+			if _, ok := cleaners[cleaner.Cleaner]; !ok {
+				cleaners[cleaner.Cleaner] = &CleanerStats{
+					Cleaner: cleaner.Cleaner,
+				}
+			}
+			stats := cleaners[cleaner.Cleaner]
+			stats.Count++
+			cleanerTotals[cleaner.Cleaner] += cleaner.Duration
+			if cleaner.Duration > stats.Max {
+				stats.Max = cleaner.Duration
+			}
+		}
+
+		// each Resource Group is only counted once per run, regardless of how many times it failed
+		for resourceGroup, lastError := range failedResourceGroups(entry) {
+			if _, ok := failures[resourceGroup]; !ok {
+				failures[resourceGroup] = &ResourceGroupFailures{
+					ResourceGroup: resourceGroup,
+				}
+			}
+			failures[resourceGroup].Runs++
+			failures[resourceGroup].LastError = lastError
+		}
+	}
+
+	for day, resourceGroups := range leakedPerDay {
+		out.LeakedPerDay = append(out.LeakedPerDay, DayCount{
+			Day:            day,
+			ResourceGroups: len(resourceGroups),
+		})
+	}
+	sort.Slice(out.LeakedPerDay, func(i, j int) bool {
+		return out.LeakedPerDay[i].Day < out.LeakedPerDay[j].Day
+	})
+
+	for name, stats := range cleaners {
+		stats.Average = cleanerTotals[name] / time.Duration(stats.Count)
+		out.SlowestCleaners = append(out.SlowestCleaners, *stats)
+	}
+	sort.Slice(out.SlowestCleaners, func(i, j int) bool {
+		if out.SlowestCleaners[i].Average != out.SlowestCleaners[j].Average {
+			return out.SlowestCleaners[i].Average > out.SlowestCleaners[j].Average
+		}
+		return out.SlowestCleaners[i].Cleaner < out.SlowestCleaners[j].Cleaner
+	})
+	out.SlowestCleaners = limit(out.SlowestCleaners, top)
+
+	for _, failure := range failures {
+		if failure.Runs > 1 {
+			out.RepeatedFailures = append(out.RepeatedFailures, *failure)
+		}
+	}
+	sort.Slice(out.RepeatedFailures, func(i, j int) bool {
+		if out.RepeatedFailures[i].Runs != out.RepeatedFailures[j].Runs {
+			return out.RepeatedFailures[i].Runs > out.RepeatedFailures[j].Runs
+		}
+		return out.RepeatedFailures[i].ResourceGroup < out.RepeatedFailures[j].ResourceGroup
+	})
+	out.RepeatedFailures = limit(out.RepeatedFailures, top)
+
+	for _, count := range types {
+		out.LeakedTypes = append(out.LeakedTypes, *count)
+	}
+	sort.Slice(out.LeakedTypes, func(i, j int) bool {
+		if out.LeakedTypes[i].ResourceGroups != out.LeakedTypes[j].ResourceGroups {
+			return out.LeakedTypes[i].ResourceGroups > out.LeakedTypes[j].ResourceGroups
+		}
+		return out.LeakedTypes[i].Type < out.LeakedTypes[j].Type
+	})
+	out.LeakedTypes = limit(out.LeakedTypes, top)
+
+	return out
+}
+
+// failedResourceGroups returns the (lower-cased) ID of each Resource Group which failed to be cleaned up during
+// the run, along with the last error for it
+func failedResourceGroups(entry Entry) map[string]string {
+	out := make(map[string]string)
+	for _, action := range entry.Failures {
+		if action.Outcome != report.OutcomeFailed {
+			continue
+		}
+		if id := resourceGroupIdPattern.FindString(action.Target); id != "" {
+			out[strings.ToLower(id)] = action.Error
+		}
+	}
+	for _, failure := range entry.DeletionFailures {
+		out[strings.ToLower(failure.ResourceGroup)] = fmt.Sprintf("%s: %s", failure.Code, failure.Message)
+	}
+	return out
+}
+
+func limit[T any](input []T, top int) []T {
+	if top > 0 && len(input) > top {
+		return input[:top]
+	}
+	return input
+}
+
+// Write outputs the Trends as a set of tables
+func (t Trends) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Runs: %d\n", t.Runs)
+
+	fmt.Fprintf(tw, "\nLeaked Resource Groups per Day:\n")
+	fmt.Fprintf(tw, "  DAY\tRESOURCE GROUPS\n")
+	for _, v := range t.LeakedPerDay {
+		fmt.Fprintf(tw, "  %s\t%d\n", v.Day, v.ResourceGroups)
+	}
+
+	fmt.Fprintf(tw, "\nSlowest Cleaners:\n")
+	fmt.Fprintf(tw, "  CLEANER\tRUNS\tAVERAGE\tMAX\n")
+	for _, v := range t.SlowestCleaners {
+		fmt.Fprintf(tw, "  %s\t%d\t%s\t%s\n", v.Cleaner, v.Count, v.Average.Round(time.Second), v.Max.Round(time.Second))
+	}
+
+	fmt.Fprintf(tw, "\nResource Groups which Repeatedly Fail:\n")
+	fmt.Fprintf(tw, "  RESOURCE GROUP\tRUNS\tLAST ERROR\n")
+	for _, v := range t.RepeatedFailures {
+		fmt.Fprintf(tw, "  %s\t%d\t%s\n", v.ResourceGroup, v.Runs, truncate(v.LastError, 120))
+	}
+
+	fmt.Fprintf(tw, "\nMost Leaked Resource Types:\n")
+	fmt.Fprintf(tw, "  RESOURCE TYPE\tRESOURCE GROUPS\tRESOURCES\n")
+	for _, v := range t.LeakedTypes {
+		fmt.Fprintf(tw, "  %s\t%d\t%d\n", v.Type, v.ResourceGroups, v.Resources)
+	}
+
+	return tw.Flush()
+}
+
+// truncate shortens (multi-line) errors so that they fit within a table
+func truncate(input string, length int) string {
+	out := strings.Join(strings.Fields(input), " ")
+	if len(out) > length {
+		return out[:length-3] + "..."
+	}
+	return out
+}
@@ -0,0 +1,311 @@
+package interactive
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+)
+
+var _ gateway.Confirmer = &Prompter{}
+
+// ResourceGroup is the summary of a Resource Group shown when selecting which to delete
+type ResourceGroup struct {
+	Name          string
+	Location      string
+	Age           *time.Duration
+	Tags          map[string]string
+	ResourceCount int
+}
+
+// Prompter asks the user which Resource Groups and Cleaners should be used, and to confirm each deletion
+type Prompter struct {
+	reader *bufio.Reader
+	writer io.Writer
+
+	// lines are read from `reader` by a single goroutine, so that a prompt can be abandoned when its
+	// context is cancelled without the line the user is typing being lost within a blocked read
+	lines        chan string
+	readErr      error
+	startReading sync.Once
+
+	// prompting is held whilst a prompt is open, so that only one prompt is shown at a time
+	prompting chan struct{}
+
+	// abandoned is whether a prompt was abandoned since its context was cancelled, in which case the answer
+	// the user was typing for it is discarded rather than being taken as the answer to the next prompt
+	abandoned  bool
+	confirmAll bool
+	declineAll bool
+}
+
+func New(in io.Reader, out io.Writer) *Prompter {
+	return &Prompter{
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		lines:     make(chan string),
+		prompting: make(chan struct{}, 1),
+	}
+}
+
+// SelectResourceGroups shows the specified Resource Groups and returns the names of those the user selected
+func (p *Prompter) SelectResourceGroups(groups []ResourceGroup) ([]string, error) {
+	rows := make([]string, 0, len(groups))
+	for _, group := range groups {
+		age := "unknown"
+		if group.Age != nil {
+			age = formatAge(*group.Age)
+		}
+		rows = append(rows, fmt.Sprintf("%-40s %-16s %-8s %4d resources  %s", group.Name, group.Location, age, group.ResourceCount, summariseTags(group.Tags)))
+	}
+
+	selected, err := p.selectItems(context.Background(), "Resource Groups", rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0)
+	for i, group := range groups {
+		if selected[i] {
+			out = append(out, group.Name)
+		}
+	}
+	return out, nil
+}
+
+// SelectCleaners shows the specified Cleaners and returns the names of those the user selected
+func (p *Prompter) SelectCleaners(names []string) ([]string, error) {
+	selected, err := p.selectItems(context.Background(), "Cleaners", names)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0)
+	for i, name := range names {
+		if selected[i] {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+// Confirm asks the user whether the mutation described by `req` should be performed, returning the error from
+// `ctx` if it's cancelled before the user answers
+func (p *Prompter) Confirm(ctx context.Context, req gateway.Request) (bool, error) {
+	if err := p.lock(ctx); err != nil {
+		return false, err
+	}
+	defer p.unlock()
+
+	if p.confirmAll {
+		return true, nil
+	}
+	if p.declineAll {
+		return false, nil
+	}
+
+	for {
+		p.printf("About to %s %s - continue? [y]es / [n]o / [a]ll remaining / [q]uit: ", req.Operation, req.Target)
+		line, err := p.readLine(ctx)
+		if err != nil {
+			p.printf("\n")
+			return false, err
+		}
+
+		switch strings.ToLower(line) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no", "":
+			return false, nil
+		case "a", "all":
+			p.confirmAll = true
+			return true, nil
+		case "q", "quit":
+			p.declineAll = true
+			return false, nil
+		}
+		p.printf("Unknown response %q\n", line)
+	}
+}
+
+// selectItems shows each of the rows, all of which are initially selected, until the user confirms the selection
+func (p *Prompter) selectItems(ctx context.Context, title string, rows []string) ([]bool, error) {
+	if err := p.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.unlock()
+
+	selected := make([]bool, len(rows))
+	for i := range selected {
+		selected[i] = true
+	}
+	if len(rows) == 0 {
+		return selected, nil
+	}
+
+	for {
+		p.printf("\n%s:\n", title)
+		for i, row := range rows {
+			tick := " "
+			if selected[i] {
+				tick = "x"
+			}
+			p.printf("  [%s] %3d) %s\n", tick, i+1, row)
+		}
+		p.printf("Toggle items by number or range (e.g. `1 3 5-7`), `all`, `none`, `done` to continue or `quit` to abort: ")
+
+		line, err := p.readLine(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(line) {
+		case "done", "d":
+			return selected, nil
+		case "quit", "q":
+			return nil, fmt.Errorf("aborted by the user")
+		case "all":
+			for i := range selected {
+				selected[i] = true
+			}
+			continue
+		case "none":
+			for i := range selected {
+				selected[i] = false
+			}
+			continue
+		}
+
+		indexes, err := parseIndexes(line, len(rows))
+		if err != nil {
+			p.printf("%+v\n", err)
+			continue
+		}
+		for _, i := range indexes {
+			selected[i] = !selected[i]
+		}
+	}
+}
+
+func (p *Prompter) printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(p.writer, format, args...)
+}
+
+func (p *Prompter) lock(ctx context.Context) error {
+	select {
+	case p.prompting <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if !p.abandoned {
+		return nil
+	}
+	// the answer typed for the abandoned prompt (if any) is discarded, rather than being taken as the answer to this one
+	p.abandoned = false
+	for {
+		select {
+		case _, ok := <-p.lines:
+			if ok {
+				continue
+			}
+		default:
+		}
+		return nil
+	}
+}
+
+func (p *Prompter) unlock() {
+	<-p.prompting
+}
+
+// readLine returns the next line the user enters, or the error from `ctx` if it's cancelled first
+func (p *Prompter) readLine(ctx context.Context) (string, error) {
+	p.startReading.Do(func() {
+		go p.readLines()
+	})
+
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			return "", p.readErr
+		}
+		return line, nil
+	case <-ctx.Done():
+		p.abandoned = true
+		return "", ctx.Err()
+	}
+}
+
+func (p *Prompter) readLines() {
+	defer close(p.lines)
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			p.readErr = fmt.Errorf("reading from the terminal: %+v", err)
+			return
+		}
+		p.lines <- strings.TrimSpace(line)
+	}
+}
+
+// parseIndexes parses a list of 1-based numbers and ranges (e.g. `1 3 5-7`) into 0-based indexes
+func parseIndexes(input string, count int) ([]int, error) {
+	out := make([]int, 0)
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool { return r == ' ' || r == ',' }) {
+		start, end := field, field
+		if split := strings.SplitN(field, "-", 2); len(split) == 2 {
+			start, end = split[0], split[1]
+		}
+
+		from, err := strconv.Atoi(start)
+		if err != nil {
+			return nil, fmt.Errorf("expected %q to be a number or range", field)
+		}
+		to, err := strconv.Atoi(end)
+		if err != nil {
+			return nil, fmt.Errorf("expected %q to be a number or range", field)
+		}
+		if from < 1 || to > count || from > to {
+			return nil, fmt.Errorf("expected %q to be between 1 and %d", field, count)
+		}
+
+		for i := from; i <= to; i++ {
+			out = append(out, i-1)
+		}
+	}
+	return out, nil
+}
+
+func formatAge(age time.Duration) string {
+	if age >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+	if age >= time.Hour {
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dm", int(age.Minutes()))
+}
+
+func summariseTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "(no tags)"
+	}
+
+	items := make([]string, 0, len(tags))
+	for k, v := range tags {
+		items = append(items, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(items)
+	if len(items) > 3 {
+		items = append(items[0:3], fmt.Sprintf("(+%d more)", len(items)-3))
+	}
+	return strings.Join(items, ", ")
+}
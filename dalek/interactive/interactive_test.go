@@ -0,0 +1,98 @@
+package interactive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
+)
+
+func TestPrompterConfirm(t *testing.T) {
+	req := gateway.Request{
+		Operation: gateway.OperationDelete,
+		Target:    "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestRG-1",
+	}
+
+	testData := []struct {
+		name     string
+		input    string
+		expected []bool
+	}{
+		{
+			name:     "yes then no",
+			input:    "y\nn\n",
+			expected: []bool{true, false},
+		},
+		{
+			name:     "unknown response is asked again",
+			input:    "maybe\nyes\n",
+			expected: []bool{true},
+		},
+		{
+			name:     "all remaining",
+			input:    "a\n",
+			expected: []bool{true, true, true},
+		},
+		{
+			name:     "quit",
+			input:    "q\n",
+			expected: []bool{false, false, false},
+		},
+		{
+			name:     "answer without a trailing newline",
+			input:    "y",
+			expected: []bool{true},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			p := New(strings.NewReader(v.input), io.Discard)
+			for i, expected := range v.expected {
+				actual, err := p.Confirm(context.Background(), req)
+				if err != nil {
+					t.Fatalf("confirming %d: %+v", i, err)
+				}
+				if actual != expected {
+					t.Fatalf("expected confirmation %d to be %t but got %t", i, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestPrompterConfirmCancelled(t *testing.T) {
+	req := gateway.Request{
+		Operation: gateway.OperationDelete,
+		Target:    "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/acctestRG-1",
+	}
+	in, typed := io.Pipe()
+	defer typed.Close()
+	p := New(in, io.Discard)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Confirm(ctx, req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the abandoned prompt to return %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	// the answer to the abandoned prompt is typed before the next prompt is shown, so shouldn't be used for it
+	if _, err := io.WriteString(typed, "y\n"); err != nil {
+		t.Fatalf("typing the answer: %+v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		_, _ = io.WriteString(typed, "n\n")
+	}()
+
+	confirmed, err := p.Confirm(context.Background(), req)
+	if err != nil {
+		t.Fatalf("confirming: %+v", err)
+	}
+	if confirmed {
+		t.Fatalf("expected the answer to the abandoned prompt to be discarded")
+	}
+}
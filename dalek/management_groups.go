@@ -2,16 +2,23 @@ package dalek
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/managementgroups/2021-04-01/managementgroups"
 	"github.com/hashicorp/go-uuid"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
 )
 
-func (d *Dalek) ManagementGroups(ctx context.Context) error {
+func (d *Dalek) managementGroups(ctx context.Context) error {
+	if !d.client.Profile.Supports("Microsoft.Management") {
+		// e.g. Azure Stack Hub, where Management Groups aren't available
+		d.logger.Printf("[DEBUG] Management Groups aren't available in the API Profile %q - Skipping..", d.client.Profile.Name)
+		return nil
+	}
+
 	if err := d.deleteManagementGroups(ctx); err != nil {
 		return fmt.Errorf("processing Management Groups: %+v", err)
 	}
@@ -26,7 +33,7 @@ func (d *Dalek) deleteManagementGroups(ctx context.Context) error {
 	}
 
 	if groups.Model == nil {
-		log.Printf("[DEBUG]   No Management Groups found")
+		d.logger.Printf("[DEBUG]   No Management Groups found")
 		return nil
 	}
 	for _, group := range *groups.Model {
@@ -43,20 +50,21 @@ func (d *Dalek) deleteManagementGroups(ctx context.Context) error {
 		id := commonids.NewManagementGroupID(*group.Id)
 
 		if _, err := uuid.ParseUUID(groupName); err != nil {
-			log.Printf("[DEBUG]   Skipping Management Group %q", groupName)
+			d.logger.Printf("[DEBUG]   Skipping Management Group %q", groupName)
 			continue
 		}
-		if !d.opts.ActuallyDelete {
-			log.Printf("[DEBUG] Would have deleted Management Group %q", id)
+		req := gateway.Request{
+			Operation: gateway.OperationDelete,
+			Target:    id.ID(),
 		}
-
-		log.Printf("[DEBUG]   Deleting %s", id)
-
-		if _, err := client.Delete(ctx, id, managementgroups.DefaultDeleteOperationOptions()); err != nil {
-			log.Printf("[DEBUG]   Error during deletion of %s: %s", id, err)
+		err := d.gateway.Do(ctx, req, func(ctx context.Context) error {
+			_, err := client.Delete(ctx, id, managementgroups.DefaultDeleteOperationOptions())
+			return err
+		})
+		if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+			d.logger.Printf("[DEBUG]   Error during deletion of %s: %s", id, err)
 			continue
 		}
-		log.Printf("[DEBUG]   Deleted %s", id)
 	}
 	return nil
 }
@@ -0,0 +1,70 @@
+package dalek
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+)
+
+// TestManagementGroupsUsesAPIProfile replays the Management Groups being listed, failing if a request is sent
+// which isn't in the cassette - Management Groups aren't available on Azure Stack Hub, so shouldn't be listed.
+func TestManagementGroupsUsesAPIProfile(t *testing.T) {
+	listManagementGroups := transports.Interaction{
+		Request: transports.CassetteRequest{
+			Method: "GET",
+			URL:    "https://management.azure.com/providers/Microsoft.Management/managementGroups?api-version=2021-04-01",
+		},
+		Response: transports.CassetteResponse{
+			StatusCode: 200,
+			Body:       json.RawMessage(`{"value": []}`),
+		},
+	}
+
+	testData := []struct {
+		profile      clients.APIProfile
+		interactions []transports.Interaction
+	}{
+		{
+			profile:      clients.ProfileLatest,
+			interactions: []transports.Interaction{listManagementGroups},
+		},
+		{
+			profile:      clients.ProfileAzureStackHub,
+			interactions: []transports.Interaction{},
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.profile.Name, func(t *testing.T) {
+			replayer := transports.NewReplayer(transports.Cassette{Interactions: v.interactions})
+			client := testclient.NewForProfile(t, replayer, v.profile)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			opts := options.Options{
+				NumberOfResourceGroupsToDelete: 1000,
+				Prefix:                         "acctest",
+			}
+			d, err := New(ctx, opts, WithAzureClient(client))
+			if err != nil {
+				t.Fatalf("building the Dalek: %+v", err)
+			}
+
+			if err := d.managementGroups(ctx); err != nil {
+				t.Fatalf("processing Management Groups: %+v", err)
+			}
+			for _, request := range replayer.Unmatched() {
+				t.Errorf("unexpected request %s %s", request.Method, request.URL)
+			}
+			for _, interaction := range replayer.Unused() {
+				t.Errorf("expected %s %s to be replayed but it wasn't", interaction.Request.Method, interaction.Request.URL)
+			}
+		})
+	}
+}
@@ -2,31 +2,32 @@ package dalek
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/hashicorp/go-azure-sdk/sdk/odata"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/gateway"
 )
 
-func (d *Dalek) MicrosoftGraph(ctx context.Context) error {
+func (d *Dalek) microsoftGraph(ctx context.Context) error {
 	return nil
-	//log.Printf("[DEBUG] Preparing to delete Service Principals")
+	//d.logger.Printf("[DEBUG] Preparing to delete Service Principals")
 	//if err := d.deleteMicrosoftGraphServicePrincipals(ctx); err != nil {
 	//	return fmt.Errorf("deleting Service Principals: %+v", err)
 	//}
 	//
-	//log.Printf("[DEBUG] Preparing to delete Applications")
+	//d.logger.Printf("[DEBUG] Preparing to delete Applications")
 	//if err := d.deleteMicrosoftGraphApplications(ctx); err != nil {
 	//	return fmt.Errorf("deleting Applications: %+v", err)
 	//}
 	//
-	//log.Printf("[DEBUG] Preparing to delete Groups")
+	//d.logger.Printf("[DEBUG] Preparing to delete Groups")
 	//if err := d.deleteMicrosoftGraphGroups(ctx); err != nil {
 	//	return fmt.Errorf("deleting Groups: %+v", err)
 	//}
 	//
-	//log.Printf("[DEBUG] Preparing to delete Users")
+	//d.logger.Printf("[DEBUG] Preparing to delete Users")
 	//if err := d.deleteMicrosoftGraphUsers(ctx); err != nil {
 	//	return fmt.Errorf("deleting Users: %+v", err)
 	//}
@@ -54,17 +55,18 @@ func (d *Dalek) deleteMicrosoftGraphApplications(ctx context.Context) error {
 		displayName := *app.DisplayName
 
 		if strings.TrimPrefix(displayName, d.opts.Prefix) != displayName {
-			if !d.opts.ActuallyDelete {
-				log.Printf("[DEBUG] Would have deleted Microsoft Graph Application %q (AppID: %s, ObjID: %s)", displayName, appID, id)
-				continue
+			req := gateway.Request{
+				Operation: gateway.OperationDelete,
+				Target:    fmt.Sprintf("Microsoft Graph Application %q (AppID: %s, ObjID: %s)", displayName, appID, id),
 			}
-
-			log.Printf("[DEBUG] Deleting Microsoft Graph Application %q (AppID: %s, ObjectId: %s)...", displayName, appID, id)
-			if _, err := client.Delete(ctx, id); err != nil {
-				log.Printf("[DEBUG] Error during deletion of Microsoft Graph Application %q (AppID: %s, ObjID: %s): %s", displayName, appID, id, err)
+			err := d.gateway.Do(ctx, req, func(ctx context.Context) error {
+				_, err := client.Delete(ctx, id)
+				return err
+			})
+			if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+				d.logger.Printf("[DEBUG] Error during deletion of Microsoft Graph Application %q (AppID: %s, ObjID: %s): %s", displayName, appID, id, err)
 				continue
 			}
-			log.Printf("[DEBUG] Deleted Microsoft Graph Application %q (AppID: %s, ObjID: %s)", displayName, appID, id)
 		}
 	}
 
@@ -90,17 +92,18 @@ func (d *Dalek) deleteMicrosoftGraphGroups(ctx context.Context) error {
 		displayName := *group.DisplayName
 
 		if strings.TrimPrefix(displayName, d.opts.Prefix) != displayName {
-			if !d.opts.ActuallyDelete {
-				log.Printf("[DEBUG] Would have deleted Microsoft Graph Group %q (ObjID: %s)", displayName, id)
-				continue
+			req := gateway.Request{
+				Operation: gateway.OperationDelete,
+				Target:    fmt.Sprintf("Microsoft Graph Group %q (ObjID: %s)", displayName, id),
 			}
-
-			log.Printf("[DEBUG] Deleting Microsoft Graph Group %q (ObjectId: %s)...", displayName, id)
-			if _, err := client.Delete(ctx, id); err != nil {
-				log.Printf("[DEBUG] Error during deletion of Microsoft Graph Group %q (ObjID: %s): %s", displayName, id, err)
+			err := d.gateway.Do(ctx, req, func(ctx context.Context) error {
+				_, err := client.Delete(ctx, id)
+				return err
+			})
+			if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+				d.logger.Printf("[DEBUG] Error during deletion of Microsoft Graph Group %q (ObjID: %s): %s", displayName, id, err)
 				continue
 			}
-			log.Printf("[DEBUG] Deleted Microsoft Graph Group %q (ObjID: %s)", displayName, id)
 		}
 	}
 
@@ -130,17 +133,18 @@ func (d *Dalek) deleteMicrosoftGraphServicePrincipals(ctx context.Context) error
 		displayName := *servicePrincipal.DisplayName
 
 		if strings.TrimPrefix(displayName, d.opts.Prefix) != displayName {
-			if !d.opts.ActuallyDelete {
-				log.Printf("[DEBUG] Would have deleted Microsoft Graph Service Principal %q (ObjID: %s)", displayName, id)
-				continue
+			req := gateway.Request{
+				Operation: gateway.OperationDelete,
+				Target:    fmt.Sprintf("Microsoft Graph Service Principal %q (ObjID: %s)", displayName, id),
 			}
-
-			log.Printf("[DEBUG] Deleting Microsoft Graph Service Principal %q (ObjectId: %s)...", displayName, id)
-			if _, err := client.Delete(ctx, id); err != nil {
-				log.Printf("[DEBUG] Error during deletion of Microsoft Graph Service Principal %q (ObjID: %s): %s", displayName, id, err)
+			err := d.gateway.Do(ctx, req, func(ctx context.Context) error {
+				_, err := client.Delete(ctx, id)
+				return err
+			})
+			if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+				d.logger.Printf("[DEBUG] Error during deletion of Microsoft Graph Service Principal %q (ObjID: %s): %s", displayName, id, err)
 				continue
 			}
-			log.Printf("[DEBUG] Deleted Microsoft Graph Service Principal %q (ObjID: %s)", displayName, id)
 		}
 	}
 
@@ -166,17 +170,18 @@ func (d *Dalek) deleteMicrosoftGraphUsers(ctx context.Context) error {
 		displayName := *user.DisplayName
 
 		if strings.TrimPrefix(displayName, d.opts.Prefix) != displayName {
-			if !d.opts.ActuallyDelete {
-				log.Printf("[DEBUG] Would have deleted Microsoft Graph User %q (ObjID: %s)", displayName, id)
-				continue
+			req := gateway.Request{
+				Operation: gateway.OperationDelete,
+				Target:    fmt.Sprintf("Microsoft Graph User %q (ObjID: %s)", displayName, id),
 			}
-
-			log.Printf("[DEBUG] Deleting Microsoft Graph User %q (ObjectId: %s)...", displayName, id)
-			if _, err := client.Delete(ctx, id); err != nil {
-				log.Printf("[DEBUG] Error during deletion of Microsoft Graph User %q (ObjID: %s): %s", displayName, id, err)
+			err := d.gateway.Do(ctx, req, func(ctx context.Context) error {
+				_, err := client.Delete(ctx, id)
+				return err
+			})
+			if err != nil && !errors.Is(err, gateway.ErrBlocked) {
+				d.logger.Printf("[DEBUG] Error during deletion of Microsoft Graph User %q (ObjID: %s): %s", displayName, id, err)
 				continue
 			}
-			log.Printf("[DEBUG] Deleted Microsoft Graph User %q (ObjID: %s)", displayName, id)
 		}
 	}
 
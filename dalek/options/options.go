@@ -3,19 +3,164 @@ package options
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type Options struct {
+	// RunID is a unique identifier for this run of the Dalek
+	RunID string
+
 	Prefix                         string
 	NumberOfResourceGroupsToDelete int64
 	ActuallyDelete                 bool
+
+	// AllowEmptyPrefix must be set to run without a Prefix, since an empty Prefix matches every Resource Group
+	AllowEmptyPrefix bool
+
+	// AllowedSubscriptions is the allow-list of Subscriptions which the Dalek can run against
+	AllowedSubscriptions SubscriptionAllowList
+
+	// BlastRadius limits how many Resource Groups can be deleted in a single run
+	BlastRadius BlastRadius
+
+	// Quarantine marks Resource Groups for deletion rather than deleting them immediately
+	Quarantine Quarantine
+
+	// Expiry deletes the resources and Resource Groups whose expiry tag is in the past, regardless of the Prefix
+	Expiry Expiry
+
+	// Timeouts limits how long each Cleaner (and each Resource Group) can take
+	Timeouts Timeouts
+
+	// Age limits which Resource Groups can be deleted based on when they were created
+	Age Age
+
+	// Diagnostics configures the read-only checks which explain why previous deletions haven't completed
+	Diagnostics Diagnostics
+}
+
+// Diagnostics are read-only checks which are run alongside the clean-up, the results of which are
+// included in the report.
+type Diagnostics struct {
+	// StuckDeletionThreshold is how long a Resource Group can be Deleting before the resources remaining
+	// within it are diagnosed, 0 disables this check
+	StuckDeletionThreshold time.Duration
+
+	// DeletionStatusTimeout is how long to wait for the Resource Group deletions issued during the run to
+	// complete, so that the reason for any failures can be reported - 0 checks their status once
+	DeletionStatusTimeout time.Duration
+}
+
+// Age determines when each Resource Group was created, so that only Resource Groups older than
+// MinimumAge are deleted.
+type Age struct {
+	// MinimumAge is how long ago a Resource Group must have been created to be deleted, 0 disables this check.
+	// Resource Groups whose age can't be determined aren't deleted when this is set.
+	MinimumAge time.Duration
+
+	// NamePattern is a regular expression whose first capture group is a timestamp within the Resource Group
+	// name, e.g. `^acctestRG-(\d{10})` - when set this is used in preference to the creation times from
+	// Resource Manager (which requires listing the resources within each Resource Group)
+	NamePattern string
+
+	// NameTimeLayout is the Go time layout of the timestamp matched by NamePattern, e.g. `0601021504`
+	NameTimeLayout string
+}
+
+// Timeouts are the time budgets for each part of the run, so that a single hung operation can't starve
+// everything after it - when a budget is exceeded the run moves on. A budget of 0 means no budget.
+type Timeouts struct {
+	// SubscriptionCleaner is the budget for each Subscription Cleaner
+	SubscriptionCleaner time.Duration
+
+	// ResourceGroup is the budget for each Resource Group, covering its Resource Group Cleaners and deletion
+	ResourceGroup time.Duration
+
+	// ResourceGroupCleaner is the budget for each Resource Group Cleaner within a Resource Group
+	ResourceGroupCleaner time.Duration
+}
+
+// Quarantine tags matching Resource Groups rather than deleting them - a later run then deletes them
+// once the GracePeriod has elapsed, providing the tag is still present.
+type Quarantine struct {
+	Enabled bool
+
+	// GracePeriod is how long a Resource Group must have been marked for before it's deleted
+	GracePeriod time.Duration
+}
+
+// DefaultExpiryTag is the key of the Tag containing the date a resource or Resource Group expires on
+const DefaultExpiryTag = "ExpiresOn"
+
+// Expiry deletes the resources and Resource Groups anywhere within the Subscription which have the Tag `Tag`
+// set to a date (e.g. `2026-11-01`) which has been reached - this is opt-in since it ignores the Prefix.
+type Expiry struct {
+	Enabled bool
+
+	// Tag is the key of the Tag containing the date, compared case-insensitively
+	Tag string
+}
+
+// BlastRadius is a circuit breaker which aborts the run when the filters match more Resource Groups
+// than expected, which is likely a sign that the filters are misconfigured.
+type BlastRadius struct {
+	// MaxResourceGroups is the maximum number of Resource Groups which can be deleted, 0 disables this check
+	MaxResourceGroups int
+
+	// MaxPercentage is the maximum percentage of the Resource Groups within the Subscription which
+	// can be deleted, 0 disables this check
+	MaxPercentage float64
+
+	// Override allows a single run to exceed the limits above
+	Override bool
+}
+
+// SubscriptionAllowList matches a Subscription by its ID, Display Name or Tags - a Subscription
+// is allowed when any one of these matches.
+type SubscriptionAllowList struct {
+	IDs          []string
+	DisplayNames []string
+	Tags         map[string]string
 }
 
 func (o Options) String() string {
 	components := []string{
+		fmt.Sprintf("Run ID %q", o.RunID),
 		fmt.Sprintf("Prefix %q", o.Prefix),
 		fmt.Sprintf("Number RGs to Delete %d", o.NumberOfResourceGroupsToDelete),
 		fmt.Sprintf("Actually Delete %t", o.ActuallyDelete),
+		fmt.Sprintf("Allow Empty Prefix %t", o.AllowEmptyPrefix),
+		fmt.Sprintf("Allowed Subscriptions %s", o.AllowedSubscriptions),
+		fmt.Sprintf("Blast Radius %s", o.BlastRadius),
+		fmt.Sprintf("Quarantine %t (Grace Period %s)", o.Quarantine.Enabled, o.Quarantine.GracePeriod),
+		fmt.Sprintf("Expiry %t (Tag %q)", o.Expiry.Enabled, o.Expiry.Tag),
+		fmt.Sprintf("Timeouts %s", o.Timeouts),
+		fmt.Sprintf("Age %s", o.Age),
+		fmt.Sprintf("Diagnostics %s", o.Diagnostics),
 	}
 	return strings.Join(components, "\n")
 }
+
+func (l SubscriptionAllowList) String() string {
+	tags := make([]string, 0)
+	for k, v := range l.Tags {
+		tags = append(tags, fmt.Sprintf("%s=%s", k, v))
+	}
+	return fmt.Sprintf("IDs %q / Display Names %q / Tags %q", l.IDs, l.DisplayNames, tags)
+}
+
+func (b BlastRadius) String() string {
+	return fmt.Sprintf("Max RGs %d / Max Percentage %.0f%% / Override %t", b.MaxResourceGroups, b.MaxPercentage, b.Override)
+}
+
+func (t Timeouts) String() string {
+	return fmt.Sprintf("Subscription Cleaner %s / Resource Group %s / Resource Group Cleaner %s", t.SubscriptionCleaner, t.ResourceGroup, t.ResourceGroupCleaner)
+}
+
+func (a Age) String() string {
+	return fmt.Sprintf("Minimum %s / Name Pattern %q / Name Time Layout %q", a.MinimumAge, a.NamePattern, a.NameTimeLayout)
+}
+
+func (d Diagnostics) String() string {
+	return fmt.Sprintf("Stuck Deletion Threshold %s / Deletion Status Timeout %s", d.StuckDeletionThreshold, d.DeletionStatusTimeout)
+}
@@ -0,0 +1,350 @@
+package report
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type Outcome string
+
+const (
+	// OutcomeDryRun means the action would have been performed, but the Dalek isn't actually deleting things
+	OutcomeDryRun Outcome = "DryRun"
+
+	// OutcomeFailed means the action was performed but returned an error
+	OutcomeFailed Outcome = "Failed"
+
+	// OutcomeSkipped means the action was blocked by the filters (for example the resource is protected)
+	OutcomeSkipped Outcome = "Skipped"
+
+	// OutcomeSucceeded means the action was performed successfully
+	OutcomeSucceeded Outcome = "Succeeded"
+)
+
+// Action is a record of a single mutating operation requested against Azure
+type Action struct {
+	// Operation is the kind of mutation, e.g. `delete`
+	Operation string `json:"operation"`
+
+	// Target is the Resource ID (or a description of the object) being mutated
+	Target string `json:"target"`
+
+	Outcome Outcome `json:"outcome"`
+
+	// Reason is why this action was Skipped, when Outcome is OutcomeSkipped
+	Reason string `json:"reason,omitempty"`
+
+	// Error is the error returned when Outcome is OutcomeFailed
+	Error string `json:"error,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// Overrun is a record of a Cleaner (or a Resource Group) which didn't complete within its time budget, so
+// the run moved on without it
+type Overrun struct {
+	// Cleaner is the name of the Cleaner which overran, or empty when the budget for a Resource Group was exceeded
+	Cleaner string `json:"cleaner"`
+
+	// Target is the Resource ID of the Subscription or Resource Group being cleaned
+	Target string `json:"target"`
+
+	// Budget is the time budget which was exceeded
+	Budget time.Duration `json:"budget"`
+
+	// StillRunning is whether the Cleaner was still running (having ignored being cancelled) when the run moved on
+	StillRunning bool `json:"stillRunning,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// StuckDeletion is a diagnosis of a Resource Group which has been Deleting for longer than expected
+type StuckDeletion struct {
+	// ResourceGroup is the Resource ID of the Resource Group which is stuck
+	ResourceGroup string `json:"resourceGroup"`
+
+	// DeletingSince is when the Resource Group started Deleting, or nil when this predates the change
+	// history retained by Resource Graph
+	DeletingSince *time.Time `json:"deletingSince,omitempty"`
+
+	// Remaining is the resources which remain within the Resource Group, grouped by Resource Type
+	Remaining []RemainingResources `json:"remaining"`
+
+	Time time.Time `json:"time"`
+}
+
+// RemainingResources is the number of resources of a given Resource Type remaining within a Resource Group
+type RemainingResources struct {
+	// Type is the Resource Type, e.g. `Microsoft.Network/virtualNetworks`
+	Type string `json:"type"`
+
+	Count int `json:"count"`
+
+	// KnownBlocker describes why this Resource Type is known to block deletion, or is empty when it isn't
+	KnownBlocker string `json:"knownBlocker,omitempty"`
+}
+
+// DeletionFailure is a record of a Resource Group deletion which was accepted by Resource Manager, but which
+// then failed asynchronously
+type DeletionFailure struct {
+	// ResourceGroup is the Resource ID of the Resource Group which couldn't be deleted
+	ResourceGroup string `json:"resourceGroup"`
+
+	// Code is the ARM error code, e.g. `ScopeLocked`
+	Code string `json:"code"`
+
+	Message string `json:"message,omitempty"`
+
+	// Details are the inner errors, which typically identify the resources which blocked the deletion
+	Details []ErrorDetail `json:"details,omitempty"`
+
+	// Remediations are the names of the Cleaners which were run to resolve this failure, before the deletion
+	// was retried - or empty when the failure isn't one which can be remediated
+	Remediations []string `json:"remediations,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// Codes returns the ARM error code for this DeletionFailure, followed by the code for each inner error
+func (f DeletionFailure) Codes() []string {
+	out := []string{f.Code}
+	for _, detail := range f.Details {
+		if detail.Code != "" {
+			out = append(out, detail.Code)
+		}
+	}
+	return out
+}
+
+// ErrorDetail is an inner error returned by Resource Manager, e.g. `InUseSubnetCannotBeDeleted`
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Target is the resource (or property) which this error relates to, when known
+	Target string `json:"target,omitempty"`
+}
+
+// ResourceGroupContents is a record of the resources found within a Resource Group which matched the filters
+type ResourceGroupContents struct {
+	// ResourceGroup is the Resource ID of the Resource Group
+	ResourceGroup string `json:"resourceGroup"`
+
+	// ResourceTypes is the number of resources of each Resource Type within the Resource Group
+	ResourceTypes map[string]int `json:"resourceTypes"`
+
+	Time time.Time `json:"time"`
+}
+
+// Report is a thread-safe record of everything the Dalek did (or would have done) during a run
+type Report struct {
+	lock             sync.Mutex
+	actions          []Action
+	deletionFailures []DeletionFailure
+	overruns         []Overrun
+	resourceGroups   []ResourceGroupContents
+	stuckDeletions   []StuckDeletion
+}
+
+func New() *Report {
+	return &Report{
+		actions:          make([]Action, 0),
+		deletionFailures: make([]DeletionFailure, 0),
+		overruns:         make([]Overrun, 0),
+		resourceGroups:   make([]ResourceGroupContents, 0),
+		stuckDeletions:   make([]StuckDeletion, 0),
+	}
+}
+
+// RecordAction appends the specified Action to this Report
+func (r *Report) RecordAction(action Action) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if action.Time.IsZero() {
+		action.Time = time.Now()
+	}
+	r.actions = append(r.actions, action)
+}
+
+// Actions returns a copy of the Actions recorded so far
+func (r *Report) Actions() []Action {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]Action, len(r.actions))
+	copy(out, r.actions)
+	return out
+}
+
+// RecordOverrun appends the specified Overrun to this Report
+func (r *Report) RecordOverrun(overrun Overrun) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if overrun.Time.IsZero() {
+		overrun.Time = time.Now()
+	}
+	r.overruns = append(r.overruns, overrun)
+}
+
+// Overruns returns a copy of the Overruns recorded so far
+func (r *Report) Overruns() []Overrun {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]Overrun, len(r.overruns))
+	copy(out, r.overruns)
+	return out
+}
+
+// RecordDeletionFailure appends the specified DeletionFailure to this Report
+func (r *Report) RecordDeletionFailure(failure DeletionFailure) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if failure.Time.IsZero() {
+		failure.Time = time.Now()
+	}
+	r.deletionFailures = append(r.deletionFailures, failure)
+}
+
+// DeletionFailures returns a copy of the DeletionFailures recorded so far
+func (r *Report) DeletionFailures() []DeletionFailure {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]DeletionFailure, len(r.deletionFailures))
+	copy(out, r.deletionFailures)
+	return out
+}
+
+// RecordStuckDeletion appends the specified StuckDeletion to this Report
+func (r *Report) RecordStuckDeletion(stuck StuckDeletion) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if stuck.Time.IsZero() {
+		stuck.Time = time.Now()
+	}
+	r.stuckDeletions = append(r.stuckDeletions, stuck)
+}
+
+// StuckDeletions returns a copy of the StuckDeletions recorded so far
+func (r *Report) StuckDeletions() []StuckDeletion {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]StuckDeletion, len(r.stuckDeletions))
+	copy(out, r.stuckDeletions)
+	return out
+}
+
+// RecordResourceGroupContents appends the specified ResourceGroupContents to this Report
+func (r *Report) RecordResourceGroupContents(contents ResourceGroupContents) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if contents.Time.IsZero() {
+		contents.Time = time.Now()
+	}
+	r.resourceGroups = append(r.resourceGroups, contents)
+}
+
+// ResourceGroupContents returns a copy of the ResourceGroupContents recorded so far
+func (r *Report) ResourceGroupContents() []ResourceGroupContents {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]ResourceGroupContents, len(r.resourceGroups))
+	copy(out, r.resourceGroups)
+	return out
+}
+
+// Log outputs a summary of the specified Actions using `logger`
+func Log(logger *log.Logger, actions []Action) {
+	counts := make(map[Outcome]int)
+	for _, action := range actions {
+		counts[action.Outcome]++
+	}
+
+	logger.Printf("[DEBUG] Report: %d actions (%d succeeded, %d failed, %d skipped, %d dry-run)", len(actions), counts[OutcomeSucceeded], counts[OutcomeFailed], counts[OutcomeSkipped], counts[OutcomeDryRun])
+	for _, action := range actions {
+		switch action.Outcome {
+		case OutcomeFailed:
+			logger.Printf("[DEBUG]   Failed to %s %s: %s", action.Operation, action.Target, action.Error)
+		case OutcomeSkipped:
+			logger.Printf("[DEBUG]   Skipped %s of %s: %s", action.Operation, action.Target, action.Reason)
+		}
+	}
+}
+
+// LogOverruns outputs a summary of the specified Overruns using `logger`
+func LogOverruns(logger *log.Logger, overruns []Overrun) {
+	if len(overruns) == 0 {
+		return
+	}
+
+	logger.Printf("[DEBUG] Budget Overruns: %d", len(overruns))
+	for _, overrun := range overruns {
+		suffix := ""
+		if overrun.StillRunning {
+			suffix = " and was still running when the run moved on"
+		}
+		if overrun.Cleaner == "" {
+			logger.Printf("[DEBUG]   %s didn't complete within %s%s", overrun.Target, overrun.Budget, suffix)
+			continue
+		}
+		logger.Printf("[DEBUG]   %q didn't complete within %s for %s%s", overrun.Cleaner, overrun.Budget, overrun.Target, suffix)
+	}
+}
+
+// LogStuckDeletions outputs the diagnosis of each of the specified StuckDeletions using `logger`
+func LogStuckDeletions(logger *log.Logger, stuckDeletions []StuckDeletion) {
+	if len(stuckDeletions) == 0 {
+		return
+	}
+
+	logger.Printf("[DEBUG] Stuck Deletions: %d", len(stuckDeletions))
+	for _, stuck := range stuckDeletions {
+		since := "before the change history retained by Resource Graph"
+		if stuck.DeletingSince != nil {
+			since = fmt.Sprintf("%s (%s ago)", stuck.DeletingSince.UTC().Format(time.RFC3339), time.Since(*stuck.DeletingSince).Round(time.Minute))
+		}
+		logger.Printf("[DEBUG]   %s has been Deleting since %s", stuck.ResourceGroup, since)
+		if len(stuck.Remaining) == 0 {
+			logger.Printf("[DEBUG]     No resources remain")
+		}
+		for _, remaining := range stuck.Remaining {
+			if remaining.KnownBlocker == "" {
+				logger.Printf("[DEBUG]     %d x %s", remaining.Count, remaining.Type)
+				continue
+			}
+			logger.Printf("[DEBUG]     %d x %s - known blocker: %s", remaining.Count, remaining.Type, remaining.KnownBlocker)
+		}
+	}
+}
+
+// LogDeletionFailures outputs the ARM error (and inner errors) for each of the specified DeletionFailures using `logger`
+func LogDeletionFailures(logger *log.Logger, failures []DeletionFailure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	logger.Printf("[DEBUG] Deletion Failures: %d", len(failures))
+	for _, failure := range failures {
+		logger.Printf("[DEBUG]   %s failed to delete with %q: %s", failure.ResourceGroup, failure.Code, failure.Message)
+		if len(failure.Remediations) > 0 {
+			logger.Printf("[DEBUG]     Remediated using %q and retried", failure.Remediations)
+		}
+		for _, detail := range failure.Details {
+			if detail.Target == "" {
+				logger.Printf("[DEBUG]     %q: %s", detail.Code, detail.Message)
+				continue
+			}
+			logger.Printf("[DEBUG]     %q for %s: %s", detail.Code, detail.Target, detail.Message)
+		}
+	}
+}
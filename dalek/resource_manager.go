@@ -2,19 +2,49 @@ package dalek
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/tombuildsstuff/azurerm-dalek/dalek/cleaners"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
 )
 
-func (d *Dalek) ResourceManager(ctx context.Context) (errors []error) {
+func (d *Dalek) resourceManager(ctx context.Context) (errs []error) {
 	subscriptionId := commonids.NewSubscriptionID(d.client.SubscriptionID)
-	for _, cleaner := range cleaners.SubscriptionCleaners {
-		log.Printf("[DEBUG] Running Subscription Cleaner %q in %q", cleaner.Name(), subscriptionId)
-		if err := cleaner.Cleanup(ctx, subscriptionId, d.client, d.opts); err != nil {
-			errors = append(errors, fmt.Errorf("running Subscription Cleaner %q in %q: %+v", cleaner.Name(), subscriptionId, err))
+	if err := d.checkBlastRadius(ctx, subscriptionId); err != nil {
+		return []error{fmt.Errorf("checking the blast radius in %q: %+v", subscriptionId, err)}
+	}
+
+	for _, cleaner := range d.subscriptionCleaners {
+		if !d.gateway.Filters().CleanerSelected(cleaner.Name()) {
+			d.logger.Printf("[DEBUG] Subscription Cleaner %q wasn't selected - Skipping..", cleaner.Name())
+			continue
+		}
+		d.logger.Printf("[DEBUG] Running Subscription Cleaner %q in %q", cleaner.Name(), subscriptionId)
+		d.events.Notify(ctx, events.Event{
+			Type:    events.TypeCleanerStarted,
+			Cleaner: cleaner.Name(),
+			Target:  subscriptionId.ID(),
+		})
+		cc := d.cleanup.ForCleaner(cleaner.Name())
+		budget := d.opts.Timeouts.SubscriptionCleaner
+		err := cleaners.RunWithinBudget(ctx, budget, func(ctx context.Context) error {
+			return cleaner.Cleanup(ctx, subscriptionId, cc)
+		})
+		d.events.Notify(ctx, events.Event{
+			Type:    events.TypeCleanerCompleted,
+			Cleaner: cleaner.Name(),
+			Target:  subscriptionId.ID(),
+			Error:   err,
+		})
+		if errors.Is(err, cleaners.ErrBudgetExceeded) {
+			// overruns are reported separately, the next Cleaner can still run
+			cc.RecordOverrun(ctx, cleaner.Name(), subscriptionId.ID(), budget, err)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("running Subscription Cleaner %q in %q: %+v", cleaner.Name(), subscriptionId, err))
 		}
 	}
 
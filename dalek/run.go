@@ -0,0 +1,128 @@
+package dalek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+// Result is the outcome of a run of the Dalek
+type Result struct {
+	// Actions is each of the mutations performed (or which would have been performed) during the run
+	Actions []report.Action
+
+	// Errors is each of the errors encountered during the run
+	Errors []error
+
+	// Overruns is each of the Cleaners (or Resource Groups) which didn't complete within their time budget,
+	// these aren't included in Errors since the run moved on without them
+	Overruns []report.Overrun
+
+	// DeletionFailures is each of the Resource Group deletions which were accepted, but then failed asynchronously
+	DeletionFailures []report.DeletionFailure
+
+	// StuckDeletions is the diagnosis of each of the Resource Groups which have been Deleting for longer
+	// than the StuckDeletionThreshold
+	StuckDeletions []report.StuckDeletion
+
+	// ResourceGroups is the number of resources of each Resource Type within each of the Resource Groups which
+	// matched the filters
+	ResourceGroups []report.ResourceGroupContents
+}
+
+// Err returns the errors encountered during the run combined into a single error, or nil
+func (r Result) Err() error {
+	return errors.Join(r.Errors...)
+}
+
+// ActionsWithOutcome returns the Actions which had the specified Outcome
+func (r Result) ActionsWithOutcome(outcome report.Outcome) []report.Action {
+	out := make([]report.Action, 0)
+	for _, action := range r.Actions {
+		if action.Outcome == outcome {
+			out = append(out, action)
+		}
+	}
+	return out
+}
+
+// ErrAlreadyRun is returned from Run when the Dalek has already been run, since the state of a run is built by New
+var ErrAlreadyRun = errors.New("this Dalek has already been run - a new Dalek must be built for each run")
+
+// Run verifies that it's safe to run, then runs the Cleaners against Resource Manager, Microsoft Graph
+// and Management Groups. The returned Result is populated even when an error is returned. Each Dalek can
+// only be run once, subsequent calls return ErrAlreadyRun.
+func (d *Dalek) Run(ctx context.Context) (*Result, error) {
+	d.runLock.Lock()
+	alreadyRun := d.ran
+	d.ran = true
+	d.runLock.Unlock()
+	if alreadyRun {
+		return &Result{Errors: []error{ErrAlreadyRun}}, ErrAlreadyRun
+	}
+
+	startedAt := time.Now()
+	d.events.Notify(ctx, events.Event{
+		Type:   events.TypeRunStarted,
+		Target: commonids.NewSubscriptionID(d.client.SubscriptionID).ID(),
+	})
+
+	result := &Result{
+		Errors: make([]error, 0),
+	}
+	defer func() {
+		result.Actions = d.report.Actions()
+		result.Overruns = d.report.Overruns()
+		result.StuckDeletions = d.report.StuckDeletions()
+		result.DeletionFailures = d.report.DeletionFailures()
+		result.ResourceGroups = d.report.ResourceGroupContents()
+		d.events.Notify(ctx, events.Event{
+			Type:   events.TypeRunCompleted,
+			Target: commonids.NewSubscriptionID(d.client.SubscriptionID).ID(),
+			Error:  result.Err(),
+		})
+		d.recordHistory(startedAt, result)
+	}()
+
+	d.logger.Printf("[DEBUG] Options: %s", d.opts)
+
+	d.logger.Printf("[DEBUG] Verifying it's safe to run..")
+	if err := d.verifySafeToRun(ctx); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("verifying it's safe to run: %+v", err))
+		return result, result.Err()
+	}
+
+	if d.prompter != nil {
+		if err := d.selectInteractively(ctx, d.prompter); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("selecting what to delete: %+v", err))
+			return result, result.Err()
+		}
+	}
+
+	d.logger.Printf("[DEBUG] Processing Resource Manager..")
+	if errs := d.resourceManager(ctx); len(errs) != 0 {
+		for _, err := range errs {
+			result.Errors = append(result.Errors, fmt.Errorf("processing Resource Manager: %+v", err))
+		}
+		return result, result.Err()
+	}
+
+	d.logger.Printf("[DEBUG] Processing Microsoft Graph..")
+	if err := d.microsoftGraph(ctx); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("processing Microsoft Graph: %+v", err))
+		return result, result.Err()
+	}
+
+	d.logger.Printf("[DEBUG] Processing Management Groups..")
+	if err := d.managementGroups(ctx); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("processing Management Groups: %+v", err))
+		return result, result.Err()
+	}
+
+	return result, nil
+}
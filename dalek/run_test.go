@@ -0,0 +1,46 @@
+package dalek
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/clients/testclient"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+)
+
+func TestRunOnlyRunsOnce(t *testing.T) {
+	// the cassette is empty, so the first run fails when verifying it's safe to run - which still counts as a run
+	replayer := transports.NewReplayer(transports.Cassette{})
+	client := testclient.New(t, replayer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	opts := options.Options{
+		NumberOfResourceGroupsToDelete: 1000,
+		Prefix:                         "acctest",
+	}
+	d, err := New(ctx, opts, WithAzureClient(client))
+	if err != nil {
+		t.Fatalf("building the Dalek: %+v", err)
+	}
+
+	if _, err := d.Run(ctx); errors.Is(err, ErrAlreadyRun) {
+		t.Fatalf("expected the first run not to return %v", ErrAlreadyRun)
+	}
+	requests := len(replayer.Unmatched())
+
+	result, err := d.Run(ctx)
+	if !errors.Is(err, ErrAlreadyRun) {
+		t.Fatalf("expected the second run to return %v but got %v", ErrAlreadyRun, err)
+	}
+	if !errors.Is(result.Err(), ErrAlreadyRun) {
+		t.Fatalf("expected the Result of the second run to contain %v but got %v", ErrAlreadyRun, result.Err())
+	}
+	if actual := len(replayer.Unmatched()); actual != requests {
+		t.Fatalf("expected the second run not to send any requests but it sent %d", actual-requests)
+	}
+}
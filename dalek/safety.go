@@ -0,0 +1,121 @@
+package dalek
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/hashicorp/go-azure-sdk/sdk/client"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/graph"
+)
+
+type subscriptionDetails struct {
+	SubscriptionID string            `json:"subscriptionId"`
+	DisplayName    string            `json:"name"`
+	Tags           map[string]string `json:"tags"`
+}
+
+// verifySafeToRun checks that the Dalek has been configured to run against this Subscription, and
+// that the filters won't match everything - this must be called prior to running any cleaners.
+func (d *Dalek) verifySafeToRun(ctx context.Context) error {
+	if d.opts.Prefix == "" && !d.opts.AllowEmptyPrefix {
+		return fmt.Errorf("refusing to run without a prefix since this would match every Resource Group - this can be overridden using `--i-know-what-im-doing-no-prefix`")
+	}
+
+	subscription, err := d.findSubscription(ctx)
+	if err != nil {
+		return fmt.Errorf("retrieving the details for Subscription %q: %+v", d.client.SubscriptionID, err)
+	}
+
+	allowList := d.opts.AllowedSubscriptions
+	for _, id := range allowList.IDs {
+		if strings.EqualFold(id, subscription.SubscriptionID) {
+			d.logger.Printf("[DEBUG] Subscription %q is allowed by ID", subscription.SubscriptionID)
+			return nil
+		}
+	}
+	for _, name := range allowList.DisplayNames {
+		if strings.EqualFold(name, subscription.DisplayName) {
+			d.logger.Printf("[DEBUG] Subscription %q is allowed by Display Name %q", subscription.SubscriptionID, subscription.DisplayName)
+			return nil
+		}
+	}
+	for key, value := range allowList.Tags {
+		for k, v := range subscription.Tags {
+			if strings.EqualFold(k, key) && strings.EqualFold(v, value) {
+				d.logger.Printf("[DEBUG] Subscription %q is allowed by the Tag %q", subscription.SubscriptionID, fmt.Sprintf("%s=%s", k, v))
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("Subscription %q (%q) doesn't match the allow-list (%s) - refusing to run", subscription.SubscriptionID, subscription.DisplayName, allowList)
+}
+
+func (d *Dalek) findSubscription(ctx context.Context) (*subscriptionDetails, error) {
+	if !d.client.Profile.SupportsResourceGraph() {
+		return d.getSubscription(ctx)
+	}
+
+	query := graph.Query{
+		Query: fmt.Sprintf(`
+resourcecontainers
+| where type =~ 'microsoft.resources/subscriptions'
+| where subscriptionId =~ %s
+| project subscriptionId, name, tags
+`, graph.String(d.client.SubscriptionID)),
+		Scope: graph.SubscriptionScope(d.client.SubscriptionID),
+	}
+	subscriptions, err := graph.Run[subscriptionDetails](ctx, graph.NewClient(d.client.ResourceManager.ResourceGraphClient), query)
+	if err != nil {
+		return nil, err
+	}
+	if len(subscriptions) != 1 {
+		return nil, fmt.Errorf("expected 1 Subscription but got %d", len(subscriptions))
+	}
+
+	return &subscriptions[0], nil
+}
+
+// getSubscription retrieves the details of the Subscription using the Subscriptions API, which is used when
+// Resource Graph isn't available (e.g. on Azure Stack Hub)
+func (d *Dalek) getSubscription(ctx context.Context) (*subscriptionDetails, error) {
+	subscriptionId := commonids.NewSubscriptionID(d.client.SubscriptionID)
+	opts := client.RequestOptions{
+		ContentType: "application/json; charset=utf-8",
+		ExpectedStatusCodes: []int{
+			http.StatusOK,
+		},
+		HttpMethod: http.MethodGet,
+		Path:       subscriptionId.ID(),
+	}
+	req, err := d.client.ResourceManager.ResourcesGroupsClient.Client.NewRequest(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %+v", err)
+	}
+	query := req.URL.Query()
+	query.Set("api-version", d.client.Profile.SubscriptionsAPIVersion)
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := req.Execute(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving %s: %+v", subscriptionId, err)
+	}
+
+	var model struct {
+		SubscriptionID string            `json:"subscriptionId"`
+		DisplayName    string            `json:"displayName"`
+		Tags           map[string]string `json:"tags"`
+	}
+	if err := resp.Unmarshal(&model); err != nil {
+		return nil, fmt.Errorf("parsing %s: %+v", subscriptionId, err)
+	}
+
+	return &subscriptionDetails{
+		SubscriptionID: model.SubscriptionID,
+		DisplayName:    model.DisplayName,
+		Tags:           model.Tags,
+	}, nil
+}
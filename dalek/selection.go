@@ -0,0 +1,79 @@
+package dalek
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/lang/pointer"
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/cleaners"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/interactive"
+)
+
+// selectInteractively asks the user which of the candidate Resource Groups and which Cleaners should be
+// used, then requires that each mutation is confirmed - this must be called prior to running any cleaners.
+func (d *Dalek) selectInteractively(ctx context.Context, prompter *interactive.Prompter) error {
+	subscriptionId := commonids.NewSubscriptionID(d.client.SubscriptionID)
+	candidates, err := cleaners.FindResourceGroupsToDelete(ctx, d.cleanup, subscriptionId)
+	if err != nil {
+		return fmt.Errorf("finding the Resource Groups to delete: %+v", err)
+	}
+
+	groups := make([]interactive.ResourceGroup, 0)
+	for _, candidate := range candidates.ResourceGroups {
+		group, err := d.summariseResourceGroup(ctx, candidate)
+		if err != nil {
+			return fmt.Errorf("summarising %s: %+v", candidate.ID, err)
+		}
+		groups = append(groups, *group)
+	}
+
+	resourceGroupNames, err := prompter.SelectResourceGroups(groups)
+	if err != nil {
+		return fmt.Errorf("selecting Resource Groups: %+v", err)
+	}
+
+	cleanerNames := make([]string, 0)
+	for _, cleaner := range d.subscriptionCleaners {
+		cleanerNames = append(cleanerNames, cleaner.Name())
+	}
+	for _, cleaner := range d.resourceGroupCleaners {
+		cleanerNames = append(cleanerNames, cleaner.Name())
+	}
+	selectedCleaners, err := prompter.SelectCleaners(cleanerNames)
+	if err != nil {
+		return fmt.Errorf("selecting Cleaners: %+v", err)
+	}
+
+	d.logger.Printf("[DEBUG] Selected %d Resource Groups and %d Cleaners", len(resourceGroupNames), len(selectedCleaners))
+	d.gateway.Select(resourceGroupNames, selectedCleaners)
+	d.gateway.RequireConfirmation(prompter)
+	return nil
+}
+
+// summariseResourceGroup determines the age of the Resource Group (using the oldest resource within it,
+// since Resource Groups don't expose this) and the number of resources it contains, from the Inventory.
+func (d *Dalek) summariseResourceGroup(ctx context.Context, candidate cleaners.ResourceGroupCandidate) (*interactive.ResourceGroup, error) {
+	resources, err := d.cleanup.Inventory.InResourceGroup(ctx, candidate.ID.ResourceGroupName)
+	if err != nil {
+		return nil, fmt.Errorf("listing the resources: %+v", err)
+	}
+
+	oldest := cleaners.OldestResourceCreatedAt(d.cleanup, resources, time.Now())
+	if oldest == nil {
+		// e.g. the Resource Group is empty, but its age can be inferred from its name
+		oldest = candidate.CreatedAt
+	}
+
+	group := interactive.ResourceGroup{
+		Name:          candidate.ID.ResourceGroupName,
+		Location:      candidate.Location,
+		Tags:          pointer.From(candidate.Tags),
+		ResourceCount: len(resources),
+	}
+	if oldest != nil {
+		group.Age = pointer.To(time.Since(*oldest))
+	}
+	return &group, nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+)
+
+// Configuration is a named set of filters which plans and runs can be started for
+type Configuration struct {
+	// Name is the unique name of this Configuration, which is used in the URL
+	Name string `json:"name"`
+
+	// Prefix is the prefix of the Resource Groups to delete - a plan or run can narrow this (e.g. `acctest` to
+	// `acctest-pipeline-1234`), but can't broaden it
+	Prefix string `json:"prefix"`
+
+	// AllowedSubscriptionIDs, AllowedSubscriptionNames and AllowedSubscriptionTags override the Subscription
+	// allow-list the service was started with, when any of these are specified
+	AllowedSubscriptionIDs   []string          `json:"allowedSubscriptionIds,omitempty"`
+	AllowedSubscriptionNames []string          `json:"allowedSubscriptionNames,omitempty"`
+	AllowedSubscriptionTags  map[string]string `json:"allowedSubscriptionTags,omitempty"`
+
+	// MaxResourceGroups and MaxResourceGroupsPercentage override the blast radius the service was started with
+	MaxResourceGroups           *int     `json:"maxResourceGroups,omitempty"`
+	MaxResourceGroupsPercentage *float64 `json:"maxResourceGroupsPercentage,omitempty"`
+
+	// MinimumAge overrides the minimum age of the Resource Groups to delete, e.g. `24h`
+	MinimumAge *Duration `json:"minimumAge,omitempty"`
+}
+
+// Duration is a time.Duration which is encoded in JSON as a string, e.g. `24h`
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v string
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("expected a duration such as `24h`: %+v", err)
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadConfigurations loads the Configurations from the JSON file at `path`, which contains an object with a
+// `configurations` array
+func LoadConfigurations(path string) ([]Configuration, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %+v", path, err)
+	}
+
+	var file struct {
+		Configurations []Configuration `json:"configurations"`
+	}
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("parsing %q: %+v", path, err)
+	}
+
+	seen := make(map[string]struct{})
+	for _, configuration := range file.Configurations {
+		if configuration.Name == "" {
+			return nil, fmt.Errorf("each Configuration in %q must have a `name`", path)
+		}
+		if strings.Contains(configuration.Name, "/") {
+			return nil, fmt.Errorf("the name of the Configuration %q can't contain a `/`", configuration.Name)
+		}
+		// running without a prefix matches every Resource Group, which the service never allows
+		if configuration.Prefix == "" {
+			return nil, fmt.Errorf("the Configuration %q must have a `prefix`", configuration.Name)
+		}
+		if _, exists := seen[configuration.Name]; exists {
+			return nil, fmt.Errorf("the Configuration %q is defined more than once", configuration.Name)
+		}
+		seen[configuration.Name] = struct{}{}
+	}
+
+	return file.Configurations, nil
+}
+
+// options returns the Options for a plan or run of this Configuration, based on the Options the service was
+// started with - `prefix` must start with the Prefix of this Configuration, or be empty to use it as-is.
+func (c Configuration) options(base options.Options, prefix string) (*options.Options, error) {
+	if prefix == "" {
+		prefix = c.Prefix
+	}
+	if !strings.HasPrefix(strings.ToLower(prefix), strings.ToLower(c.Prefix)) {
+		return nil, fmt.Errorf("the prefix %q must start with %q, the prefix of the Configuration %q", prefix, c.Prefix, c.Name)
+	}
+
+	opts := base
+	opts.Prefix = prefix
+	opts.AllowEmptyPrefix = false
+	// plans and runs are scoped to their prefix (and only one can be in progress for each), so deleting expired
+	// resources across the whole Subscription is left to the scheduled runs
+	opts.Expiry.Enabled = false
+	// the blast radius can only be overridden for a single run from the command line
+	opts.BlastRadius.Override = false
+	if len(c.AllowedSubscriptionIDs) > 0 || len(c.AllowedSubscriptionNames) > 0 || len(c.AllowedSubscriptionTags) > 0 {
+		opts.AllowedSubscriptions = options.SubscriptionAllowList{
+			IDs:          c.AllowedSubscriptionIDs,
+			DisplayNames: c.AllowedSubscriptionNames,
+			Tags:         c.AllowedSubscriptionTags,
+		}
+	}
+	if c.MaxResourceGroups != nil {
+		opts.BlastRadius.MaxResourceGroups = *c.MaxResourceGroups
+	}
+	if c.MaxResourceGroupsPercentage != nil {
+		opts.BlastRadius.MaxPercentage = *c.MaxResourceGroupsPercentage
+	}
+	if c.MinimumAge != nil {
+		opts.Age.MinimumAge = time.Duration(*c.MinimumAge)
+	}
+	return &opts, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+type Status string
+
+const (
+	// StatusRunning means the plan or run is in progress
+	StatusRunning Status = "Running"
+
+	// StatusSucceeded means the plan or run completed without any errors
+	StatusSucceeded Status = "Succeeded"
+
+	// StatusFailed means the plan or run completed with errors
+	StatusFailed Status = "Failed"
+
+	// StatusCancelled means the plan or run was cancelled before it completed
+	StatusCancelled Status = "Cancelled"
+)
+
+var _ events.Observer = &run{}
+
+// run is a plan or run of a Configuration, which records each Event as it happens so that these can be
+// streamed to clients
+type run struct {
+	id            string
+	configuration string
+	prefix        string
+	plan          bool
+	startedAt     time.Time
+
+	// cancel cancels the context the run is using
+	cancel context.CancelFunc
+
+	lock        sync.Mutex
+	status      Status
+	cancelled   bool
+	completedAt *time.Time
+	result      *dalek.Result
+	events      []Event
+
+	// updated is closed (and replaced) each time an Event is recorded or the run completes
+	updated chan struct{}
+}
+
+func (r *run) Notify(_ context.Context, event events.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.events = append(r.events, newEvent(event))
+	r.notifyLocked()
+}
+
+// complete records the outcome of the run
+func (r *run) complete(result *dalek.Result, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	r.completedAt = &now
+	r.result = result
+	switch {
+	case r.cancelled:
+		r.status = StatusCancelled
+	case err != nil:
+		r.status = StatusFailed
+	default:
+		r.status = StatusSucceeded
+	}
+	r.notifyLocked()
+}
+
+// requestCancellation cancels the run if it's still in progress, returning whether it was
+func (r *run) requestCancellation() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.status != StatusRunning {
+		return false
+	}
+	r.cancelled = true
+	r.cancel()
+	return true
+}
+
+func (r *run) notifyLocked() {
+	close(r.updated)
+	r.updated = make(chan struct{})
+}
+
+// eventsSince returns the Events recorded after the first `offset`, whether the run has completed and a
+// channel which is closed when either of these next changes
+func (r *run) eventsSince(offset int) ([]Event, bool, <-chan struct{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]Event, 0)
+	if offset < len(r.events) {
+		out = append(out, r.events[offset:]...)
+	}
+	return out, r.status != StatusRunning, r.updated
+}
+
+// Run is a summary of a plan or run of a Configuration, which includes the Report once it has completed
+type Run struct {
+	ID            string     `json:"id"`
+	Configuration string     `json:"configuration"`
+	Prefix        string     `json:"prefix"`
+	Plan          bool       `json:"plan"`
+	Status        Status     `json:"status"`
+	StartedAt     time.Time  `json:"startedAt"`
+	CompletedAt   *time.Time `json:"completedAt,omitempty"`
+	Report        *Report    `json:"report,omitempty"`
+}
+
+// Report is the outcome of a completed plan or run
+type Report struct {
+	Actions          []report.Action          `json:"actions"`
+	Errors           []string                 `json:"errors"`
+	Overruns         []report.Overrun         `json:"overruns"`
+	DeletionFailures []report.DeletionFailure `json:"deletionFailures"`
+	StuckDeletions   []report.StuckDeletion   `json:"stuckDeletions"`
+}
+
+// summary returns a summary of the run, including the Report when `includeReport` is set
+func (r *run) summary(includeReport bool) Run {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := Run{
+		ID:            r.id,
+		Configuration: r.configuration,
+		Prefix:        r.prefix,
+		Plan:          r.plan,
+		Status:        r.status,
+		StartedAt:     r.startedAt,
+		CompletedAt:   r.completedAt,
+	}
+	if includeReport && r.result != nil {
+		errors := make([]string, 0)
+		for _, err := range r.result.Errors {
+			errors = append(errors, err.Error())
+		}
+		out.Report = &Report{
+			Actions:          r.result.Actions,
+			Errors:           errors,
+			Overruns:         r.result.Overruns,
+			DeletionFailures: r.result.DeletionFailures,
+			StuckDeletions:   r.result.StuckDeletions,
+		}
+	}
+	return out
+}
+
+// Event is an events.Event encoded for clients, since the error isn't encoded otherwise
+type Event struct {
+	Type      events.Type `json:"type"`
+	Time      time.Time   `json:"time"`
+	RunID     string      `json:"runId"`
+	Cleaner   string      `json:"cleaner,omitempty"`
+	Operation string      `json:"operation,omitempty"`
+	Target    string      `json:"target,omitempty"`
+	Reason    string      `json:"reason,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+func newEvent(input events.Event) Event {
+	out := Event{
+		Type:      input.Type,
+		Time:      input.Time,
+		RunID:     input.RunID,
+		Cleaner:   input.Cleaner,
+		Operation: input.Operation,
+		Target:    input.Target,
+		Reason:    input.Reason,
+	}
+	if input.Error != nil {
+		out.Error = input.Error.Error()
+	}
+	return out
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+)
+
+// maxCompletedRuns is the number of completed plans/runs whose reports are retained
+const maxCompletedRuns = 100
+
+// Runner performs a plan or run of the Dalek using `opts`, notifying `observer` of each Event
+type Runner func(ctx context.Context, opts options.Options, observer events.Observer) (*dalek.Result, error)
+
+// DalekRunner returns a Runner which builds a new Dalek for each plan or run using `configure`
+func DalekRunner(logger *log.Logger, configure ...dalek.Option) Runner {
+	return func(ctx context.Context, opts options.Options, observer events.Observer) (*dalek.Result, error) {
+		runLogger := log.New(logger.Writer(), fmt.Sprintf("%s[%s] ", logger.Prefix(), opts.RunID), logger.Flags()|log.Lmsgprefix)
+		runConfigure := append(append([]dalek.Option{}, configure...), dalek.WithObserver(observer), dalek.WithLogger(runLogger))
+		client, err := dalek.New(ctx, opts, runConfigure...)
+		if err != nil {
+			return nil, fmt.Errorf("building the Dalek: %+v", err)
+		}
+		defer client.Close()
+
+		return client.Run(ctx)
+	}
+}
+
+// Server is an HTTP API which starts plans (which don't delete anything) and runs of a named Configuration,
+// streams the Events for each and returns their reports. Every request must be authenticated using the token
+// the Server was started with, as a Bearer token in the `Authorization` header.
+type Server struct {
+	base           options.Options
+	configurations map[string]Configuration
+	deadline       time.Duration
+	logger         *log.Logger
+	runner         Runner
+	token          string
+
+	lock sync.Mutex
+	runs map[string]*run
+
+	// closed is set once the Server is shutting down, after which no further plans or runs can be started
+	closed bool
+
+	// inProgress tracks the plans and runs which haven't completed, so that Shutdown can wait for them
+	inProgress sync.WaitGroup
+
+	// order is the ID of each run in the order it was started
+	order []string
+}
+
+// New returns a Server for the specified Configurations, where each plan or run uses `base` (the Options the
+// service was started with) overridden by the Configuration, and is limited to `deadline`. Runs (which delete
+// things) are only allowed when `base.ActuallyDelete` is set - otherwise only plans can be started.
+func New(base options.Options, configurations []Configuration, token string, deadline time.Duration, runner Runner, logger *log.Logger) (*Server, error) {
+	if token == "" {
+		return nil, fmt.Errorf("a token must be specified to authenticate requests")
+	}
+
+	byName := make(map[string]Configuration)
+	for _, configuration := range configurations {
+		byName[configuration.Name] = configuration
+	}
+	return &Server{
+		base:           base,
+		configurations: byName,
+		deadline:       deadline,
+		logger:         logger,
+		runner:         runner,
+		token:          token,
+		runs:           make(map[string]*run),
+	}, nil
+}
+
+// Close cancels each of the plans and runs which are in progress, without waiting for them to complete
+func (s *Server) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	for _, r := range s.runs {
+		r.requestCancellation()
+	}
+}
+
+// Shutdown cancels each of the plans and runs which are in progress and then waits for them to complete, returning
+// an error when they haven't completed before `ctx` is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Close()
+
+	completed := make(chan struct{})
+	go func() {
+		s.inProgress.Wait()
+		close(completed)
+	}()
+
+	select {
+	case <-completed:
+		return nil
+	case <-ctx.Done():
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		running := make([]string, 0)
+		for _, id := range s.order {
+			if s.runs[id].summary(false).Status == StatusRunning {
+				running = append(running, id)
+			}
+		}
+		return fmt.Errorf("waiting for the plans and runs to complete: %+v - %q are still running", ctx.Err(), running)
+	}
+}
+
+// ServeHTTP handles the following requests:
+//
+//	GET  /configurations                  lists the Configurations
+//	POST /configurations/{name}/plan      starts a plan, which doesn't delete anything
+//	POST /configurations/{name}/run       starts a run, which deletes the matching resources
+//	GET  /runs                            lists the plans and runs
+//	GET  /runs/{id}                       returns the plan or run, including the report once completed
+//	GET  /runs/{id}/events                streams the Events as newline-delimited JSON until it completes
+//	POST /runs/{id}/cancel                cancels the plan or run
+//
+// The body for starting a plan or run is optional, and can contain a `prefix` which narrows the Prefix of the
+// Configuration, for example `{"prefix": "acctest-pipeline-1234"}`.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !s.authenticated(req) {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("a valid Bearer token must be specified"))
+		return
+	}
+
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "configurations" && req.Method == http.MethodGet:
+		s.listConfigurations(w)
+
+	case len(segments) == 3 && segments[0] == "configurations" && req.Method == http.MethodPost && (segments[2] == "plan" || segments[2] == "run"):
+		s.start(w, req, segments[1], segments[2] == "plan")
+
+	case len(segments) == 1 && segments[0] == "runs" && req.Method == http.MethodGet:
+		s.listRuns(w)
+
+	case len(segments) == 2 && segments[0] == "runs" && req.Method == http.MethodGet:
+		s.getRun(w, segments[1])
+
+	case len(segments) == 3 && segments[0] == "runs" && segments[2] == "events" && req.Method == http.MethodGet:
+		s.streamEvents(w, req, segments[1])
+
+	case len(segments) == 3 && segments[0] == "runs" && segments[2] == "cancel" && req.Method == http.MethodPost:
+		s.cancelRun(w, segments[1])
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s wasn't found", req.Method, req.URL.Path))
+	}
+}
+
+func (s *Server) authenticated(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *Server) listConfigurations(w http.ResponseWriter) {
+	out := make([]Configuration, 0, len(s.configurations))
+	for _, configuration := range s.configurations {
+		out = append(out, configuration)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	writeJSON(w, http.StatusOK, out)
+}
+
+type startRequest struct {
+	Prefix string `json:"prefix"`
+}
+
+func (s *Server) start(w http.ResponseWriter, req *http.Request, name string, plan bool) {
+	configuration, ok := s.configurations[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("the Configuration %q wasn't found", name))
+		return
+	}
+	if !plan && !s.base.ActuallyDelete {
+		writeError(w, http.StatusForbidden, fmt.Errorf("runs aren't allowed since the service wasn't started with `YES_I_REALLY_WANT_TO_DELETE_THINGS` - start a plan instead"))
+		return
+	}
+
+	var body startRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("parsing the request body: %+v", err))
+		return
+	}
+
+	opts, err := configuration.options(s.base, body.Prefix)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts.ActuallyDelete = !plan
+
+	runId, err := uuid.GenerateUUID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("generating a Run ID: %+v", err))
+		return
+	}
+	opts.RunID = runId
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("the service is shutting down"))
+		return
+	}
+	// concurrent runs for overlapping prefixes would race to delete the same Resource Groups
+	for _, existing := range s.runs {
+		summary := existing.summary(false)
+		if summary.Status == StatusRunning && prefixesOverlap(summary.Prefix, opts.Prefix) {
+			s.lock.Unlock()
+			writeError(w, http.StatusConflict, fmt.Errorf("%q is already in progress for the prefix %q, which overlaps with %q", summary.ID, summary.Prefix, opts.Prefix))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.deadline)
+	r := &run{
+		id:            runId,
+		configuration: configuration.Name,
+		prefix:        opts.Prefix,
+		plan:          plan,
+		startedAt:     time.Now(),
+		cancel:        cancel,
+		status:        StatusRunning,
+		events:        make([]Event, 0),
+		updated:       make(chan struct{}),
+	}
+	s.runs[runId] = r
+	s.order = append(s.order, runId)
+	s.pruneLocked()
+	s.inProgress.Add(1)
+	s.lock.Unlock()
+
+	s.logger.Printf("[DEBUG] Starting %q for the Configuration %q with the prefix %q (plan: %t)", runId, configuration.Name, opts.Prefix, plan)
+	go func() {
+		defer s.inProgress.Done()
+		defer cancel()
+		result, err := s.runner(ctx, *opts, r)
+		if err != nil {
+			s.logger.Printf("[DEBUG] %q failed: %+v", runId, err)
+		}
+		r.complete(result, err)
+		s.logger.Printf("[DEBUG] %q completed", runId)
+	}()
+
+	writeJSON(w, http.StatusAccepted, r.summary(false))
+}
+
+// pruneLocked removes the oldest completed runs, so that only the most recent maxCompletedRuns are retained
+func (s *Server) pruneLocked() {
+	completed := 0
+	for _, id := range s.order {
+		if s.runs[id].summary(false).Status != StatusRunning {
+			completed++
+		}
+	}
+
+	order := make([]string, 0, len(s.order))
+	for _, id := range s.order {
+		if completed > maxCompletedRuns && s.runs[id].summary(false).Status != StatusRunning {
+			delete(s.runs, id)
+			completed--
+			continue
+		}
+		order = append(order, id)
+	}
+	s.order = order
+}
+
+func (s *Server) find(id string) (*run, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, ok := s.runs[id]
+	return r, ok
+}
+
+func (s *Server) listRuns(w http.ResponseWriter) {
+	s.lock.Lock()
+	out := make([]Run, 0, len(s.order))
+	for _, id := range s.order {
+		out = append(out, s.runs[id].summary(false))
+	}
+	s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getRun(w http.ResponseWriter, id string) {
+	r, ok := s.find(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%q wasn't found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, r.summary(true))
+}
+
+func (s *Server) streamEvents(w http.ResponseWriter, req *http.Request, id string) {
+	r, ok := s.find(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%q wasn't found", id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	offset := 0
+	for {
+		items, completed, updated := r.eventsSince(offset)
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return
+			}
+		}
+		offset += len(items)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if completed {
+			return
+		}
+
+		select {
+		case <-req.Context().Done():
+			return
+		case <-updated:
+		}
+	}
+}
+
+func (s *Server) cancelRun(w http.ResponseWriter, id string) {
+	r, ok := s.find(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%q wasn't found", id))
+		return
+	}
+	if !r.requestCancellation() {
+		writeError(w, http.StatusConflict, fmt.Errorf("%q has already completed", id))
+		return
+	}
+
+	s.logger.Printf("[DEBUG] Cancelling %q..", id)
+	writeJSON(w, http.StatusAccepted, r.summary(false))
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	writeJSON(w, statusCode, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// prefixesOverlap returns whether a Resource Group could match both prefixes, which is the case when either
+// prefix starts with the other (compared case-insensitively, as Resource Group names are)
+func prefixesOverlap(first, second string) bool {
+	first = strings.ToLower(first)
+	second = strings.ToLower(second)
+	return strings.HasPrefix(first, second) || strings.HasPrefix(second, first)
+}
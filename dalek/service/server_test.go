@@ -0,0 +1,366 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/events"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
+)
+
+const testToken = "dalek-test-token"
+
+// blockingRunner notifies the observer that the run started, then waits until it's cancelled
+func blockingRunner(ctx context.Context, opts options.Options, observer events.Observer) (*dalek.Result, error) {
+	observer.Notify(ctx, events.Event{Type: events.TypeRunStarted, RunID: opts.RunID})
+	<-ctx.Done()
+	return &dalek.Result{Errors: []error{ctx.Err()}}, ctx.Err()
+}
+
+// planRunner records a DryRun action for a Resource Group named after the Prefix
+func planRunner(ctx context.Context, opts options.Options, observer events.Observer) (*dalek.Result, error) {
+	target := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/" + opts.Prefix + "-1"
+	observer.Notify(ctx, events.Event{Type: events.TypeRunStarted, RunID: opts.RunID})
+	observer.Notify(ctx, events.Event{Type: events.TypeResourceDiscovered, RunID: opts.RunID, Target: target})
+	observer.Notify(ctx, events.Event{Type: events.TypeRunCompleted, RunID: opts.RunID})
+	return &dalek.Result{
+		Actions: []report.Action{
+			{
+				Operation: "delete",
+				Target:    target,
+				Outcome:   report.OutcomeDryRun,
+			},
+		},
+	}, nil
+}
+
+func newTestServer(t *testing.T, actuallyDelete bool, runner Runner) *httptest.Server {
+	t.Helper()
+
+	configurations := []Configuration{
+		{
+			Name:   "nightly",
+			Prefix: "acctest",
+		},
+	}
+	base := options.Options{
+		ActuallyDelete: actuallyDelete,
+	}
+	server, err := New(base, configurations, testToken, time.Minute, runner, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("building the Server: %+v", err)
+	}
+	t.Cleanup(server.Close)
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func doRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("building request: %+v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("sending request: %+v", err)
+	}
+	t.Cleanup(func() {
+		resp.Body.Close()
+	})
+	return resp
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+
+	var out T
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decoding response: %+v", err)
+	}
+	return out
+}
+
+func TestServerRequests(t *testing.T) {
+	testData := []struct {
+		name               string
+		actuallyDelete     bool
+		method             string
+		path               string
+		token              string
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			name:               "no token",
+			method:             http.MethodGet,
+			path:               "/runs",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "invalid token",
+			method:             http.MethodGet,
+			path:               "/runs",
+			token:              "not-the-token",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "unknown configuration",
+			method:             http.MethodPost,
+			path:               "/configurations/weekly/plan",
+			token:              testToken,
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "run without deleting things",
+			method:             http.MethodPost,
+			path:               "/configurations/nightly/run",
+			token:              testToken,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "broadening the prefix",
+			method:             http.MethodPost,
+			path:               "/configurations/nightly/plan",
+			token:              testToken,
+			body:               `{"prefix": "acc"}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "narrowing the prefix",
+			method:             http.MethodPost,
+			path:               "/configurations/nightly/plan",
+			token:              testToken,
+			body:               `{"prefix": "acctest-pipeline-1234"}`,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "run",
+			actuallyDelete:     true,
+			method:             http.MethodPost,
+			path:               "/configurations/nightly/run",
+			token:              testToken,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "unknown run",
+			method:             http.MethodGet,
+			path:               "/runs/unknown",
+			token:              testToken,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			server := newTestServer(t, v.actuallyDelete, planRunner)
+			resp := doRequest(t, v.method, server.URL+v.path, v.token, v.body)
+			if resp.StatusCode != v.expectedStatusCode {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("expected the status code %d but got %d: %s", v.expectedStatusCode, resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestServerPlan(t *testing.T) {
+	server := newTestServer(t, false, planRunner)
+
+	resp := doRequest(t, http.MethodPost, server.URL+"/configurations/nightly/plan", testToken, `{"prefix": "acctest-pipeline"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected the plan to be started but got %d", resp.StatusCode)
+	}
+	started := decode[Run](t, resp)
+	if !started.Plan || started.Prefix != "acctest-pipeline" {
+		t.Fatalf("expected a plan for the prefix %q but got %+v", "acctest-pipeline", started)
+	}
+
+	// streaming the events returns once the plan has completed
+	resp = doRequest(t, http.MethodGet, server.URL+"/runs/"+started.ID+"/events", testToken, "")
+	types := make([]events.Type, 0)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("decoding event %q: %+v", scanner.Text(), err)
+		}
+		if event.RunID != started.ID {
+			t.Errorf("expected the event to be for %q but got %q", started.ID, event.RunID)
+		}
+		types = append(types, event.Type)
+	}
+	expectedTypes := []events.Type{events.TypeRunStarted, events.TypeResourceDiscovered, events.TypeRunCompleted}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Fatalf("expected the events %q but got %q", expectedTypes, types)
+	}
+
+	resp = doRequest(t, http.MethodGet, server.URL+"/runs/"+started.ID, testToken, "")
+	completed := decode[Run](t, resp)
+	if completed.Status != StatusSucceeded {
+		t.Fatalf("expected the plan to have succeeded but got %q", completed.Status)
+	}
+	if completed.Report == nil || len(completed.Report.Actions) != 1 || completed.Report.Actions[0].Outcome != report.OutcomeDryRun {
+		t.Fatalf("expected the report to contain a single DryRun action but got %+v", completed.Report)
+	}
+
+	resp = doRequest(t, http.MethodGet, server.URL+"/runs", testToken, "")
+	if runs := decode[[]Run](t, resp); len(runs) != 1 || runs[0].ID != started.ID {
+		t.Fatalf("expected the plan to be listed but got %+v", runs)
+	}
+}
+
+func TestServerCancel(t *testing.T) {
+	server := newTestServer(t, true, blockingRunner)
+
+	resp := doRequest(t, http.MethodPost, server.URL+"/configurations/nightly/run", testToken, "")
+	started := decode[Run](t, resp)
+
+	// only a single run can be in progress for each prefix
+	resp = doRequest(t, http.MethodPost, server.URL+"/configurations/nightly/plan", testToken, "")
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a second run for the same prefix to conflict but got %d", resp.StatusCode)
+	}
+
+	resp = doRequest(t, http.MethodPost, server.URL+"/runs/"+started.ID+"/cancel", testToken, "")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected the run to be cancelled but got %d", resp.StatusCode)
+	}
+
+	// the events are streamed until the run has completed
+	resp = doRequest(t, http.MethodGet, server.URL+"/runs/"+started.ID+"/events", testToken, "")
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	resp = doRequest(t, http.MethodGet, server.URL+"/runs/"+started.ID, testToken, "")
+	if completed := decode[Run](t, resp); completed.Status != StatusCancelled {
+		t.Fatalf("expected the run to have been cancelled but got %q", completed.Status)
+	}
+
+	resp = doRequest(t, http.MethodPost, server.URL+"/runs/"+started.ID+"/cancel", testToken, "")
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected cancelling a completed run to conflict but got %d", resp.StatusCode)
+	}
+}
+
+func TestServerOverlappingPrefixes(t *testing.T) {
+	testData := []struct {
+		name     string
+		first    string
+		second   string
+		conflict bool
+	}{
+		{
+			name:     "same prefix",
+			first:    "acctest-pipeline",
+			second:   "ACCTEST-PIPELINE",
+			conflict: true,
+		},
+		{
+			name:     "narrower prefix",
+			first:    "acctest",
+			second:   "acctest-pipeline",
+			conflict: true,
+		},
+		{
+			name:     "broader prefix",
+			first:    "acctest-pipeline",
+			second:   "acctest",
+			conflict: true,
+		},
+		{
+			name:   "distinct prefixes",
+			first:  "acctest-pipeline-1",
+			second: "acctest-pipeline-2",
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			server := newTestServer(t, true, blockingRunner)
+
+			resp := doRequest(t, http.MethodPost, server.URL+"/configurations/nightly/plan", testToken, fmt.Sprintf(`{"prefix": %q}`, v.first))
+			if resp.StatusCode != http.StatusAccepted {
+				t.Fatalf("expected the first plan to be started but got %d", resp.StatusCode)
+			}
+
+			expected := http.StatusAccepted
+			if v.conflict {
+				expected = http.StatusConflict
+			}
+			resp = doRequest(t, http.MethodPost, server.URL+"/configurations/nightly/plan", testToken, fmt.Sprintf(`{"prefix": %q}`, v.second))
+			if resp.StatusCode != expected {
+				t.Fatalf("expected the status code %d for the prefix %q while %q is running but got %d", expected, v.second, v.first, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	testData := []struct {
+		name        string
+		runner      Runner
+		expectError bool
+	}{
+		{
+			name:   "runs are waited for",
+			runner: blockingRunner,
+		},
+		{
+			name: "runs which don't stop",
+			runner: func(ctx context.Context, opts options.Options, observer events.Observer) (*dalek.Result, error) {
+				<-release
+				return &dalek.Result{}, nil
+			},
+			expectError: true,
+		},
+	}
+	for _, v := range testData {
+		t.Run(v.name, func(t *testing.T) {
+			server, err := New(options.Options{ActuallyDelete: true}, []Configuration{{Name: "nightly", Prefix: "acctest"}}, testToken, time.Minute, v.runner, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatalf("building the Server: %+v", err)
+			}
+			httpServer := httptest.NewServer(server)
+			t.Cleanup(httpServer.Close)
+
+			resp := doRequest(t, http.MethodPost, httpServer.URL+"/configurations/nightly/run", testToken, "")
+			started := decode[Run](t, resp)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err = server.Shutdown(ctx)
+			if v.expectError != (err != nil) {
+				t.Fatalf("expected an error %t but got: %+v", v.expectError, err)
+			}
+			if !v.expectError {
+				resp = doRequest(t, http.MethodGet, httpServer.URL+"/runs/"+started.ID, testToken, "")
+				if completed := decode[Run](t, resp); completed.Status != StatusCancelled {
+					t.Fatalf("expected the run to have been cancelled but got %q", completed.Status)
+				}
+			}
+
+			// no further runs can be started once the Server is shutting down
+			resp = doRequest(t, http.MethodPost, httpServer.URL+"/configurations/nightly/plan", testToken, `{"prefix": "acctest-other"}`)
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("expected starting a plan during shutdown to be unavailable but got %d", resp.StatusCode)
+			}
+		})
+	}
+}
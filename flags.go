@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+)
+
+// stringListFlag is a flag which can be specified multiple times
+type stringListFlag []string
+
+func (s *stringListFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringListFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func parseSubscriptionAllowList(ids, names, tags []string) (*options.SubscriptionAllowList, error) {
+	allowList := options.SubscriptionAllowList{
+		IDs:          ids,
+		DisplayNames: names,
+		Tags:         make(map[string]string),
+	}
+	for _, tag := range tags {
+		split := strings.SplitN(tag, "=", 2)
+		if len(split) != 2 || split[0] == "" {
+			return nil, fmt.Errorf("expected the tag %q to be in the format `key=value`", tag)
+		}
+		allowList.Tags[split[0]] = split[1]
+	}
+
+	// when nothing's been configured, only allow Subscriptions which have been explicitly opted in
+	if len(ids) == 0 && len(names) == 0 && len(tags) == 0 {
+		allowList.Tags["DalekAllowed"] = "true"
+	}
+
+	return &allowList, nil
+}
@@ -8,6 +8,7 @@ require (
 	github.com/hashicorp/go-azure-sdk/sdk v0.20240125.1172517
 	github.com/hashicorp/go-uuid v1.0.3
 	github.com/manicminer/hamilton v0.66.0
+	golang.org/x/oauth2 v0.16.0
 )
 
 require (
@@ -42,7 +43,6 @@ require (
 	github.com/zclconf/go-cty v1.13.1 // indirect
 	golang.org/x/crypto v0.18.0 // indirect
 	golang.org/x/net v0.20.0 // indirect
-	golang.org/x/oauth2 v0.16.0 // indirect
 	golang.org/x/sys v0.16.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
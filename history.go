@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/history"
+)
+
+// showHistory outputs the trends across the runs recorded in the history file, for example:
+//
+//	azurerm-dalek history -history-file=history.jsonl -days=7
+func showHistory(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	historyFile := flags.String("history-file", "", "-history-file=history.jsonl is the file the runs were recorded in")
+	days := flags.Int("days", 30, "-days=30 only includes the runs started within this many days")
+	top := flags.Int("top", 10, "-top=10 is the number of entries to show for each trend")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *historyFile == "" {
+		return fmt.Errorf("`-history-file` must be specified")
+	}
+
+	entries, err := history.NewStore(*historyFile).Load()
+	if err != nil {
+		return fmt.Errorf("loading the history: %+v", err)
+	}
+
+	since := time.Now().AddDate(0, 0, -*days)
+	return history.Summarise(entries, since, *top).Write(os.Stdout)
+}
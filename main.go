@@ -5,21 +5,70 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/hashicorp/go-uuid"
 	"github.com/tombuildsstuff/azurerm-dalek/clients"
+	"github.com/tombuildsstuff/azurerm-dalek/clients/transports"
 	"github.com/tombuildsstuff/azurerm-dalek/dalek"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/filters"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/history"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/interactive"
 	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/report"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		if err := showHistory(os.Args[2:]); err != nil {
+			log.Print(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Print("Starting Azure Dalek..")
 
 	prefix := flag.String("prefix", "acctest", "-prefix=acctest")
+	allowEmptyPrefix := flag.Bool("i-know-what-im-doing-no-prefix", false, "--i-know-what-im-doing-no-prefix allows running with an empty prefix, which matches every Resource Group")
+	allowedSubscriptionIds := stringListFlag{}
+	flag.Var(&allowedSubscriptionIds, "allowed-subscription-id", "-allowed-subscription-id=00000000-0000-0000-0000-000000000000 (can be specified multiple times)")
+	allowedSubscriptionNames := stringListFlag{}
+	flag.Var(&allowedSubscriptionNames, "allowed-subscription-name", "-allowed-subscription-name=\"My Test Subscription\" (can be specified multiple times)")
+	allowedSubscriptionTags := stringListFlag{}
+	flag.Var(&allowedSubscriptionTags, "allowed-subscription-tag", "-allowed-subscription-tag=DalekAllowed=true (can be specified multiple times, defaults to DalekAllowed=true)")
+	maxResourceGroups := flag.Int("max-resource-groups", 300, "-max-resource-groups=300 aborts the run when more Resource Groups than this would be deleted (0 disables this check)")
+	maxResourceGroupsPercentage := flag.Float64("max-resource-groups-percentage", 80, "-max-resource-groups-percentage=80 aborts the run when more than this percentage of the Resource Groups would be deleted (0 disables this check)")
+	overrideBlastRadius := flag.Bool("override-blast-radius", false, "--override-blast-radius allows this run to exceed the limits above")
+	quarantine := flag.Bool("quarantine", false, "--quarantine tags matching Resource Groups, which are then deleted by a later run once the grace period has elapsed")
+	quarantineGracePeriod := flag.Duration("quarantine-grace-period", 24*time.Hour, "-quarantine-grace-period=24h")
+	deleteExpired := flag.Bool("delete-expired", false, "--delete-expired also deletes the resources and Resource Groups anywhere in the Subscription whose expiry tag is in the past, regardless of the prefix")
+	expiryTag := flag.String("expiry-tag", options.DefaultExpiryTag, "-expiry-tag=ExpiresOn is the tag containing the date (e.g. 2026-11-01) a resource or Resource Group expires on")
+	interactiveMode := flag.Bool("interactive", false, "--interactive prompts for the Resource Groups and Cleaners to use, and to confirm each deletion - this actually deletes each confirmed resource, without YES_I_REALLY_WANT_TO_DELETE_THINGS needing to be set")
+	deadline := flag.Duration("deadline", 6*time.Hour, "-deadline=6h is the overall time limit for the run")
+	subscriptionCleanerTimeout := flag.Duration("subscription-cleaner-timeout", 2*time.Hour, "-subscription-cleaner-timeout=2h is the time budget for each Subscription Cleaner (0 disables this budget)")
+	resourceGroupTimeout := flag.Duration("resource-group-timeout", time.Hour, "-resource-group-timeout=1h is the time budget for cleaning and deleting each Resource Group (0 disables this budget)")
+	resourceGroupCleanerTimeout := flag.Duration("resource-group-cleaner-timeout", 30*time.Minute, "-resource-group-cleaner-timeout=30m is the time budget for each Resource Group Cleaner within a Resource Group (0 disables this budget)")
+	minimumAge := flag.Duration("min-age", 0, "-min-age=24h only deletes Resource Groups created at least this long ago (0 disables this check)")
+	nameTimestampPattern := flag.String("name-timestamp-pattern", "", "-name-timestamp-pattern='(?i)^acctestRG-(\\d{10})' infers when a Resource Group was created from the timestamp matched by the first capture group")
+	nameTimestampLayout := flag.String("name-timestamp-layout", filters.DefaultNameTimestampLayout, "-name-timestamp-layout=0601021504 is the Go time layout of the timestamp matched by -name-timestamp-pattern")
+	stuckDeletionThreshold := flag.Duration("stuck-deletion-threshold", 24*time.Hour, "-stuck-deletion-threshold=24h diagnoses which resources remain in Resource Groups which have been Deleting for longer than this (0 disables this check)")
+	deletionStatusTimeout := flag.Duration("deletion-status-timeout", 10*time.Minute, "-deletion-status-timeout=10m is how long to wait for the Resource Group deletions to complete, so the reason for any failures can be reported (0 checks once)")
+	recordCassette := flag.String("record-cassette", "", "-record-cassette=cassette.json records a sanitized copy of each request and response, which can be replayed in tests")
+	serveAddress := flag.String("serve", "", "-serve=:8080 runs the Dalek as a service with an HTTP API to start plans and runs of the Configurations in -service-config")
+	serviceConfig := flag.String("service-config", "", "-service-config=service.json is the file containing the named Configurations used by -serve")
+	historyFile := flag.String("history-file", "", "-history-file=history.jsonl appends a summary of each run to this file, which can be viewed using the `history` subcommand")
 	flag.Parse()
 
+	allowList, err := parseSubscriptionAllowList(allowedSubscriptionIds, allowedSubscriptionNames, allowedSubscriptionTags)
+	if err != nil {
+		log.Print(err.Error())
+		os.Exit(1)
+	}
+
 	credentials := clients.Credentials{
 		ClientID:        os.Getenv("ARM_CLIENT_ID"),
 		ClientSecret:    os.Getenv("ARM_CLIENT_SECRET"),
@@ -28,46 +77,107 @@ func main() {
 		EnvironmentName: os.Getenv("ARM_ENVIRONMENT"),
 		Endpoint:        os.Getenv("ARM_ENDPOINT"),
 	}
+	runId, err := uuid.GenerateUUID()
+	if err != nil {
+		log.Printf("generating a Run ID: %+v", err)
+		os.Exit(1)
+	}
+
+	// when running interactively each deletion is confirmed by the user, which takes the place of YES_I_REALLY_WANT_TO_DELETE_THINGS
 	opts := options.Options{
-		ActuallyDelete:                 strings.EqualFold(os.Getenv("YES_I_REALLY_WANT_TO_DELETE_THINGS"), "true"),
+		RunID:                          runId,
+		ActuallyDelete:                 strings.EqualFold(os.Getenv("YES_I_REALLY_WANT_TO_DELETE_THINGS"), "true") || *interactiveMode,
 		NumberOfResourceGroupsToDelete: int64(1000),
 		Prefix:                         *prefix,
+		AllowEmptyPrefix:               *allowEmptyPrefix,
+		AllowedSubscriptions:           *allowList,
+		BlastRadius: options.BlastRadius{
+			MaxResourceGroups: *maxResourceGroups,
+			MaxPercentage:     *maxResourceGroupsPercentage,
+			Override:          *overrideBlastRadius,
+		},
+		Quarantine: options.Quarantine{
+			Enabled:     *quarantine,
+			GracePeriod: *quarantineGracePeriod,
+		},
+		Expiry: options.Expiry{
+			Enabled: *deleteExpired,
+			Tag:     *expiryTag,
+		},
+		Age: options.Age{
+			MinimumAge:     *minimumAge,
+			NamePattern:    *nameTimestampPattern,
+			NameTimeLayout: *nameTimestampLayout,
+		},
+		Diagnostics: options.Diagnostics{
+			StuckDeletionThreshold: *stuckDeletionThreshold,
+			DeletionStatusTimeout:  *deletionStatusTimeout,
+		},
+		Timeouts: options.Timeouts{
+			SubscriptionCleaner:  *subscriptionCleanerTimeout,
+			ResourceGroup:        *resourceGroupTimeout,
+			ResourceGroupCleaner: *resourceGroupCleanerTimeout,
+		},
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
-	defer cancel()
-	if err := run(ctx, credentials, opts); err != nil {
-		log.Print(err.Error())
-		os.Exit(1)
+	configure := []dalek.Option{
+		dalek.WithCredentials(credentials),
 	}
-}
-
-func run(ctx context.Context, credentials clients.Credentials, opts options.Options) error {
-	sdkClient, err := clients.BuildAzureClient(ctx, credentials)
-	if err != nil {
-		return fmt.Errorf("building Azure Clients: %+v", err)
+	if *historyFile != "" {
+		configure = append(configure, dalek.WithHistory(history.NewStore(*historyFile)))
 	}
-
-	log.Printf("[DEBUG] Options: %s", opts)
-
-	client := dalek.NewDalek(sdkClient, opts)
-	log.Printf("[DEBUG] Processing Resource Manager..")
-	if errors := client.ResourceManager(ctx); len(errors) != 0 {
-		errList := make([]string, 0)
-		for _, e := range errors {
-			errList = append(errList, e.Error())
+	if *serveAddress != "" {
+		if *interactiveMode || *recordCassette != "" {
+			log.Print("`-interactive` and `-record-cassette` can't be used with `-serve`")
+			os.Exit(1)
 		}
+		if err := serve(*serveAddress, *serviceConfig, *deadline, opts, configure...); err != nil {
+			log.Print(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 
-		return fmt.Errorf("processing Resource Manager: %+v", strings.Join(errList, "\n"))
+	ctx, cancel := context.WithTimeout(context.Background(), *deadline)
+	defer cancel()
+	var recorder *transports.CassetteRecorder
+	if *recordCassette != "" {
+		recorder = transports.NewCassetteRecorder(http.DefaultTransport, transports.Sanitizer{
+			SubscriptionIDs: []string{credentials.SubscriptionID},
+			Secrets:         []string{credentials.ClientID, credentials.TenantID},
+		})
+		configure = append(configure, dalek.WithClientOptions(clients.ClientOptions{
+			Transport: recorder,
+		}))
+	}
+	if *interactiveMode {
+		// each deletion is confirmed individually, rather than via `YES_I_REALLY_WANT_TO_DELETE_THINGS`
+		configure = append(configure, dalek.WithPrompter(interactive.New(os.Stdin, os.Stdout)))
 	}
 
-	log.Printf("[DEBUG] Processing Microsoft Graph..")
-	if err := client.MicrosoftGraph(ctx); err != nil {
-		return fmt.Errorf("processing Microsoft Graph: %+v", err)
+	err = run(ctx, opts, configure...)
+	if recorder != nil {
+		log.Printf("[DEBUG] Saving the cassette to %q..", *recordCassette)
+		if saveErr := recorder.Save(*recordCassette); saveErr != nil {
+			log.Printf("saving the cassette: %+v", saveErr)
+		}
+	}
+	if err != nil {
+		log.Print(err.Error())
+		os.Exit(1)
 	}
-	log.Printf("[DEBUG] Processing Management Groups..")
-	if err := client.ManagementGroups(ctx); err != nil {
-		return fmt.Errorf("processing Management Groups: %+v", err)
+}
+
+func run(ctx context.Context, opts options.Options, configure ...dalek.Option) error {
+	client, err := dalek.New(ctx, opts, configure...)
+	if err != nil {
+		return fmt.Errorf("building the Dalek: %+v", err)
 	}
+	defer client.Close()
 
-	return nil
+	result, err := client.Run(ctx)
+	report.Log(log.Default(), result.Actions)
+	report.LogOverruns(log.Default(), result.Overruns)
+	report.LogDeletionFailures(log.Default(), result.DeletionFailures)
+	report.LogStuckDeletions(log.Default(), result.StuckDeletions)
+	return err
 }
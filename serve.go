@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/tombuildsstuff/azurerm-dalek/dalek"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/options"
+	"github.com/tombuildsstuff/azurerm-dalek/dalek/service"
+)
+
+// runShutdownTimeout is how long to wait for the plans and runs in progress to complete once they've been
+// cancelled when the service is interrupted
+const runShutdownTimeout = 2 * time.Minute
+
+// serve runs the Dalek as a service listening on `address`, which starts plans and runs for the Configurations
+// in `configurationsPath` until interrupted
+func serve(address, configurationsPath string, deadline time.Duration, opts options.Options, configure ...dalek.Option) error {
+	if configurationsPath == "" {
+		return fmt.Errorf("`-service-config` must be specified when using `-serve`")
+	}
+	configurations, err := service.LoadConfigurations(configurationsPath)
+	if err != nil {
+		return fmt.Errorf("loading the Configurations: %+v", err)
+	}
+
+	server, err := service.New(opts, configurations, os.Getenv("DALEK_SERVICE_TOKEN"), deadline, service.DalekRunner(log.Default(), configure...), log.Default())
+	if err != nil {
+		return fmt.Errorf("building the service: %+v", err)
+	}
+	defer server.Close()
+
+	httpServer := &http.Server{
+		Addr:              address,
+		Handler:           server,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Printf("[DEBUG] Shutting down the service..")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("[DEBUG] Listening on %q with %d Configurations (runs allowed: %t)..", address, len(configurations), opts.ActuallyDelete)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("listening on %q: %+v", address, err)
+	}
+
+	// the plans and runs in progress are cancelled, then waited on so that they stop (and record their results)
+	// before exiting
+	log.Printf("[DEBUG] Waiting for the plans and runs in progress to be cancelled..")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), runShutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}